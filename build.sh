@@ -1,4 +1,6 @@
 #!/bin/sh
 
 go build -o bin/update github.com/Encinarus/genconplanner/cmd/update && \
-go build -o bin/web github.com/Encinarus/genconplanner/cmd/web
\ No newline at end of file
+go build -o bin/migrate github.com/Encinarus/genconplanner/cmd/migrate && \
+go build -o bin/remap github.com/Encinarus/genconplanner/cmd/remap && \
+go build -o bin/web github.com/Encinarus/genconplanner/cmd/web
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"log"
+	"os"
+)
+
+var toVersion = flag.Int("to", 0, "for up, the version to migrate to, 0 for the latest")
+var steps = flag.Int("steps", 1, "for down, how many migrations to undo")
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]v [flags] up      apply migrations, all of them unless -to is given
+  %[1]v [flags] down    undo the last -steps migrations
+  %[1]v [flags] status  list migrations and when they were applied
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := postgres.OpenDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch flag.Arg(0) {
+	case "up":
+		err = postgres.MigrateUp(db, *toVersion)
+	case "down":
+		err = postgres.MigrateDown(db, *steps)
+	case "status":
+		err = printStatus(db)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printStatus(db *sql.DB) error {
+	states, err := postgres.MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		applied := "not applied"
+		if state.AppliedAt != nil {
+			applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Printf("%04d %-24v %v\n", state.Version, state.Name, applied)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"log"
+	"time"
+)
+
+// Re-applies the game system remap rules to events already in the database,
+// so a new rule takes effect without waiting for the next import.
+
+var year = flag.Int("year", time.Now().Year(), "year of events to remap")
+
+func main() {
+	flag.Parse()
+
+	db, err := postgres.OpenDb()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	dbRules, err := postgres.LoadRemapRules(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules := append(events.DefaultRemapRules(), dbRules...)
+	log.Printf("Applying %d remap rules to %d events", len(rules), *year)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	updated, err := postgres.RemapEvents(tx, *year, rules)
+	if err != nil {
+		tx.Rollback()
+		log.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Updated %d events", updated)
+}
@@ -1,15 +1,34 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/Encinarus/genconplanner/internal/background"
 	"github.com/Encinarus/genconplanner/internal/postgres"
 	"log"
+	"os"
 )
 
 var sourceFile = flag.String("eventFile", "https://www.gencon.com/downloads/events.xlsx", "file path or url to load from")
+var dryRun = flag.Bool("dry-run", false, "report what the import would change, without changing anything")
+var jsonReport = flag.String("json-report", "", "file to write -dry-run's report to as json, - to print it as json instead of text")
+var force = flag.Bool("force", false, "import even if it would deactivate more events than -max_deactivated_percent or -max_drop_percent allow")
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  %[1]v [flags]               import the catalog from -eventFile
+  %[1]v -dry-run [flags]      report what importing -eventFile would change
+  %[1]v [flags] replay <dir>  import every archived catalog under dir, oldest first
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
 	db, err := postgres.OpenDb()
@@ -17,10 +36,67 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	if err = postgres.CheckSchema(db); err != nil {
+		log.Fatal(err)
+	}
 
-	if len(*sourceFile) == 0 {
+	if len(*sourceFile) == 0 && flag.Arg(0) == "" {
 		log.Fatalf("You must specify a source file")
 	}
+	if *dryRun {
+		if flag.NArg() != 0 {
+			log.Fatalf("-dry-run only works for a single import")
+		}
+		if err = writeDryRunReport(db); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var counts background.JobCounts
+	switch flag.Arg(0) {
+	case "":
+		counts, err = background.UpdateEventsFromGencon(db, *sourceFile, background.ImportLimits(*force))
+	case "replay":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		counts, err = background.ReplayCatalogs(db, os.DirFS(flag.Arg(1)), background.ImportLimits(*force))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Import finished: %v", counts)
+}
+
+// writeDryRunReport prints what an import would change, as text unless
+// -json-report asks for json.
+func writeDryRunReport(db *sql.DB) error {
+	report, err := background.DryRunUpdate(db, *sourceFile, background.ImportLimits(*force))
+	if err != nil {
+		return err
+	}
+	if *jsonReport == "" {
+		report.WriteText(os.Stdout)
+		return nil
+	}
 
-	background.UpdateEventsFromGencon(db, *sourceFile)
+	reportJson, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *jsonReport == "-" {
+		_, err = fmt.Fprintln(os.Stdout, string(reportJson))
+		return err
+	}
+	report.WriteText(os.Stdout)
+	if err = os.WriteFile(*jsonReport, reportJson, 0644); err != nil {
+		return err
+	}
+	log.Printf("Wrote json report to %v", *jsonReport)
+	return nil
 }
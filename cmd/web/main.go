@@ -23,6 +23,11 @@ import (
 
 var port = flag.Int("port", 8080, "port to listen on")
 var sourceFile = flag.String("eventFile", "https://www.gencon.com/downloads/events.xlsx", "file path or url to load from")
+var importInterval = flag.Duration("import_interval", 0, "how often to import events from gencon, 0 to only import on demand")
+// Crawling BGG is long and hits their api hard, so once a week will do
+var bggInterval = flag.Duration("bgg_interval", 7*24*time.Hour, "how long to wait between crawls of BGG")
+var cacheInterval = flag.Duration("cache_interval", time.Hour, "how often to refresh the cache of BGG games")
+var suggestInterval = flag.Duration("suggest_interval", 5*time.Minute, "how often to check whether search suggestions need reloading")
 
 func main() {
 	flag.Parse()
@@ -37,46 +42,34 @@ func main() {
 	}
 	defer db.Close()
 
+	// Serving from an old schema fails in confusing ways, on whichever
+	// pages use the missing bits.
+	if err = postgres.CheckSchema(db); err != nil {
+		log.Fatal(err)
+	}
+
 	cache := background.NewGameCache(db)
-	cache.PeriodicallyUpdate()
-	SetupBackground(db)
+	suggestIndex := background.NewSuggestIndex(db, cache)
+	scheduler := SetupBackground(db, cache, suggestIndex)
 
-	SetupWeb(db, cache) // Must be last, won't return until server shutdown
+	SetupWeb(db, cache, suggestIndex, scheduler) // Must be last, won't return until server shutdown
 }
 
-func SetupBackground(db *sql.DB) {
-	// We run this in a background thread on web because running as a separate
-	// app would be expensive. Unlike updating from gencon, these take a long time to
-	// process, so the app would be running continually, costing a bit more money than
-	// we want.
-	// Update from BGG once per week
-	bggTicker := time.NewTicker(time.Hour * 24 * 7)
-
-	go func() {
-		for {
-			// Delay until the next tick
-			background.UpdateGamesFromBGG(db)
-			select {
-			case <-bggTicker.C:
-			}
-		}
-	}()
-
-	// TODO: decide if this should run here too.
-	if 1 == 2 {
-		genconTicker := time.NewTicker(time.Hour)
-		go func() {
-			for {
-				background.UpdateEventsFromGencon(db, *sourceFile)
-				select {
-				case <-genconTicker.C:
-				}
-			}
-		}()
-	}
+func SetupBackground(db *sql.DB, cache *background.GameCache, suggestIndex *background.SuggestIndex) *background.Scheduler {
+	// We run these in background threads on web because running as a separate
+	// app would be expensive. The BGG crawl takes a long time to process, so
+	// the app would be running continually, costing a bit more money than we
+	// want. Jobs other than the cache refresh only run on one dyno at a time.
+	scheduler := background.NewScheduler(db)
+	scheduler.Register(background.NewGenconImportJob(db, *sourceFile, *importInterval, background.ImportLimits(false)))
+	scheduler.Register(background.NewBggCrawlJob(db, *bggInterval))
+	scheduler.Register(background.NewCacheRefreshJob(cache, *cacheInterval))
+	scheduler.Register(background.NewSuggestIndexJob(suggestIndex, *suggestInterval))
+	scheduler.Start()
+	return scheduler
 }
 
-func SetupWeb(db *sql.DB, cache *background.GameCache) {
+func SetupWeb(db *sql.DB, cache *background.GameCache, suggestIndex *background.SuggestIndex, scheduler *background.Scheduler) {
 
 	opt := option.WithCredentialsJSON([]byte(os.Getenv("FIREBASE_CONFIG")))
 	app, err := firebase.NewApp(context.Background(), nil, opt)
@@ -85,6 +78,9 @@ func SetupWeb(db *sql.DB, cache *background.GameCache) {
 	}
 
 	r := gin.Default()
+	// Called on every keystroke in the search box, so it's registered before
+	// the context, which looks up the signed in user.
+	r.GET("/api/suggest", web.Suggest(suggestIndex))
 	r.Use(web.BootstrapContext(app, db))
 
 	r.SetFuncMap(web.GetTemplateFunctions(cache))
@@ -110,10 +106,22 @@ func SetupWeb(db *sql.DB, cache *background.GameCache) {
 	r.GET("/listStarredGroups/:year", web.GetStarredEventGroups(db))
 	r.GET("/about", web.About(db))
 	r.GET("/user", web.User(db))
+	r.POST("/user/alerts", web.UpdateAlertSettings(db))
 	r.GET("/admin/orgs/", web.ViewOrgs(db))
 	r.POST("/admin/orgs/", web.MergeOrgs(db))
 
+	admin := r.Group("/admin", web.RequireAdmin())
+	admin.GET("/remaps", web.ViewRemaps(db))
+	admin.POST("/remaps", web.AddRemap(db))
+	admin.POST("/remaps/delete", web.DeleteRemap(db))
+	admin.GET("/jobs", web.ViewJobs(db, scheduler))
+	admin.GET("/jobs/runs", web.ListJobRuns(db))
+	admin.POST("/jobs/run", web.TriggerJob(db, scheduler))
+	admin.POST("/jobs/import", web.RunImport(db, scheduler))
+
 	r.POST("/party/new", web.NewParty(db))
 	r.GET("/party/:party_id", web.Party(db))
+
+	web.RegisterAPI(r, db)
 	r.Run(fmt.Sprintf(":%d", *port))
 }
@@ -0,0 +1,100 @@
+package background
+
+import (
+	"database/sql"
+	"flag"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/notify"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"log"
+	"net"
+	"net/smtp"
+)
+
+var (
+	siteUrl      = flag.String("site_url", "https://genconplanner.com", "base url used in links sent to users")
+	smtpAddr     = flag.String("smtp_addr", "", "host:port of the SMTP server for alert emails, alerts aren't emailed if empty")
+	smtpFrom     = flag.String("smtp_from", "alerts@genconplanner.com", "from address for alert emails")
+	smtpUser     = flag.String("smtp_user", "", "SMTP username, if the server needs auth")
+	smtpPassword = flag.String("smtp_password", "", "SMTP password, if the server needs auth")
+)
+
+func mailerFromFlags() *notify.Mailer {
+	if *smtpAddr == "" {
+		return nil
+	}
+	mailer := &notify.Mailer{Addr: *smtpAddr, From: *smtpFrom}
+	if *smtpUser != "" {
+		host, _, _ := net.SplitHostPort(*smtpAddr)
+		mailer.Auth = smtp.PlainAuth("", *smtpUser, *smtpPassword, host)
+	}
+	return mailer
+}
+
+// buildDigests groups the alert worthy changes by the users who starred
+// the changed events.
+func buildDigests(changes []events.EventChange, alerts []*postgres.StarredAlert) ([]*notify.Digest, map[string]*postgres.AlertSettings) {
+	changesById := make(map[string][]events.EventChange)
+	for _, change := range changes {
+		if notify.AlertKinds[change.Kind] {
+			changesById[change.EventId] = append(changesById[change.EventId], change)
+		}
+	}
+
+	var digests []*notify.Digest
+	digestsByEmail := make(map[string]*notify.Digest)
+	settings := make(map[string]*postgres.AlertSettings)
+	for _, alert := range alerts {
+		digest, found := digestsByEmail[alert.Email]
+		if !found {
+			digest = &notify.Digest{Email: alert.Email}
+			digestsByEmail[alert.Email] = digest
+			digests = append(digests, digest)
+			alertSettings := alert.AlertSettings
+			settings[alert.Email] = &alertSettings
+		}
+		link := *siteUrl + (&events.GenconEvent{EventId: alert.EventId}).PlannerLink()
+		for _, change := range changesById[alert.EventId] {
+			digest.AddChange(alert.Title, link, change)
+		}
+	}
+	return digests, settings
+}
+
+// SendChangeAlerts tells users about changes to the events they starred.
+// Failing to reach one user doesn't stop the others from being notified.
+func SendChangeAlerts(db *sql.DB, changes []events.EventChange) error {
+	eventIds := make([]string, 0)
+	for _, change := range changes {
+		if notify.AlertKinds[change.Kind] {
+			eventIds = append(eventIds, change.EventId)
+		}
+	}
+	if len(eventIds) == 0 {
+		return nil
+	}
+
+	alerts, err := postgres.LoadStarredAlerts(db, eventIds)
+	if err != nil {
+		return err
+	}
+	digests, settings := buildDigests(changes, alerts)
+	log.Printf("Sending change alerts to %d users", len(digests))
+
+	mailer := mailerFromFlags()
+	poster := notify.NewWebhookPoster()
+	for _, digest := range digests {
+		userSettings := settings[digest.Email]
+		if userSettings.EmailEnabled && mailer != nil {
+			if err := mailer.Send(digest); err != nil {
+				log.Printf("Unable to email alerts to %v: %v", digest.Email, err)
+			}
+		}
+		if userSettings.WebhookUrl != "" {
+			if err := poster.Post(userSettings.WebhookUrl, digest); err != nil {
+				log.Printf("Unable to post alerts for %v: %v", digest.Email, err)
+			}
+		}
+	}
+	return nil
+}
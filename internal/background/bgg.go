@@ -70,7 +70,9 @@ func RefreshGame(ctx context.Context, bggId int64,
 	return g, nil
 }
 
-func UpdateGamesFromBGG(db *sql.DB) {
+// UpdateGamesFromBGG crawls BGG until there's nothing left to refresh,
+// returning how many games and families it refreshed.
+func UpdateGamesFromBGG(db *sql.DB) JobCounts {
 	ctx := context.Background()
 	api := bgg.NewBggApi()
 
@@ -106,6 +108,7 @@ func UpdateGamesFromBGG(db *sql.DB) {
 
 	families := make(map[int64]*postgres.GameFamily)
 	games := make(map[int64]*postgres.Game)
+	counts := JobCounts{"games": 0, "families": 0, "errors": 0}
 
 	log.Printf("Beginning update of games from BGG, initial game backlog: %v", len(gameBacklog))
 
@@ -155,6 +158,7 @@ func UpdateGamesFromBGG(db *sql.DB) {
 			_, err := RefreshGame(ctx, id, familyBacklog, db, api)
 			if err != nil {
 				log.Printf("Issue getting apiGame %v", err)
+				counts["errors"]++
 				continue
 			}
 		}
@@ -173,6 +177,7 @@ func UpdateGamesFromBGG(db *sql.DB) {
 			_, err := RefreshGame(ctx, id, familyBacklog, db, api)
 			if err != nil {
 				log.Printf("Issue getting apiGame %v", err)
+				counts["errors"]++
 				continue
 			}
 		}
@@ -189,6 +194,7 @@ func UpdateGamesFromBGG(db *sql.DB) {
 			bggFamily, err := api.GetFamily(ctx, id)
 			if err != nil {
 				log.Printf("Issue getting family: %v", err)
+				counts["errors"]++
 				continue
 			}
 			gameIds := make([]int64, 0, 0)
@@ -206,14 +212,19 @@ func UpdateGamesFromBGG(db *sql.DB) {
 			err = families[id].Upsert(db)
 			if err != nil {
 				log.Printf("Issue saving family: %v", err)
+				counts["errors"]++
 				continue
 			}
 		}
 
-		// We're done! We don't know about anything else to dig into
+		// We're done! We don't know about anything else to dig into. The
+		// scheduler will start us again later.
 		if processedFamilies == 0 && processedGames == 0 {
-			log.Printf("No updates needed, sleeping for four hours")
-			time.Sleep(4 * time.Hour)
+			log.Printf("No updates needed, done crawling")
+			return counts
 		}
+		counts["games"] += processedGames
+		counts["families"] += processedFamilies
 	}
+	return counts
 }
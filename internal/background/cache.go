@@ -3,7 +3,6 @@ package background
 import (
 	"database/sql"
 	"github.com/Encinarus/genconplanner/internal/postgres"
-	"log"
 	"math"
 	"sort"
 	"strings"
@@ -27,23 +26,6 @@ func NewGameCache(db *sql.DB) *GameCache {
 	}
 }
 
-func (gc *GameCache) PeriodicallyUpdate() {
-	bgTicker := time.NewTicker(time.Hour)
-
-	go func() {
-		for {
-			err := gc.UpdateCache()
-			if err != nil {
-				log.Printf("Error updating cache: %v", err)
-			}
-
-			select {
-			case <-bgTicker.C:
-			}
-		}
-	}()
-}
-
 func (gc *GameCache) UpdateCache() error {
 	dbGames, err := postgres.LoadGames(gc.db)
 	if err != nil {
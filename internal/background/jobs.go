@@ -0,0 +1,60 @@
+package background
+
+import (
+	"context"
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"time"
+)
+
+const (
+	GenconImportJob = "gencon-import"
+	BggCrawlJob     = "bgg-crawl"
+	CacheRefreshJob = "cache-refresh"
+	SuggestIndexJob = "suggest-index"
+)
+
+func NewGenconImportJob(db *sql.DB, sourceFile string, interval time.Duration, limits *events.DeactivationLimits) *Job {
+	return &Job{
+		Name:     GenconImportJob,
+		Interval: interval,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			return UpdateEventsFromGencon(db, sourceFile, limits)
+		},
+	}
+}
+
+func NewBggCrawlJob(db *sql.DB, interval time.Duration) *Job {
+	return &Job{
+		Name:     BggCrawlJob,
+		Interval: interval,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			return UpdateGamesFromBGG(db), nil
+		},
+	}
+}
+
+// The cache is in memory, so every instance refreshes its own.
+func NewCacheRefreshJob(cache *GameCache, interval time.Duration) *Job {
+	return &Job{
+		Name:     CacheRefreshJob,
+		Interval: interval,
+		Local:    true,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			return nil, cache.UpdateCache()
+		},
+	}
+}
+
+// Checks whether the catalog changed, only reloading the index when it did.
+// Like the cache, every instance has its own.
+func NewSuggestIndexJob(index *SuggestIndex, interval time.Duration) *Job {
+	return &Job{
+		Name:     SuggestIndexJob,
+		Interval: interval,
+		Local:    true,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			return index.Refresh()
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package background
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// replayFile is an archived catalog and when it's from.
+type replayFile struct {
+	Name    string
+	AsOf    time.Time
+	ModTime time.Time
+}
+
+func parseCatalog(name string, data []byte) ([]*events.GenconEvent, []events.RowError, error) {
+	if strings.EqualFold(path.Ext(name), ".csv") {
+		return events.ParseGenconCsv(data)
+	}
+	return events.ParseGenconSheet(data)
+}
+
+func isCatalogFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	// Dot files are temp files from a snapshot store write in progress
+	return (ext == ".xlsx" || ext == ".csv") && !strings.HasPrefix(path.Base(name), ".")
+}
+
+// catalogTime is when a catalog is from, as best we can tell. The catalog
+// doesn't say when it was exported, but it can't be older than the latest
+// change to an event in it. Failing that, it's the file's own time.
+func catalogTime(parsedEvents []*events.GenconEvent, modTime time.Time) time.Time {
+	var latest time.Time
+	for _, event := range parsedEvents {
+		if event.LastModified.After(latest) {
+			latest = event.LastModified
+		}
+	}
+	if latest.IsZero() {
+		return modTime
+	}
+	return latest
+}
+
+// findReplayFiles finds every catalog under fsys, oldest first. Each one is
+// parsed to date it, but not kept, since a few years of snapshots won't all
+// fit in memory at once.
+func findReplayFiles(fsys fs.FS) ([]*replayFile, error) {
+	files := make([]*replayFile, 0)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isCatalogFile(name) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		parsedEvents, _, err := parseCatalog(name, data)
+		if err != nil {
+			log.Printf("Unable to parse %v, skipping it: %v", name, err)
+			return nil
+		}
+		files = append(files, &replayFile{
+			Name:    name,
+			AsOf:    catalogTime(parsedEvents, info.ModTime()),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].AsOf.Equal(files[j].AsOf) {
+			return files[i].AsOf.Before(files[j].AsOf)
+		}
+		if !files[i].ModTime.Equal(files[j].ModTime) {
+			return files[i].ModTime.Before(files[j].ModTime)
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// ReplayCatalogs imports every archived catalog under fsys in the order they
+// were published, across however many years they cover, so the events table
+// along with its change and ticket history can be rebuilt from scratch.
+// Nobody is alerted, the changes are long past. Catalogs the limits abort are
+// skipped, the same as they were when first imported, but not recorded as
+// aborted again.
+func ReplayCatalogs(db *sql.DB, fsys fs.FS, limits *events.DeactivationLimits) (JobCounts, error) {
+	files, err := findReplayFiles(fsys)
+	if err != nil {
+		return nil, err
+	}
+	totals := JobCounts{"files": len(files)}
+	for i, file := range files {
+		log.Printf("Replaying %v (%d of %d), as of %v", file.Name, i+1, len(files), file.AsOf)
+		data, err := fs.ReadFile(fsys, file.Name)
+		if err != nil {
+			return totals, err
+		}
+		parsedEvents, rowErrors, err := parseCatalog(file.Name, data)
+		if err != nil {
+			return totals, fmt.Errorf("unable to parse %v: %w", file.Name, err)
+		}
+		reportRowErrors(file.Name, rowErrors)
+		if len(parsedEvents) == 0 {
+			log.Printf("No events in %v, skipping it", file.Name)
+			totals["skipped"]++
+			continue
+		}
+
+		applyRemapRules(db, parsedEvents)
+		counts := JobCounts{"parsed": len(parsedEvents), "row_errors": len(rowErrors)}
+		_, err = writeEvents(db, parsedEvents, file.AsOf, limits, counts)
+		var abortErr *events.DeactivationError
+		if errors.As(err, &abortErr) {
+			log.Printf("Skipping %v: %v", file.Name, err)
+		} else if err != nil {
+			return totals, fmt.Errorf("unable to replay %v: %w", file.Name, err)
+		}
+		for name, count := range counts {
+			totals[name] += count
+		}
+	}
+	return totals, nil
+}
@@ -0,0 +1,53 @@
+package background
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+const catalogHeader = "Game ID,Group,Title,Short Description,Long Description,Event Type,Game System,Rules Edition," +
+	"Minimum Players,Maximum Players,Age Required,Experience Required,Materials Provided,Start Date & Time,Duration," +
+	"End Date & Time,GM Names,Website,Email,Tournament?,Round Number,Total Rounds,Minimum Play Time," +
+	"Attendee Registration?,Cost $,Location,Room Name,Table Number,Special Category,Tickets Available,Last Modified\n"
+
+func replayCatalog(eventId string, year int, lastModified string) *fstest.MapFile {
+	row := fmt.Sprintf("%v,Gen Con,True Dungeon,Solve puzzles,,TDA - True Dungeon,True Dungeon,,10,10,Teen (13+),None,Yes,"+
+		"08/01/%d 10:00 AM,2,08/01/%d 12:00 PM,,,,No,,,0.5,Yes,48,Union Station,Grand Hall,0,,20,%v\n",
+		eventId, year, year, lastModified)
+	return &fstest.MapFile{
+		Data:    []byte(catalogHeader + row),
+		ModTime: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFindReplayFiles(t *testing.T) {
+	undated := replayCatalog("TDA19000001", 2019, "")
+	undated.ModTime = time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"2023.csv":                replayCatalog("TDA23ND00001", 2023, "01/15/2023 09:00 AM"),
+		"2015/late.csv":           replayCatalog("TDA15000001", 2015, "07/20/2015 09:00 AM"),
+		"2015/early.csv":          replayCatalog("TDA15000001", 2015, "06/01/2015 09:00 AM"),
+		"undated.csv":             undated,
+		"notes.txt":               {Data: []byte("not a catalog")},
+		"ab/.snapshot-123456.csv": replayCatalog("TDA23ND00001", 2023, "01/01/2010 09:00 AM"),
+	}
+
+	files, err := findReplayFiles(fsys)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"2015/early.csv", "2015/late.csv", "undated.csv", "2023.csv"}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %v, got %d files", expected, len(files))
+	}
+	for i, name := range expected {
+		if files[i].Name != name {
+			t.Errorf("File %d: expected %v, got %v", i, name, files[i].Name)
+		}
+	}
+	if !files[2].AsOf.Equal(undated.ModTime) {
+		t.Errorf("Expected an undated catalog to use its file time, got %v", files[2].AsOf)
+	}
+}
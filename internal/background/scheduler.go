@@ -0,0 +1,352 @@
+package background
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobCounts are whatever a job wants to report about a run, e.g. how many
+// events an import inserted.
+type JobCounts map[string]int
+
+// changed is whether a run reported doing anything.
+func (c JobCounts) changed() bool {
+	for _, count := range c {
+		if count != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type Job struct {
+	Name string
+	// How often to run, 0 to only run when triggered.
+	Interval time.Duration
+	// Local jobs run on every instance, e.g. refreshing an in-memory cache.
+	// Everything else takes a lock so only one instance runs it at a time.
+	// Local jobs run often, so only runs that fail or count something are
+	// recorded.
+	Local bool
+	Run   func(ctx context.Context) (JobCounts, error)
+}
+
+var ErrUnknownJob = errors.New("no such job")
+
+// ErrJobRunning means another instance holds the job's lock.
+var ErrJobRunning = errors.New("job is already running")
+
+// errRanRecently means another instance ran the job since this one decided
+// when to run it next.
+var errRanRecently = errors.New("job ran recently on another instance")
+
+// jobStore is where instances share their job runs and locks, the database
+// outside of tests.
+type jobStore interface {
+	// lock takes the job's lock across instances, returning a func to
+	// release it, or ErrJobRunning if another instance holds it.
+	lock(jobName string) (func(), error)
+	lastStart(jobName string) (time.Time, error)
+	startRun(jobName, instance string) (int64, error)
+	finishRun(id int64, counts JobCounts, runErr error) error
+	// recordRun records a run that already finished.
+	recordRun(jobName, instance string, startedAt time.Time, counts JobCounts, runErr error) error
+}
+
+// Scheduler runs registered jobs on their intervals, or on demand. Runs of
+// the same job never overlap, on this instance or across instances, and
+// every instance keeps to the schedule of the last run on any of them, so
+// a job runs once an interval however many instances there are.
+type Scheduler struct {
+	store    jobStore
+	instance string
+
+	mu       sync.Mutex
+	jobs     map[string]*Job          // guarded by mu
+	triggers map[string]chan struct{} // guarded by mu
+	started  bool                     // guarded by mu
+}
+
+func NewScheduler(db *sql.DB) *Scheduler {
+	return newScheduler(&dbJobStore{db: db}, instanceName())
+}
+
+func newScheduler(store jobStore, instance string) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		instance: instance,
+		jobs:     make(map[string]*Job),
+		triggers: make(map[string]chan struct{}),
+	}
+}
+
+// Heroku names each dyno, elsewhere the host will do.
+func instanceName() string {
+	if dyno := os.Getenv("DYNO"); dyno != "" {
+		return dyno
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// Register adds a job. Jobs must all be registered before Start.
+func (s *Scheduler) Register(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		log.Panicf("Registering job %v after the scheduler started", job.Name)
+	}
+	if _, found := s.jobs[job.Name]; found {
+		log.Panicf("Job %v registered twice", job.Name)
+	}
+	s.jobs[job.Name] = job
+	// Room for one pending trigger, more than that while it's running
+	// would just run it again for nothing.
+	s.triggers[job.Name] = make(chan struct{}, 1)
+}
+
+// Jobs lists the registered jobs, sorted by name.
+func (s *Scheduler) Jobs() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+	return jobs
+}
+
+// Start runs each job in its own goroutine, and doesn't block.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started = true
+	for name, job := range s.jobs {
+		go s.loop(job, s.triggers[name])
+	}
+}
+
+// Trigger asks for a job to run as soon as it isn't already running here.
+// If another instance is running it, this run is skipped.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	trigger, found := s.triggers[name]
+	s.mu.Unlock()
+	if !found {
+		return fmt.Errorf("%w: %v", ErrUnknownJob, name)
+	}
+	select {
+	case trigger <- struct{}{}:
+	default:
+		// Already pending
+	}
+	return nil
+}
+
+// nextRun picks up the schedule where the last run, on any instance, left
+// it, so restarting doesn't rerun everything and instances don't each run
+// the job once an interval.
+func (s *Scheduler) nextRun(job *Job) time.Time {
+	if job.Local {
+		return time.Now().Add(job.Interval)
+	}
+	lastStart, err := s.store.lastStart(job.Name)
+	if err != nil {
+		log.Printf("Unable to find the last run of %v, waiting an interval: %v", job.Name, err)
+		return time.Now().Add(job.Interval)
+	}
+	return lastStart.Add(job.Interval)
+}
+
+func (s *Scheduler) loop(job *Job, trigger chan struct{}) {
+	var next time.Time
+	if job.Interval > 0 {
+		// Local jobs start out empty, so they run straight away
+		next = time.Now()
+		if !job.Local {
+			next = s.nextRun(job)
+		}
+	}
+	for {
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if job.Interval > 0 {
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+		// Zero for triggered runs, which run however recently the job ran
+		var due time.Time
+		select {
+		case <-timerC:
+			due = next
+		case <-trigger:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+
+		err := s.run(job, due)
+		if errors.Is(err, ErrJobRunning) {
+			log.Printf("Skipping %v, another instance is running it", job.Name)
+		} else if errors.Is(err, errRanRecently) {
+			log.Printf("Skipping %v, another instance ran it since it was due", job.Name)
+		} else if err != nil {
+			log.Printf("Job %v failed: %v", job.Name, err)
+		}
+		if job.Interval > 0 {
+			next = s.nextRun(job)
+			// The run may not have been recorded, don't retry straight away
+			if !next.After(time.Now()) {
+				next = time.Now().Add(job.Interval)
+			}
+		}
+	}
+}
+
+// run runs a job that was due at the given time, or was triggered if that's
+// zero. A due run is skipped if another instance ran the job after the run
+// it was scheduled from, checked under the lock so the two can't both start.
+func (s *Scheduler) run(job *Job, due time.Time) error {
+	release, err := s.lock(job)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if !due.IsZero() && !job.Local {
+		lastStart, err := s.store.lastStart(job.Name)
+		if err != nil {
+			return err
+		}
+		if lastStart.Add(job.Interval).After(due) {
+			return errRanRecently
+		}
+	}
+	return s.execute(job)
+}
+
+// RunOnce starts a one off run of a job, e.g. an import from an uploaded
+// file, under the same lock as the registered job with that name. Returns
+// ErrJobRunning right away if the job is already running, otherwise runs in
+// the background.
+func (s *Scheduler) RunOnce(job *Job) error {
+	release, err := s.lock(job)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer release()
+		if err := s.execute(job); err != nil {
+			log.Printf("Job %v failed: %v", job.Name, err)
+		}
+	}()
+	return nil
+}
+
+// lock takes the job's lock, returning a func to release it. Local jobs
+// only need the loop running them to not overlap.
+func (s *Scheduler) lock(job *Job) (func(), error) {
+	if job.Local {
+		return func() {}, nil
+	}
+	return s.store.lock(job.Name)
+}
+
+func (s *Scheduler) execute(job *Job) error {
+	if job.Local {
+		return s.executeLocal(job)
+	}
+	runId, err := s.store.startRun(job.Name, s.instance)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting job %v", job.Name)
+	counts, runErr := runJob(context.Background(), job)
+	if err = s.store.finishRun(runId, counts, runErr); err != nil {
+		log.Printf("Unable to record the end of %v: %v", job.Name, err)
+	}
+	log.Printf("Finished job %v: %v", job.Name, counts)
+	return runErr
+}
+
+// executeLocal runs a local job, only recording the run if it failed or did
+// something, so runs that find nothing to do don't bury the rest.
+func (s *Scheduler) executeLocal(job *Job) error {
+	started := time.Now()
+	counts, runErr := runJob(context.Background(), job)
+	if runErr != nil || counts.changed() {
+		if err := s.store.recordRun(job.Name, s.instance, started, counts, runErr); err != nil {
+			log.Printf("Unable to record the run of %v: %v", job.Name, err)
+		}
+		log.Printf("Finished job %v: %v", job.Name, counts)
+	}
+	return runErr
+}
+
+// runJob turns a panic into an error, so a bad job doesn't take down the web
+// server running it.
+func runJob(ctx context.Context, job *Job) (counts JobCounts, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// dbJobStore shares runs in the job_runs table, and locks with advisory
+// locks.
+type dbJobStore struct {
+	db *sql.DB
+}
+
+// Advisory locks belong to a connection, so the lock is held on its own conn
+// until it's released.
+func (d *dbJobStore) lock(jobName string) (func(), error) {
+	ctx := context.Background()
+	conn, err := d.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := postgres.TryJobLock(ctx, conn, jobName)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrJobRunning
+	}
+	return func() {
+		if err := postgres.ReleaseJobLock(ctx, conn, jobName); err != nil {
+			log.Printf("Unable to release lock for %v: %v", jobName, err)
+		}
+		conn.Close()
+	}, nil
+}
+
+func (d *dbJobStore) lastStart(jobName string) (time.Time, error) {
+	return postgres.LastJobStart(d.db, jobName)
+}
+
+func (d *dbJobStore) startRun(jobName, instance string) (int64, error) {
+	return postgres.StartJobRun(d.db, jobName, instance)
+}
+
+func (d *dbJobStore) finishRun(id int64, counts JobCounts, runErr error) error {
+	return postgres.FinishJobRun(d.db, id, counts, runErr)
+}
+
+func (d *dbJobStore) recordRun(jobName, instance string, startedAt time.Time, counts JobCounts, runErr error) error {
+	return postgres.RecordJobRun(d.db, jobName, instance, startedAt, counts, runErr)
+}
@@ -0,0 +1,172 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryJobStore is a database shared by schedulers standing in for
+// instances.
+type memoryJobStore struct {
+	mu     sync.Mutex
+	locked map[string]bool
+	starts map[string][]time.Time
+	runs   map[int64]string
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{
+		locked: make(map[string]bool),
+		starts: make(map[string][]time.Time),
+		runs:   make(map[int64]string),
+	}
+}
+
+func (m *memoryJobStore) lock(jobName string) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked[jobName] {
+		return nil, ErrJobRunning
+	}
+	m.locked[jobName] = true
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.locked, jobName)
+	}, nil
+}
+
+func (m *memoryJobStore) lastStart(jobName string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	starts := m.starts[jobName]
+	if len(starts) == 0 {
+		return time.Time{}, nil
+	}
+	return starts[len(starts)-1], nil
+}
+
+func (m *memoryJobStore) startRun(jobName, instance string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.starts[jobName] = append(m.starts[jobName], time.Now())
+	id := int64(len(m.runs) + 1)
+	m.runs[id] = instance
+	return id, nil
+}
+
+func (m *memoryJobStore) finishRun(id int64, counts JobCounts, runErr error) error {
+	return nil
+}
+
+func (m *memoryJobStore) recordRun(jobName, instance string, startedAt time.Time, counts JobCounts, runErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.starts[jobName] = append(m.starts[jobName], startedAt)
+	m.runs[int64(len(m.runs)+1)] = instance
+	return nil
+}
+
+func TestSchedulersShareSchedule(t *testing.T) {
+	store := newMemoryJobStore()
+	first := newScheduler(store, "web.1")
+	second := newScheduler(store, "web.2")
+	runs := 0
+	job := &Job{
+		Name:     GenconImportJob,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			runs++
+			return nil, nil
+		},
+	}
+
+	// Never run, so both are due now
+	firstDue, secondDue := first.nextRun(job), second.nextRun(job)
+	if firstDue.After(time.Now()) || !firstDue.Equal(secondDue) {
+		t.Fatalf("Expected both due now, got %v and %v", firstDue, secondDue)
+	}
+	if err := first.run(job, firstDue); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := second.run(job, secondDue); !errors.Is(err, errRanRecently) {
+		t.Errorf("Expected the second instance to skip the run the first made, got %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("Expected one run, got %d", runs)
+	}
+
+	// Both wait for the first instance's run, not their own clocks
+	lastStart, _ := store.lastStart(job.Name)
+	for _, scheduler := range []*Scheduler{first, second} {
+		if next := scheduler.nextRun(job); !next.Equal(lastStart.Add(job.Interval)) {
+			t.Errorf("Expected %v to run next at %v, got %v", scheduler.instance, lastStart.Add(job.Interval), next)
+		}
+	}
+
+	// Triggering runs it whenever it last ran
+	if err := second.run(job, time.Time{}); err != nil || runs != 2 {
+		t.Errorf("Expected a triggered run, got %v after %d runs", err, runs)
+	}
+	if next := first.nextRun(job); !next.After(lastStart.Add(job.Interval)) {
+		t.Errorf("Expected the triggered run to push back the next, got %v", next)
+	}
+}
+
+func TestSchedulerSkipsLockedJob(t *testing.T) {
+	store := newMemoryJobStore()
+	scheduler := newScheduler(store, "web.1")
+	job := &Job{
+		Name:     BggCrawlJob,
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			t.Errorf("Expected the run to be skipped")
+			return nil, nil
+		},
+	}
+
+	release, _ := store.lock(job.Name)
+	defer release()
+	if err := scheduler.run(job, time.Time{}); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("Expected the job to be running elsewhere, got %v", err)
+	}
+}
+
+func TestLocalJobsOnlyRecordChanges(t *testing.T) {
+	store := newMemoryJobStore()
+	scheduler := newScheduler(store, "web.1")
+	var counts JobCounts
+	var runErr error
+	job := &Job{
+		Name:     SuggestIndexJob,
+		Interval: time.Minute,
+		Local:    true,
+		Run: func(ctx context.Context) (JobCounts, error) {
+			return counts, runErr
+		},
+	}
+
+	tests := []struct {
+		counts   JobCounts
+		err      error
+		recorded bool
+	}{
+		{nil, nil, false},
+		{JobCounts{"rebuilt": 0}, nil, false},
+		{JobCounts{"rebuilt": 1}, nil, true},
+		{nil, errors.New("no database"), true},
+	}
+	for _, test := range tests {
+		counts, runErr = test.counts, test.err
+		before := len(store.runs)
+		if err := scheduler.run(job, time.Now()); err != test.err {
+			t.Errorf("Expected %v running with %v, got %v", test.err, test.counts, err)
+		}
+		if recorded := len(store.runs) > before; recorded != test.recorded {
+			t.Errorf("Expected recorded %v for %v %v, got %v", test.recorded, test.counts, test.err, recorded)
+		}
+	}
+}
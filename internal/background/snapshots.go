@@ -0,0 +1,226 @@
+package background
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+var snapshotDir = flag.String("snapshot_dir", "snapshots", "directory raw catalog downloads are archived in")
+
+var catalogClient = &http.Client{Timeout: 5 * time.Minute}
+
+const (
+	// The full catalog is a few megabytes. Anything near these is an error
+	// page or something else that isn't the catalog.
+	minCatalogBytes = 1 << 10
+	maxCatalogBytes = 100 << 20
+)
+
+// What Gen Con serves the catalog as, or could reasonably switch to.
+var catalogContentTypes = map[string]string{
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+	"application/octet-stream": ".xlsx",
+	"application/zip":          ".xlsx",
+	"text/csv":                 ".csv",
+}
+
+// SnapshotStore keeps raw catalog downloads. Reads are plain io/fs, so an
+// archive can be read back from a directory, a zip or anything else that
+// implements it.
+type SnapshotStore interface {
+	fs.FS
+	// Write stores data under name, a slash separated path.
+	Write(name string, data []byte) error
+}
+
+// DirSnapshotStore is a SnapshotStore on local disk.
+type DirSnapshotStore struct {
+	fs.FS
+	dir string
+}
+
+func NewDirSnapshotStore(dir string) *DirSnapshotStore {
+	return &DirSnapshotStore{FS: os.DirFS(dir), dir: dir}
+}
+
+// Write goes through a temp file, so a crash partway through never leaves a
+// truncated snapshot under the real name.
+func (s *DirSnapshotStore) Write(name string, data []byte) error {
+	target := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(target), ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), target)
+}
+
+// snapshotPath names a snapshot by its contents, fanned out by the first
+// byte of the hash to keep directories small.
+func snapshotPath(hash, ext string) string {
+	return path.Join(hash[:2], hash+ext)
+}
+
+// catalogDownload is the result of fetching the catalog. When NotModified
+// is set, the server said it's unchanged since the previous snapshot and
+// nothing else is filled in.
+type catalogDownload struct {
+	NotModified  bool
+	Data         []byte
+	Sha256       string
+	Ext          string
+	ContentType  string
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+}
+
+// fetchCatalog downloads the catalog, conditional on it having changed since
+// previous if there is one, and checks that what came back looks like one.
+func fetchCatalog(client *http.Client, sourceUrl string, previous *postgres.Snapshot) (*catalogDownload, error) {
+	req, err := http.NewRequest(http.MethodGet, sourceUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && previous != nil {
+		return &catalogDownload{NotModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType := "application/octet-stream"
+	if contentType != "" {
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("bad content type %q: %w", contentType, err)
+		}
+	}
+	ext, found := catalogContentTypes[mediaType]
+	if !found {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+
+	if resp.ContentLength > maxCatalogBytes {
+		return nil, fmt.Errorf("catalog is %d bytes, more than the %d limit", resp.ContentLength, maxCatalogBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCatalogBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCatalogBytes {
+		return nil, fmt.Errorf("catalog is more than the %d byte limit", maxCatalogBytes)
+	}
+	if len(data) < minCatalogBytes {
+		return nil, fmt.Errorf("catalog is only %d bytes", len(data))
+	}
+
+	hash := sha256.Sum256(data)
+	return &catalogDownload{
+		Data:         data,
+		Sha256:       hex.EncodeToString(hash[:]),
+		Ext:          ext,
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}, nil
+}
+
+// archiveCatalog writes a download to the store, unless an identical one is
+// already there, and records it in the db.
+func archiveCatalog(db *sql.DB, store SnapshotStore, sourceUrl string, download *catalogDownload) (*postgres.Snapshot, error) {
+	snapshot := &postgres.Snapshot{
+		SourceUrl:    sourceUrl,
+		Sha256:       download.Sha256,
+		Path:         snapshotPath(download.Sha256, download.Ext),
+		Size:         int64(len(download.Data)),
+		ContentType:  download.ContentType,
+		ETag:         download.ETag,
+		LastModified: download.LastModified,
+		FetchedAt:    download.FetchedAt,
+	}
+	_, err := fs.Stat(store, snapshot.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = store.Write(snapshot.Path, download.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = postgres.AddSnapshot(db, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (d *catalogDownload) parse() ([]*events.GenconEvent, []events.RowError, error) {
+	if d.Ext == ".csv" {
+		return events.ParseGenconCsv(d.Data)
+	}
+	return events.ParseGenconSheet(d.Data)
+}
+
+// downloadCatalog fetches and archives the catalog from a url, returning a
+// nil download if it hasn't changed since the last import. Archiving is for
+// replays and audits later, so failing to archive doesn't stop the import.
+func downloadCatalog(db *sql.DB, sourceUrl string) (*catalogDownload, *postgres.Snapshot, error) {
+	previous, err := postgres.LatestImportedSnapshot(db, sourceUrl)
+	if err != nil {
+		log.Printf("Unable to load the last snapshot of %v, fetching it regardless: %v", sourceUrl, err)
+		previous = nil
+	}
+	download, err := fetchCatalog(catalogClient, sourceUrl, previous)
+	if err != nil {
+		return nil, nil, err
+	}
+	if download.NotModified || (previous != nil && previous.Sha256 == download.Sha256) {
+		return nil, nil, nil
+	}
+
+	snapshot, err := archiveCatalog(db, NewDirSnapshotStore(*snapshotDir), sourceUrl, download)
+	if err != nil {
+		log.Printf("Unable to archive %v, importing anyway: %v", sourceUrl, err)
+	}
+	return download, snapshot, nil
+}
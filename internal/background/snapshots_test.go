@@ -0,0 +1,111 @@
+package background
+
+import (
+	"bytes"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testETag = `"v1"`
+const testLastModified = "Wed, 02 Aug 2023 10:00:00 GMT"
+
+func catalogServer(contentType string, body []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == testETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", testLastModified)
+		w.Write(body)
+	}))
+}
+
+func TestFetchCatalog(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), minCatalogBytes)
+	server := catalogServer("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", body)
+	defer server.Close()
+
+	download, err := fetchCatalog(server.Client(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if download.NotModified || !bytes.Equal(download.Data, body) || download.Ext != ".xlsx" {
+		t.Fatalf("Unexpected download %+v", download)
+	}
+	if download.ETag != testETag || download.LastModified != testLastModified || len(download.Sha256) != 64 {
+		t.Errorf("Unexpected metadata %+v", download)
+	}
+
+	previous := &postgres.Snapshot{ETag: download.ETag, LastModified: download.LastModified}
+	download, err = fetchCatalog(server.Client(), server.URL, previous)
+	if err != nil || !download.NotModified {
+		t.Errorf("Expected not modified, got %+v %v", download, err)
+	}
+}
+
+func TestFetchCatalogRejects(t *testing.T) {
+	catalog := bytes.Repeat([]byte("x"), minCatalogBytes)
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        []byte
+		expected    string
+	}{
+		{"error status", http.StatusServiceUnavailable, "text/html", catalog, "unexpected status"},
+		{"error page", http.StatusOK, "text/html; charset=utf-8", catalog, "unexpected content type"},
+		{"truncated", http.StatusOK, "application/octet-stream", catalog[:10], "only 10 bytes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(test.status)
+				w.Write(test.body)
+			}))
+			defer server.Close()
+
+			_, err := fetchCatalog(server.Client(), server.URL, nil)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestFetchCatalogCsv(t *testing.T) {
+	server := catalogServer("text/csv", bytes.Repeat([]byte("x,"), minCatalogBytes))
+	defer server.Close()
+
+	download, err := fetchCatalog(server.Client(), server.URL, nil)
+	if err != nil || download.Ext != ".csv" {
+		t.Errorf("Expected a csv download, got %+v %v", download, err)
+	}
+}
+
+func TestDirSnapshotStore(t *testing.T) {
+	store := NewDirSnapshotStore(t.TempDir())
+	hash := strings.Repeat("ab", 32)
+	name := snapshotPath(hash, ".xlsx")
+	if name != "ab/"+hash+".xlsx" {
+		t.Errorf("Unexpected path %v", name)
+	}
+
+	if err := store.Write(name, []byte("catalog")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := fs.ReadFile(store, name)
+	if err != nil || string(data) != "catalog" {
+		t.Errorf("Expected to read back the snapshot, got %q %v", data, err)
+	}
+	entries, err := fs.ReadDir(store, "ab")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the snapshot, no temp files, got %v %v", entries, err)
+	}
+}
@@ -0,0 +1,292 @@
+package background
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The kinds of things the search box completes to
+const (
+	SuggestTitle     = "title"
+	SuggestSystem    = "system"
+	SuggestOrganizer = "organizer"
+	SuggestEvent     = "event"
+)
+
+// Suggestion is a completion for what's been typed in the search box.
+type Suggestion struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+	// The event title, for event ids
+	Detail string `json:"detail,omitempty"`
+	// How many events it would find
+	Events int    `json:"events"`
+	Url    string `json:"url"`
+	// Only for game systems BGG knows
+	BggRating float64 `json:"bgg_rating,omitempty"`
+	// Every name of an organizer
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type suggestEntry struct {
+	Suggestion
+	// More events weigh more. Event ids weigh less than anything else can
+	// score, so they only show when nothing else matches.
+	weight float64
+}
+
+// suggestKey is where an entry can be found by prefix, the entry's
+// normalized text from the start of one of its words.
+type suggestKey struct {
+	key   string
+	entry *suggestEntry
+	// Whether key is the whole text
+	whole bool
+}
+
+type suggestYear struct {
+	keys []suggestKey // sorted by key
+}
+
+// SuggestIndex completes searches from memory, so each keystroke doesn't
+// query events. Refresh reloads it when the catalog changes.
+type SuggestIndex struct {
+	db    *sql.DB    // threadsafe, not guarded by mutex
+	games *GameCache // threadsafe, not guarded by mutex
+
+	mu      sync.RWMutex
+	version string               // guarded by mu
+	years   map[int]*suggestYear // guarded by mu
+}
+
+func NewSuggestIndex(db *sql.DB, games *GameCache) *SuggestIndex {
+	return &SuggestIndex{
+		db:    db,
+		games: games,
+		years: make(map[int]*suggestYear),
+	}
+}
+
+// normalizeSuggest lower cases text and separates its words with single
+// spaces, dropping everything but letters and digits.
+func normalizeSuggest(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// addKeys makes an entry findable by its text, or any of names, from the
+// start of each of their words.
+func (y *suggestYear) addKeys(entry *suggestEntry, names ...string) {
+	for _, name := range names {
+		normalized := normalizeSuggest(name)
+		for i := 0; i < len(normalized); i++ {
+			if i == 0 || normalized[i-1] == ' ' {
+				y.keys = append(y.keys, suggestKey{key: normalized[i:], entry: entry, whole: i == 0})
+			}
+		}
+	}
+}
+
+func searchUrl(year int, params url.Values) string {
+	params.Set("year", fmt.Sprint(year))
+	return "/search?" + params.Encode()
+}
+
+// quoteTerm is a search term for a field, quoted so spaces don't split it.
+// The grammar has no escape for quotes, so they're dropped.
+func quoteTerm(field, value string) string {
+	return fmt.Sprintf(`%v:"%v"`, field, strings.ReplaceAll(value, `"`, ""))
+}
+
+func countWeight(events int) float64 {
+	return math.Log10(1 + float64(events))
+}
+
+// buildSuggestYears indexes the titles, game systems, organizers and ids of
+// the events for each year.
+func buildSuggestYears(events []*postgres.SuggestEvent, orgAliases map[int64][]string) map[int]*suggestYear {
+	type groupKey struct {
+		year int
+		kind string
+		text string
+	}
+	groups := make(map[groupKey]*suggestEntry)
+	group := func(key groupKey, newEntry func() *suggestEntry) {
+		entry, found := groups[key]
+		if !found {
+			entry = newEntry()
+			groups[key] = entry
+		}
+		entry.Events++
+	}
+
+	years := make(map[int]*suggestYear)
+	for _, event := range events {
+		year := years[event.Year]
+		if year == nil {
+			year = &suggestYear{}
+			years[event.Year] = year
+		}
+
+		if event.Title != "" {
+			group(groupKey{event.Year, SuggestTitle, event.Title}, func() *suggestEntry {
+				return &suggestEntry{Suggestion: Suggestion{
+					Type: SuggestTitle,
+					Text: event.Title,
+					Url:  searchUrl(event.Year, url.Values{"q": {quoteTerm("title", event.Title)}}),
+				}}
+			})
+		}
+		if event.GameSystem != "" {
+			group(groupKey{event.Year, SuggestSystem, event.GameSystem}, func() *suggestEntry {
+				return &suggestEntry{Suggestion: Suggestion{
+					Type: SuggestSystem,
+					Text: event.GameSystem,
+					Url:  searchUrl(event.Year, url.Values{"q": {quoteTerm("system", event.GameSystem)}}),
+				}}
+			})
+		}
+		if event.OrgId != 0 {
+			orgId := fmt.Sprint(event.OrgId)
+			group(groupKey{event.Year, SuggestOrganizer, orgId}, func() *suggestEntry {
+				return &suggestEntry{Suggestion: Suggestion{
+					Type:    SuggestOrganizer,
+					Text:    event.OrgGroup,
+					Url:     searchUrl(event.Year, url.Values{"org_id": {orgId}}),
+					Aliases: orgAliases[event.OrgId],
+				}}
+			})
+		}
+
+		entry := &suggestEntry{
+			Suggestion: Suggestion{
+				Type:   SuggestEvent,
+				Text:   event.EventId,
+				Detail: event.Title,
+				Events: 1,
+				Url:    "/event/" + url.PathEscape(event.EventId),
+			},
+			weight: -3,
+		}
+		year.addKeys(entry, event.EventId)
+	}
+
+	for key, entry := range groups {
+		entry.weight = countWeight(entry.Events)
+		names := []string{entry.Text}
+		if entry.Type == SuggestOrganizer {
+			names = append(names, entry.Aliases...)
+		}
+		years[key.year].addKeys(entry, names...)
+	}
+	for _, year := range years {
+		sort.Slice(year.keys, func(i, j int) bool {
+			return year.keys[i].key < year.keys[j].key
+		})
+	}
+	return years
+}
+
+// Refresh rebuilds the index if the catalog changed since it was built.
+func (idx *SuggestIndex) Refresh() (JobCounts, error) {
+	version, err := postgres.CatalogVersion(idx.db)
+	if err != nil {
+		return nil, err
+	}
+	idx.mu.RLock()
+	current := idx.version
+	idx.mu.RUnlock()
+	if version == current {
+		return JobCounts{"rebuilt": 0}, nil
+	}
+
+	events, err := postgres.LoadSuggestEvents(idx.db)
+	if err != nil {
+		return nil, err
+	}
+	orgAliases, err := postgres.LoadOrgAliases(idx.db)
+	if err != nil {
+		return nil, err
+	}
+	years := buildSuggestYears(events, orgAliases)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.version = version
+	idx.years = years
+	return JobCounts{"rebuilt": 1, "events": len(events)}, nil
+}
+
+// Suggest finds up to limit completions of query among the year's events,
+// best first. Text starting with the query ranks above text with a later
+// word starting with it, and either ranks higher the more events it finds.
+func (idx *SuggestIndex) Suggest(year int, query string, limit int) []*Suggestion {
+	prefix := normalizeSuggest(query)
+	suggestions := make([]*Suggestion, 0, limit)
+	if prefix == "" || limit <= 0 {
+		return suggestions
+	}
+
+	idx.mu.RLock()
+	index := idx.years[year]
+	idx.mu.RUnlock()
+	if index == nil {
+		return suggestions
+	}
+
+	scores := make(map[*suggestEntry]float64)
+	start := sort.Search(len(index.keys), func(i int) bool {
+		return index.keys[i].key >= prefix
+	})
+	for _, key := range index.keys[start:] {
+		if !strings.HasPrefix(key.key, prefix) {
+			break
+		}
+		score := key.entry.weight
+		if key.whole {
+			score += 2
+			if key.key == prefix {
+				score += 2
+			}
+		}
+		if best, found := scores[key.entry]; !found || score > best {
+			scores[key.entry] = score
+		}
+	}
+
+	entries := make([]*suggestEntry, 0, len(scores))
+	for entry := range scores {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if scores[entries[i]] != scores[entries[j]] {
+			return scores[entries[i]] > scores[entries[j]]
+		}
+		if entries[i].Text != entries[j].Text {
+			return entries[i].Text < entries[j].Text
+		}
+		return entries[i].Type < entries[j].Type
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	for _, entry := range entries {
+		suggestion := entry.Suggestion
+		if suggestion.Type == SuggestSystem && idx.games != nil {
+			if game := idx.games.FindGame(suggestion.Text); game != nil {
+				suggestion.BggRating = math.Round(game.AvgRatings*10) / 10
+			}
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	return suggestions
+}
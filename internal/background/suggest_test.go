@@ -0,0 +1,107 @@
+package background
+
+import (
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"strings"
+	"testing"
+)
+
+func testSuggestIndex() *SuggestIndex {
+	var events []*postgres.SuggestEvent
+	add := func(year, count int, title, system, org string, orgId int64) {
+		for i := 0; i < count; i++ {
+			events = append(events, &postgres.SuggestEvent{
+				Year:       year,
+				EventId:    fmt.Sprintf("BGM%02dND%05d", year%100, len(events)),
+				Title:      title,
+				GameSystem: system,
+				OrgGroup:   org,
+				OrgId:      orgId,
+			})
+		}
+	}
+	add(2023, 30, "Gloomhaven: Jaws of the Lion", "Gloomhaven", "Cephalofair Games", 7)
+	add(2023, 2, "Learn to Play Glory to Rome", "Glory to Rome", "Rome Fans", 8)
+	add(2023, 5, "Carcassonne Tournament", "Carcassonne", "Z-Man", 9)
+	add(2022, 4, "Gloomy Old Event", "Gloom", "", 0)
+
+	index := NewSuggestIndex(nil, nil)
+	index.years = buildSuggestYears(events, map[int64][]string{
+		7: {"Cephalofair", "Cephalofair Games"},
+		9: {"Z-Man", "ZMan Games"},
+	})
+	return index
+}
+
+func suggestionTexts(suggestions []*Suggestion) string {
+	texts := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		texts[i] = suggestion.Type + ":" + suggestion.Text
+	}
+	return strings.Join(texts, ", ")
+}
+
+func TestSuggest(t *testing.T) {
+	index := testSuggestIndex()
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		// More events rank higher, and the other year's gloom isn't there
+		{"glo", "system:Gloomhaven, title:Gloomhaven: Jaws of the Lion, system:Glory to Rome"},
+		// Matches of later words come after
+		{"GLORY to", "system:Glory to Rome, title:Learn to Play Glory to Rome"},
+		{"rome", "organizer:Rome Fans, system:Glory to Rome, title:Learn to Play Glory to Rome"},
+		{"jaws", "title:Gloomhaven: Jaws of the Lion"},
+		// Organizers are found by any alias
+		{"zman", "organizer:Z-Man"},
+		// Event ids only show when nothing else matches
+		{"bgm23nd0003", "event:BGM23ND00030, event:BGM23ND00031, event:BGM23ND00032"},
+		{"", ""},
+		{"  :: ", ""},
+		{"nothing like it", ""},
+	}
+	for _, test := range tests {
+		actual := suggestionTexts(index.Suggest(2023, test.query, 3))
+		if actual != test.expected {
+			t.Errorf("Suggest(%q) = %v, expected %v", test.query, actual, test.expected)
+		}
+	}
+
+	if suggestions := index.Suggest(2022, "gloom", 10); suggestionTexts(suggestions) != "system:Gloom, title:Gloomy Old Event" {
+		t.Errorf("Unexpected 2022 suggestions %v", suggestionTexts(suggestions))
+	}
+	if suggestions := index.Suggest(2019, "gloom", 10); len(suggestions) != 0 {
+		t.Errorf("Expected nothing for a year without events, got %v", suggestionTexts(suggestions))
+	}
+}
+
+func TestSuggestDetails(t *testing.T) {
+	index := testSuggestIndex()
+
+	suggestions := index.Suggest(2023, "cephalofair", 1)
+	if len(suggestions) != 1 {
+		t.Fatalf("Expected an organizer, got %v", suggestionTexts(suggestions))
+	}
+	org := suggestions[0]
+	if org.Events != 30 || org.Url != "/search?org_id=7&year=2023" || len(org.Aliases) != 2 {
+		t.Errorf("Unexpected organizer %+v", org)
+	}
+
+	suggestions = index.Suggest(2023, "carcassonne", 1)
+	if len(suggestions) != 1 || suggestions[0].Url != "/search?q=system%3A%22Carcassonne%22&year=2023" {
+		t.Errorf("Unexpected system %+v", suggestions[0])
+	}
+
+	suggestions = index.Suggest(2023, "BGM23ND00000", 1)
+	if len(suggestions) != 1 || suggestions[0].Url != "/event/BGM23ND00000" || suggestions[0].Detail != "Gloomhaven: Jaws of the Lion" {
+		t.Errorf("Unexpected event %+v", suggestions[0])
+	}
+}
+
+func TestQuoteTerm(t *testing.T) {
+	if term := quoteTerm("title", `The "Best" Game`); term != `title:"The Best Game"` {
+		t.Errorf("Unexpected term %v", term)
+	}
+}
@@ -2,75 +2,236 @@ package background
 
 import (
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/Encinarus/genconplanner/internal/events"
 	"github.com/Encinarus/genconplanner/internal/postgres"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"os"
 	"strings"
+	"time"
 )
 
-func parseHttp(sourceFile string) []*events.GenconEvent {
-	resp, err := http.Get(sourceFile)
-	if err != nil {
-		panic(err)
+// Past this many, we just log a count. A catalog with that many bad rows
+// has bigger problems than any individual row.
+const maxReportedRowErrors = 50
+
+var maxDeactivatedPercent = flag.Float64("max_deactivated_percent", 10,
+	"abort an import that would deactivate more than this percent of a year's active events, 0 for no limit")
+var maxDropPercent = flag.Float64("max_drop_percent", 25,
+	"abort an import with this percent fewer events than a year has active, 0 for no limit")
+
+// ImportLimits are the limits imports are held to, from the flags, or none
+// when forced.
+func ImportLimits(force bool) *events.DeactivationLimits {
+	if force {
+		return nil
+	}
+	return &events.DeactivationLimits{
+		MaxDeactivatedPercent: *maxDeactivatedPercent,
+		MaxDropPercent:        *maxDropPercent,
 	}
-	defer resp.Body.Close()
-	spreadsheetBytes, err := ioutil.ReadAll(resp.Body)
-	return events.ParseGenconSheet(spreadsheetBytes)
 }
 
-func parseSheet(sourceFile string) []*events.GenconEvent {
-	fileReader, err := os.Open(sourceFile)
+func parseSheet(sourceFile string) ([]*events.GenconEvent, []events.RowError, error) {
+	fileBytes, err := ioutil.ReadFile(sourceFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events.ParseGenconSheet(fileBytes)
+}
 
+func parseCsv(sourceFile string) ([]*events.GenconEvent, []events.RowError, error) {
+	fileBytes, err := ioutil.ReadFile(sourceFile)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	defer fileReader.Close()
-	fileBytes, err := ioutil.ReadAll(fileReader)
+	return events.ParseGenconCsv(fileBytes)
+}
 
-	return events.ParseGenconSheet(fileBytes)
+// parseSource parses a catalog from a url or file, without the conditional
+// fetch and archiving an import from a url does.
+func parseSource(sourceFile string) ([]*events.GenconEvent, []events.RowError, error) {
+	if strings.HasPrefix(sourceFile, "http") {
+		download, err := fetchCatalog(catalogClient, sourceFile, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return download.parse()
+	} else if strings.HasSuffix(sourceFile, "xlsx") {
+		return parseSheet(sourceFile)
+	}
+	return parseCsv(sourceFile)
 }
 
-func parseCsv(sourceFile string) []*events.GenconEvent {
-	fileReader, err := os.Open(sourceFile)
+func reportRowErrors(sourceFile string, rowErrors []events.RowError) {
+	if len(rowErrors) == 0 {
+		return
+	}
+	log.Printf("Skipped %d bad rows from %v", len(rowErrors), sourceFile)
+	for i, rowErr := range rowErrors {
+		if i == maxReportedRowErrors {
+			log.Printf("  ... and %d more", len(rowErrors)-i)
+			break
+		}
+		log.Printf("  %v", rowErr)
+	}
+}
 
-	if err != nil {
-		panic(err)
+// countChanges tallies changes both by kind and by event, since one updated
+// event can have several kinds of change.
+func countChanges(changes []events.EventChange, counts JobCounts) {
+	updated := make(map[string]bool)
+	for _, change := range changes {
+		counts[string(change.Kind)]++
+		switch change.Kind {
+		case events.ChangeAdded:
+			counts["inserted"]++
+		case events.ChangeCancelled:
+			counts["deactivated"]++
+		default:
+			updated[change.EventId] = true
+		}
 	}
-	defer fileReader.Close()
-	fileBytes, err := ioutil.ReadAll(fileReader)
+	counts["updated"] = len(updated)
+}
 
-	return events.ParseGenconCsv(fileBytes)
+// applyRemapRules applies the rules added through the admin page since the
+// last deploy. The parsers already applied the built in rules.
+func applyRemapRules(db *sql.DB, parsedEvents []*events.GenconEvent) {
+	remapRules, err := postgres.LoadRemapRules(db)
+	if err != nil {
+		log.Printf("Unable to load system remaps, skipping them: %v", err)
+	}
+	for _, event := range parsedEvents {
+		remapRules.Apply(event)
+	}
 }
 
-func writeEvents(db *sql.DB, genconEvents []*events.GenconEvent) {
+// writeEvents imports events, counting it if the limits abort it. Recording
+// the abort is up to the caller, replays don't record catalogs again.
+func writeEvents(db *sql.DB, genconEvents []*events.GenconEvent, asOf time.Time,
+	limits *events.DeactivationLimits, counts JobCounts) ([]events.EventChange, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	err = postgres.BulkUpdateEvents(tx, genconEvents)
+	changes, err := postgres.BulkUpdateEvents(tx, genconEvents, asOf, limits)
 	if err != nil {
-		log.Fatal(err)
+		tx.Rollback()
+		var abortErr *events.DeactivationError
+		if errors.As(err, &abortErr) {
+			counts["aborted"]++
+		}
+		return nil, err
 	}
-	err = tx.Commit()
-	if err != nil {
-		log.Fatal(err)
+	if err = tx.Commit(); err != nil {
+		return nil, err
 	}
+	countChanges(changes, counts)
+	log.Printf("Changes found: %v", counts)
+	return changes, nil
 }
 
-func UpdateEventsFromGencon(db *sql.DB, sourceFile string) {
-	var events []*events.GenconEvent
+// UpdateEventsFromGencon imports a catalog from a url or file, returning how
+// many events were parsed and changed. See ImportLimits for the limits.
+func UpdateEventsFromGencon(db *sql.DB, sourceFile string, limits *events.DeactivationLimits) (JobCounts, error) {
+	var parsedEvents []*events.GenconEvent
+	var rowErrors []events.RowError
+	var err error
 	log.Printf("Loading events from %v", sourceFile)
 
+	var snapshot *postgres.Snapshot
 	if strings.HasPrefix(sourceFile, "http") {
-		events = parseHttp(sourceFile)
-	} else if strings.HasSuffix(sourceFile, "xlsx") {
-		events = parseSheet(sourceFile)
+		var download *catalogDownload
+		download, snapshot, err = downloadCatalog(db, sourceFile)
+		if err == nil && download == nil {
+			log.Printf("%v is unchanged since the last import", sourceFile)
+			return JobCounts{"unchanged": 1}, nil
+		}
+		if err == nil {
+			parsedEvents, rowErrors, err = download.parse()
+		}
 	} else {
-		events = parseCsv(sourceFile)
+		parsedEvents, rowErrors, err = parseSource(sourceFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", sourceFile, err)
+	}
+	reportRowErrors(sourceFile, rowErrors)
+	counts := JobCounts{
+		"parsed":     len(parsedEvents),
+		"row_errors": len(rowErrors),
 	}
 
-	writeEvents(db, events)
+	if len(parsedEvents) == 0 {
+		return counts, errors.New("no events parsed, not updating")
+	}
+
+	applyRemapRules(db, parsedEvents)
+	changes, err := writeEvents(db, parsedEvents, time.Now(), limits, counts)
+	if err != nil {
+		var abortErr *events.DeactivationError
+		if errors.As(err, &abortErr) {
+			if recordErr := postgres.RecordAbortedImport(db, sourceFile, abortErr); recordErr != nil {
+				log.Printf("Unable to record the aborted import: %v", recordErr)
+			}
+		}
+		return counts, err
+	}
+	if snapshot != nil {
+		if err = postgres.MarkSnapshotImported(db, snapshot.Id); err != nil {
+			log.Printf("Unable to mark snapshot %v imported: %v", snapshot.Id, err)
+		}
+	}
+
+	// The import already went through, so a problem alerting isn't an
+	// import failure.
+	if err = SendChangeAlerts(db, changes); err != nil {
+		log.Printf("Unable to send change alerts: %v", err)
+	}
+	return counts, nil
+}
+
+// DryRunUpdate works out what importing a catalog would change, without
+// changing anything. The import runs as usual, but in a transaction that's
+// rolled back. If the limits would abort it, the report says why, along with
+// what it would change if forced.
+func DryRunUpdate(db *sql.DB, sourceFile string, limits *events.DeactivationLimits) (*events.DiffReport, error) {
+	log.Printf("Loading events from %v", sourceFile)
+	parsedEvents, rowErrors, err := parseSource(sourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", sourceFile, err)
+	}
+	reportRowErrors(sourceFile, rowErrors)
+	if len(parsedEvents) == 0 {
+		return nil, errors.New("no events parsed")
+	}
+	applyRemapRules(db, parsedEvents)
+
+	changes, err := dryRunChanges(db, parsedEvents, limits)
+	var abortErr *events.DeactivationError
+	if !errors.As(err, &abortErr) {
+		if err != nil {
+			return nil, err
+		}
+		return events.NewDiffReport(changes), nil
+	}
+	changes, err = dryRunChanges(db, parsedEvents, nil)
+	if err != nil {
+		return nil, err
+	}
+	report := events.NewDiffReport(changes)
+	report.AbortReason = abortErr.Error()
+	return report, nil
+}
+
+func dryRunChanges(db *sql.DB, parsedEvents []*events.GenconEvent, limits *events.DeactivationLimits) ([]events.EventChange, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return postgres.BulkUpdateEvents(tx, parsedEvents, time.Now(), limits)
 }
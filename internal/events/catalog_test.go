@@ -0,0 +1,72 @@
+package events
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func loadFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// testdata/catalog.xlsx and testdata/catalog.csv hold the same catalog. The
+// xlsx has numbers as numeric cells and a mix of text and styled dates, the
+// way Gen Con's export does, while the csv has everything as text.
+func TestCsvMatchesXlsx(t *testing.T) {
+	fromXlsx, rowErrors, err := ParseGenconSheet(loadFixture(t, "catalog.xlsx"))
+	if err != nil || len(rowErrors) != 0 {
+		t.Fatalf("Unexpected errors parsing xlsx: %v %v", err, rowErrors)
+	}
+	fromCsv, rowErrors, err := ParseGenconCsv(loadFixture(t, "catalog.csv"))
+	if err != nil || len(rowErrors) != 0 {
+		t.Fatalf("Unexpected errors parsing csv: %v %v", err, rowErrors)
+	}
+
+	if len(fromXlsx) != 5 || len(fromCsv) != len(fromXlsx) {
+		t.Fatalf("Expected 5 events from each, got %d xlsx and %d csv", len(fromXlsx), len(fromCsv))
+	}
+	for i := range fromXlsx {
+		x := reflect.ValueOf(fromXlsx[i]).Elem()
+		c := reflect.ValueOf(fromCsv[i]).Elem()
+		for f := 0; f < x.NumField(); f++ {
+			xField, cField := x.Field(f).Interface(), c.Field(f).Interface()
+			if xTime, ok := xField.(time.Time); ok {
+				// Compare instants, locations are loaded separately per parse
+				if !xTime.Equal(cField.(time.Time)) {
+					t.Errorf("%v %v: xlsx %v, csv %v", fromXlsx[i].EventId, x.Type().Field(f).Name, xField, cField)
+				}
+			} else if !reflect.DeepEqual(xField, cField) {
+				t.Errorf("%v %v: xlsx %q, csv %q", fromXlsx[i].EventId, x.Type().Field(f).Name, xField, cField)
+			}
+		}
+	}
+
+	// Spot check that the shared handling actually ran
+	catan, delve, trueDungeon, scythe, seminar := fromCsv[0], fromCsv[1], fromCsv[2], fromCsv[3], fromCsv[4]
+	if catan.GameSystem != "The Settlers of Catan" {
+		t.Errorf("Expected game system to be normalized, got %q", catan.GameSystem)
+	}
+	if seminar.GameSystem != "1830" {
+		t.Errorf("Expected numeric game system to be kept, got %q", seminar.GameSystem)
+	}
+	if delve.RoomName != "Room 104" || scythe.RoomName != "Room 240" {
+		t.Errorf("Expected numeric rooms to be named, got %q and %q", delve.RoomName, scythe.RoomName)
+	}
+	if trueDungeon.TableNumber != "" || trueDungeon.MinPlayTime != 30 {
+		t.Errorf("Unexpected table %q, min play time %v", trueDungeon.TableNumber, trueDungeon.MinPlayTime)
+	}
+	expectedModified := time.Date(2015, time.July, 1, 10, 15, 0, 0, indianapolis())
+	if !catan.LastModified.Equal(expectedModified) {
+		t.Errorf("Expected last modified %v, got %v", expectedModified, catan.LastModified)
+	}
+	if !trueDungeon.LastModified.IsZero() {
+		t.Errorf("Expected blank last modified to be zero, got %v", trueDungeon.LastModified)
+	}
+}
@@ -0,0 +1,203 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// column is a logical field in the Gen Con catalog. Gen Con adds, drops and
+// reorders columns between years, so the parsers look columns up by header
+// name rather than by position.
+type column string
+
+const (
+	colEventId              column = "Game ID"
+	colGroup                column = "Group"
+	colTitle                column = "Title"
+	colShortDescription     column = "Short Description"
+	colLongDescription      column = "Long Description"
+	colEventType            column = "Event Type"
+	colGameSystem           column = "Game System"
+	colRulesEdition         column = "Rules Edition"
+	colMinPlayers           column = "Minimum Players"
+	colMaxPlayers           column = "Maximum Players"
+	colAgeRequired          column = "Age Required"
+	colExperienceRequired   column = "Experience Required"
+	colMaterialsProvided    column = "Materials Provided"
+	colStartTime            column = "Start Date & Time"
+	colDuration             column = "Duration"
+	colEndTime              column = "End Date & Time"
+	colGMNames              column = "GM Names"
+	colWebsite              column = "Website"
+	colEmail                column = "Email"
+	colTournament           column = "Tournament?"
+	colRoundNumber          column = "Round Number"
+	colTotalRounds          column = "Total Rounds"
+	colMinPlayTime          column = "Minimum Play Time"
+	colAttendeeRegistration column = "Attendee Registration?"
+	colCost                 column = "Cost $"
+	colLocation             column = "Location"
+	colRoomName             column = "Room Name"
+	colTableNumber          column = "Table Number"
+	colSpecialCategory      column = "Special Category"
+	colTicketsAvailable     column = "Tickets Available"
+	colLastModified         column = "Last Modified"
+)
+
+// Other names the same column has gone by in past catalogs. The canonical
+// name above is always accepted, these are checked in addition to it.
+var columnAliases = map[column][]string{
+	colEventId:              {"Event ID", "Game Id", "ID"},
+	colGroup:                {"Organizer", "Organizing Group", "Company"},
+	colMinPlayers:           {"Min Players"},
+	colMaxPlayers:           {"Max Players"},
+	colAgeRequired:          {"Age", "Age Requirement"},
+	colExperienceRequired:   {"Experience", "Experience Level"},
+	colStartTime:            {"Start Date and Time", "Start Time", "Start Date"},
+	colEndTime:              {"End Date and Time", "End Time", "End Date"},
+	colGMNames:              {"GMs", "GM Name", "Game Masters"},
+	colTournament:           {"Is Tournament"},
+	colMinPlayTime:          {"Min Play Time"},
+	colAttendeeRegistration: {"Registration"},
+	colCost:                 {"Event Cost", "Price"},
+	colTicketsAvailable:     {"Tickets", "Available Tickets"},
+	colLastModified:         {"Last Modified Date", "Last Updated"},
+}
+
+// Without these we can't build a meaningful event, so a catalog missing any
+// of them is rejected outright rather than imported with blank fields.
+var requiredColumns = []column{
+	colEventId,
+	colTitle,
+	colEventType,
+	colStartTime,
+	colDuration,
+}
+
+// normalizeHeader reduces a header to lowercase letters and digits, so that
+// "Tournament?", "tournament" and "Tournament " all compare equal.
+func normalizeHeader(header string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, header)
+}
+
+// columnMap records which position each known column was found at in a
+// catalog's header row.
+type columnMap map[column]int
+
+func newColumnMap(header []string) (columnMap, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		normalized := normalizeHeader(name)
+		if _, found := positions[normalized]; found || normalized == "" {
+			// First occurrence wins if the sheet repeats a header
+			continue
+		}
+		positions[normalized] = i
+	}
+
+	columns := make(columnMap)
+	for _, c := range allColumns() {
+		for _, name := range append([]string{string(c)}, columnAliases[c]...) {
+			if i, found := positions[normalizeHeader(name)]; found {
+				columns[c] = i
+				break
+			}
+		}
+	}
+
+	var missing []string
+	for _, c := range requiredColumns {
+		if _, found := columns[c]; !found {
+			missing = append(missing, string(c))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("catalog is missing required columns: %s",
+			strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+// index returns the position of c in the row, or -1 if the catalog doesn't
+// have that column.
+func (m columnMap) index(c column) int {
+	if i, found := m[c]; found {
+		return i
+	}
+	return -1
+}
+
+func allColumns() []column {
+	return []column{
+		colEventId,
+		colGroup,
+		colTitle,
+		colShortDescription,
+		colLongDescription,
+		colEventType,
+		colGameSystem,
+		colRulesEdition,
+		colMinPlayers,
+		colMaxPlayers,
+		colAgeRequired,
+		colExperienceRequired,
+		colMaterialsProvided,
+		colStartTime,
+		colDuration,
+		colEndTime,
+		colGMNames,
+		colWebsite,
+		colEmail,
+		colTournament,
+		colRoundNumber,
+		colTotalRounds,
+		colMinPlayTime,
+		colAttendeeRegistration,
+		colCost,
+		colLocation,
+		colRoomName,
+		colTableNumber,
+		colSpecialCategory,
+		colTicketsAvailable,
+		colLastModified,
+	}
+}
+
+// RowError describes a catalog row that couldn't be turned into an event.
+// The row is skipped, the rest of the catalog still imports.
+type RowError struct {
+	Row    int
+	Column string
+	Value  string
+	Err    error
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d, column %q, value %q: %v", e.Row, e.Column, e.Value, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// rowErrors tracks the first bad field while reading a row, so the field
+// accessors can be used inline and the row checked once at the end.
+type rowErrors struct {
+	rowNum int
+	err    *RowError
+}
+
+func (r *rowErrors) fail(c column, value string, err error) {
+	if r.err == nil {
+		r.err = &RowError{Row: r.rowNum, Column: string(c), Value: value, Err: err}
+	}
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColumnMapByName(t *testing.T) {
+	header := []string{"Title", "Game ID", "Event Type", "Duration", "Start Date & Time", "Tournament?", "Cost $"}
+
+	columns, err := newColumnMap(header)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if columns.index(colEventId) != 1 {
+		t.Errorf("Expected Game ID at 1, got %d", columns.index(colEventId))
+	}
+	if columns.index(colCost) != 6 {
+		t.Errorf("Expected Cost at 6, got %d", columns.index(colCost))
+	}
+	if columns.index(colRoomName) != -1 {
+		t.Errorf("Expected Room Name to be missing, got %d", columns.index(colRoomName))
+	}
+}
+
+func TestColumnMapAliases(t *testing.T) {
+	header := []string{"event id", "TITLE", "Event Type", "Start Date and Time", "Duration", "Min Players", "Tournament"}
+
+	columns, err := newColumnMap(header)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if columns.index(colEventId) != 0 {
+		t.Errorf("Expected event id alias at 0, got %d", columns.index(colEventId))
+	}
+	if columns.index(colStartTime) != 3 {
+		t.Errorf("Expected start time alias at 3, got %d", columns.index(colStartTime))
+	}
+	if columns.index(colMinPlayers) != 5 {
+		t.Errorf("Expected min players alias at 5, got %d", columns.index(colMinPlayers))
+	}
+	if columns.index(colTournament) != 6 {
+		t.Errorf("Expected tournament alias at 6, got %d", columns.index(colTournament))
+	}
+}
+
+func TestColumnMapMissingRequired(t *testing.T) {
+	header := []string{"Game ID", "Title", "Event Type"}
+
+	_, err := newColumnMap(header)
+	if err == nil {
+		t.Fatalf("Expected an error for missing columns")
+	}
+	if !strings.Contains(err.Error(), string(colStartTime)) ||
+		!strings.Contains(err.Error(), string(colDuration)) {
+		t.Errorf("Expected error to name the missing columns, got %v", err)
+	}
+}
+
+func TestCsvReordered(t *testing.T) {
+	csv := "Title,Duration,Game ID,Start Date & Time,Event Type,Tickets Available\n" +
+		"Some Game,2,BGM15001,07/30/2015 03:00 PM,BGM - Board Game,6\n"
+
+	parsed, rowErrors, err := ParseGenconCsv([]byte(csv))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("Unexpected row errors: %v", rowErrors)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(parsed))
+	}
+	e := parsed[0]
+	if e.EventId != "BGM15001" || e.Title != "Some Game" || e.Duration != 120 || e.TicketsAvailable != 6 {
+		t.Errorf("Fields mapped to the wrong columns: %+v", e)
+	}
+	if e.Year != 2015 || e.ShortCategory != "BGM" {
+		t.Errorf("Unexpected year/category %v %v", e.Year, e.ShortCategory)
+	}
+}
+
+func TestCellColumn(t *testing.T) {
+	cases := map[string]int{"A1": 0, "Z9": 25, "AA10": 26, "AF2": 31, "1": -1}
+	for ref, expected := range cases {
+		if got := cellColumn(ref); got != expected {
+			t.Errorf("cellColumn(%q) = %d, expected %d", ref, got, expected)
+		}
+	}
+}
+
+func TestCsvBadRows(t *testing.T) {
+	csv := "Game ID,Title,Event Type,Start Date & Time,Duration,Tickets Available\n" +
+		"BGM15001,Good,BGM - Board Game,07/30/2015 03:00 PM,2,6\n" +
+		"BGM15002,Bad Tickets,BGM - Board Game,07/30/2015 03:00 PM,2,lots\n" +
+		"BGM05003,Old Id,BGM - Board Game,07/30/2015 03:00 PM,2,6\n" +
+		"BGM15004,Bad Start,BGM - Board Game,Thursday,2,6\n" +
+		"BGM15005,Also Good,BGM - Board Game,07/30/2015 05:00 PM,1,4\n"
+
+	parsed, rowErrors, err := ParseGenconCsv([]byte(csv))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(parsed) != 2 || parsed[0].EventId != "BGM15001" || parsed[1].EventId != "BGM15005" {
+		t.Errorf("Expected only the good rows, got %v", parsed)
+	}
+	expected := []RowError{
+		{Row: 3, Column: string(colTicketsAvailable), Value: "lots"},
+		{Row: 4, Column: string(colEventId), Value: "BGM05003"},
+		{Row: 5, Column: string(colStartTime), Value: "Thursday"},
+	}
+	if len(rowErrors) != len(expected) {
+		t.Fatalf("Expected %d row errors, got %v", len(expected), rowErrors)
+	}
+	for i, e := range expected {
+		got := rowErrors[i]
+		if got.Row != e.Row || got.Column != e.Column || got.Value != e.Value || got.Err == nil {
+			t.Errorf("Expected %+v, got %+v", e, got)
+		}
+	}
+}
@@ -5,100 +5,75 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"strconv"
-	"time"
+	"strings"
 )
 
-func intField(fieldValue string, defaultValue int, fieldName string) int {
-	if len(fieldValue) == 0 {
-		return defaultValue
+// textCell turns a csv field into the cell a spreadsheet would have held, so
+// csv rows can go through rowToEvent and come out the same as the xlsx rows.
+func textCell(field string) cellValue {
+	trimmed := strings.TrimSpace(field)
+	if trimmed == "" {
+		return cellValue{Text: field}
 	}
-	value, err := strconv.Atoi(fieldValue)
-	if err != nil {
-		log.Fatalf("Unable to parse field '%s' with value '%s', err %v",
-			fieldName, fieldValue, err)
+	number, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+		return cellValue{Text: field}
 	}
-	return value
+	return cellValue{Text: field, Number: number, IsNumber: true}
 }
 
-func floatField(fieldValue string, defaultValue float64, fieldName string) float64 {
-	if len(fieldValue) == 0 {
-		return defaultValue
-	}
-	value, err := strconv.ParseFloat(fieldValue, 64)
-	if err != nil {
-		log.Fatalf("Unable to parse field '%s' with value '%s', err %v",
-			fieldName, fieldValue, err)
+func lineToCells(line []string) []cellValue {
+	cells := make([]cellValue, len(line))
+	for i, field := range line {
+		cells[i] = textCell(field)
 	}
-	return value
+	return cells
 }
 
-func linetoEvent(row []string) *GenconEvent {
-	startTime := parseTime(row[13])
-	duration := (int)(60 * floatField(row[14], 0, "Duration"))
-	endTime := startTime.Add((time.Duration)(1e9 * 60 * duration))
-
-	eventId := row[0]
-	shortCategory, year, _, _ := splitId(eventId)
-
-	indy, _ := time.LoadLocation("America/Indianapolis")
-	lastModified, _ := time.ParseInLocation("01-02-06", row[30], indy)
-
-	return &GenconEvent{
-		EventId:              eventId,
-		Year:                 year,
-		Active:               true,
-		Group:                row[1],
-		Title:                row[2],
-		ShortDescription:     row[3],
-		LongDescription:      row[4],
-		EventType:            row[5],
-		GameSystem:           row[6],
-		RulesEdition:         row[7],
-		MinPlayers:           intField(row[8], 0, "MinPlayers"),
-		MaxPlayers:           intField(row[9], 0, "MaxPlayers"),
-		AgeRequired:          row[10],
-		ExperienceRequired:   row[11],
-		MaterialsProvided:    row[12] == "Yes",
-		StartTime:            startTime,
-		Duration:             duration,
-		EndTime:              endTime,
-		GMNames:              row[16],
-		Website:              row[17],
-		Email:                row[18],
-		Tournament:           row[19] == "Yes",
-		RoundNumber:          intField(row[20], 0, "RoundNumber"),
-		TotalRounds:          intField(row[21], 0, "TotalRounds"),
-		MinPlayTime:          (int)(60 * floatField(row[22], 0, "MinPlayTime")),
-		AttendeeRegistration: row[23],
-		Cost:                 (int)(floatField(row[24], 0, "Cost")),
-		Location:             row[25],
-		RoomName:             row[26],
-		TableNumber:          row[27],
-		SpecialCategory:      row[28],
-		TicketsAvailable:     intField(row[29], 0, "TicketsAvailable"),
-		LastModified:         lastModified,
-		ShortCategory:        shortCategory,
-	}
-}
-
-func ParseGenconCsv(rawBytes []byte) []*GenconEvent {
+func ParseGenconCsv(rawBytes []byte) ([]*GenconEvent, []RowError, error) {
 	csvReader := csv.NewReader(bytes.NewBuffer(rawBytes))
-	line, err := csvReader.Read()
+	// Short rows are handled by the column lookups, don't reject them here
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read csv header: %w", err)
+	}
+	columns, err := newColumnMap(header)
 	if err != nil {
-		fmt.Println(line)
+		return nil, nil, err
 	}
+
 	var events = make([]*GenconEvent, 0)
+	var rowErrors []RowError
 	for {
-		line, err = csvReader.Read()
+		line, err := csvReader.Read()
 		if err == io.EOF {
-			return events
+			return events, rowErrors, nil
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			rowErrors = append(rowErrors, RowError{Row: parseErr.StartLine, Err: parseErr.Err})
+			continue
 		} else if err != nil {
-			log.Fatal("Errored during parsing", err)
+			return nil, nil, err
 		}
 
-		events = append(events, linetoEvent(line))
+		// Row numbers are file lines, like a spreadsheet, which makes bad
+		// rows easy to find. Quoted newlines mean they can skip ahead.
+		lineNum, _ := csvReader.FieldPos(0)
+		row := &sheetRow{cells: lineToCells(line), columns: columns}
+		row.rowNum = lineNum
+		if row.str(colEventId) == "" {
+			// Same as the spreadsheet, blank rows are skipped
+			continue
+		}
+		// Csv has no 1904 epoch, serial dates in it are always 1900 based
+		event, rowErr := rowToEvent(row, false)
+		if rowErr != nil {
+			rowErrors = append(rowErrors, *rowErr)
+			continue
+		}
+		events = append(events, event)
 	}
-	return events
 }
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeKind is what about an event changed between two catalog snapshots.
+type ChangeKind string
+
+const (
+	ChangeAdded       ChangeKind = "added"
+	ChangeCancelled   ChangeKind = "cancelled"
+	ChangeReactivated ChangeKind = "reactivated"
+	ChangeTime        ChangeKind = "time"
+	ChangeRoom        ChangeKind = "room"
+	ChangeCost        ChangeKind = "cost"
+	ChangeTickets     ChangeKind = "tickets"
+)
+
+// The order changes to one event are reported in.
+var changeKindOrder = map[ChangeKind]int{
+	ChangeAdded:       0,
+	ChangeCancelled:   1,
+	ChangeReactivated: 2,
+	ChangeTime:        3,
+	ChangeRoom:        4,
+	ChangeCost:        5,
+	ChangeTickets:     6,
+}
+
+// EventChange is a single change to a single event. Values are formatted as
+// text so every kind can be stored and shown the same way, empty when there
+// is nothing to show, e.g. OldValue of an added event.
+type EventChange struct {
+	EventId  string
+	Year     int
+	Kind     ChangeKind
+	OldValue string
+	NewValue string
+}
+
+// Times are stored as an ISO 8601 interval, start/end.
+func formatEventTime(e *GenconEvent) string {
+	return e.StartTime.Format(time.RFC3339) + "/" + e.EndTime.Format(time.RFC3339)
+}
+
+// Formatted the way the event page shows it.
+func formatEventRoom(e *GenconEvent) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{e.Location, e.RoomName, e.TableNumber} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// DiffEvents compares the events we had, which includes inactive ones, with a
+// newly parsed catalog, in which everything is active. Events missing from
+// the catalog were cancelled, and inactive events showing up again were
+// reactivated. Changes are sorted by event id.
+func DiffEvents(before, after []*GenconEvent) []EventChange {
+	previous := make(map[string]*GenconEvent, len(before))
+	for _, event := range before {
+		previous[event.EventId] = event
+	}
+
+	var changes []EventChange
+	seen := make(map[string]bool, len(after))
+	for _, event := range after {
+		seen[event.EventId] = true
+		old, found := previous[event.EventId]
+		if !found {
+			changes = append(changes, EventChange{
+				EventId:  event.EventId,
+				Year:     event.Year,
+				Kind:     ChangeAdded,
+				NewValue: formatEventTime(event),
+			})
+			continue
+		}
+		changes = append(changes, diffEvent(old, event)...)
+	}
+	for _, event := range before {
+		if event.Active && !seen[event.EventId] {
+			changes = append(changes, EventChange{
+				EventId:  event.EventId,
+				Year:     event.Year,
+				Kind:     ChangeCancelled,
+				OldValue: formatEventTime(event),
+			})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].EventId != changes[j].EventId {
+			return changes[i].EventId < changes[j].EventId
+		}
+		return changeKindOrder[changes[i].Kind] < changeKindOrder[changes[j].Kind]
+	})
+	return changes
+}
+
+func diffEvent(old, updated *GenconEvent) []EventChange {
+	var changes []EventChange
+	add := func(kind ChangeKind, oldValue, newValue string) {
+		changes = append(changes, EventChange{
+			EventId:  updated.EventId,
+			Year:     updated.Year,
+			Kind:     kind,
+			OldValue: oldValue,
+			NewValue: newValue,
+		})
+	}
+
+	if !old.Active && updated.Active {
+		add(ChangeReactivated, "", formatEventTime(updated))
+	}
+	if !old.StartTime.Equal(updated.StartTime) || !old.EndTime.Equal(updated.EndTime) {
+		add(ChangeTime, formatEventTime(old), formatEventTime(updated))
+	}
+	if oldRoom, newRoom := formatEventRoom(old), formatEventRoom(updated); oldRoom != newRoom {
+		add(ChangeRoom, oldRoom, newRoom)
+	}
+	if old.Cost != updated.Cost {
+		add(ChangeCost, strconv.Itoa(old.Cost), strconv.Itoa(updated.Cost))
+	}
+	if old.TicketsAvailable != updated.TicketsAvailable {
+		add(ChangeTickets, strconv.Itoa(old.TicketsAvailable), strconv.Itoa(updated.TicketsAvailable))
+	}
+	return changes
+}
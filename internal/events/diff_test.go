@@ -0,0 +1,101 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func diffTestEvent(eventId string) *GenconEvent {
+	start := time.Date(2023, time.August, 3, 18, 0, 0, 0, indianapolis())
+	return &GenconEvent{
+		EventId:          eventId,
+		Year:             2023,
+		Active:           true,
+		StartTime:        start,
+		Duration:         120,
+		EndTime:          start.Add(2 * time.Hour),
+		Cost:             4,
+		Location:         "ICC",
+		RoomName:         "Hall D",
+		TableNumber:      "12",
+		TicketsAvailable: 6,
+	}
+}
+
+func TestDiffEvents(t *testing.T) {
+	unchanged := diffTestEvent("BGM23ND00001")
+	moved := diffTestEvent("BGM23ND00002")
+	cancelled := diffTestEvent("BGM23ND00003")
+	reactivated := diffTestEvent("BGM23ND00004")
+	reactivated.Active = false
+	stillInactive := diffTestEvent("BGM23ND00005")
+	stillInactive.Active = false
+	before := []*GenconEvent{unchanged, moved, cancelled, reactivated, stillInactive}
+
+	movedNow := diffTestEvent(moved.EventId)
+	movedNow.StartTime = movedNow.StartTime.Add(time.Hour)
+	movedNow.EndTime = movedNow.EndTime.Add(time.Hour)
+	movedNow.RoomName = "Hall E"
+	movedNow.Cost = 6
+	movedNow.TicketsAvailable = 0
+	added := diffTestEvent("BGM23ND00006")
+	after := []*GenconEvent{
+		diffTestEvent(unchanged.EventId),
+		movedNow,
+		diffTestEvent(reactivated.EventId),
+		added,
+	}
+
+	changes := DiffEvents(before, after)
+	expected := []EventChange{
+		{EventId: moved.EventId, Kind: ChangeTime,
+			OldValue: "2023-08-03T18:00:00-04:00/2023-08-03T20:00:00-04:00",
+			NewValue: "2023-08-03T19:00:00-04:00/2023-08-03T21:00:00-04:00"},
+		{EventId: moved.EventId, Kind: ChangeRoom, OldValue: "ICC / Hall D / 12", NewValue: "ICC / Hall E / 12"},
+		{EventId: moved.EventId, Kind: ChangeCost, OldValue: "4", NewValue: "6"},
+		{EventId: moved.EventId, Kind: ChangeTickets, OldValue: "6", NewValue: "0"},
+		{EventId: cancelled.EventId, Kind: ChangeCancelled},
+		{EventId: reactivated.EventId, Kind: ChangeReactivated},
+		{EventId: added.EventId, Kind: ChangeAdded},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, e := range expected {
+		got := changes[i]
+		if got.EventId != e.EventId || got.Kind != e.Kind || got.Year != 2023 {
+			t.Errorf("Change %d: expected %v %v, got %+v", i, e.EventId, e.Kind, got)
+		}
+		if e.OldValue != "" && (got.OldValue != e.OldValue || got.NewValue != e.NewValue) {
+			t.Errorf("Change %d: expected %q -> %q, got %q -> %q", i, e.OldValue, e.NewValue, got.OldValue, got.NewValue)
+		}
+	}
+}
+
+func TestDiffEventsWithoutGroup(t *testing.T) {
+	before := diffTestEvent("BGM23ND00001")
+	before.Group = "Gen Con"
+	after := diffTestEvent(before.EventId)
+	after.TicketsAvailable = 2
+
+	changes := DiffEvents([]*GenconEvent{before}, []*GenconEvent{after})
+	if len(changes) != 1 || changes[0].Kind != ChangeTickets {
+		t.Errorf("Expected the tickets of an event losing its group to change, got %+v", changes)
+	}
+	if changes := DiffEvents([]*GenconEvent{after}, []*GenconEvent{after}); len(changes) != 0 {
+		t.Errorf("Expected an unchanged event without a group to have no changes, got %+v", changes)
+	}
+}
+
+func TestDiffEventsTimeZones(t *testing.T) {
+	// Times loaded back from the database are in a different location, but
+	// the same instant isn't a change.
+	before := diffTestEvent("BGM23ND00001")
+	after := diffTestEvent("BGM23ND00001")
+	after.StartTime = after.StartTime.UTC()
+	after.EndTime = after.EndTime.UTC()
+
+	if changes := DiffEvents([]*GenconEvent{before}, []*GenconEvent{after}); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
@@ -2,16 +2,9 @@ package events
 
 import (
 	"fmt"
-	"log"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
-	"unicode"
 )
 
-var eventCategoryRegex = regexp.MustCompile(`([A-Z]*)(\d\d)([A-Z][A-Z])(\d+)`)
-
 func PartitionEventsByDay(loadedEvents []*GenconEvent) map[string][]*GenconEvent {
 	eventsPerDay := make(map[string][]*GenconEvent)
 
@@ -70,46 +63,19 @@ func LongCategory(shortCategory string) string {
 }
 
 func CategoryFromEvent(rawEventId string) string {
-	category, _, _, _ := splitId(rawEventId)
-	return category
+	id, err := ParseEventID(rawEventId)
+	if err != nil {
+		return ""
+	}
+	return id.Category
 }
 
 func YearFromEvent(rawEventId string) int {
-	_, year, _, _ := splitId(rawEventId)
-	return year
-}
-
-func splitId(rawEventId string) (string, int, string, string) {
-	category := ""
-	rawYear := ""
-	locale := ""
-	rawId := ""
-	if eventCategoryRegex.MatchString(rawEventId) {
-		// In 2023, gencon changed up the format of their ids. Boo.
-		parsedFields := eventCategoryRegex.FindAllStringSubmatch(rawEventId, -1)
-		category = parsedFields[0][1]
-		rawYear = parsedFields[0][2]
-		locale = parsedFields[0][3] // I assume it's locale at least
-		rawId = parsedFields[0][4]
-	} else {
-		// This was the event id format before 2023
-		// Remove the letters on the left leaves us with <2 # year><id>
-		yearId := strings.TrimLeftFunc(rawEventId, unicode.IsLetter)
-		rawYear = yearId[:2]
-		rawId = yearId[2:]
-		// Remove the numbers on the right leaves us with the event category
-		category = strings.TrimRightFunc(rawEventId, unicode.IsDigit)
-	}
-
-	twoDigitYear, err := strconv.Atoi(rawYear)
+	id, err := ParseEventID(rawEventId)
 	if err != nil {
-		log.Fatalf("Unable to parse year out of %s, %v", rawEventId, err)
-	}
-	if 15 > twoDigitYear {
-		log.Fatalf("Unsupported year being parsed! rawEventId %s", rawEventId)
+		return 0
 	}
-
-	return category, 2000 + twoDigitYear, locale, rawId
+	return id.Year
 }
 
 type SlimEvent struct {
@@ -163,190 +129,10 @@ type GenconEvent struct {
 	OrgId            	 int64
 }
 
+// NormalizeEvent cleans up the free text fields organizers fill in, using
+// the rules that ship with the code. See system_remaps.json.
 func NormalizeEvent(event *GenconEvent) *GenconEvent {
-	systemRemappings := map[string]string{
-		"Shadows of ESteren":        "Shadows of Esteren",
-		"Dragon Age":                "Dragon AGE",
-		"Magic: the Gathering":      "Magic: The Gathering",
-		"7 wonders":                 "7 Wonders",
-		"Disney's Villainous":       "Disney Villainous",
-		"Disney's Villianous":       "Disney Villainous",
-		"Tesla vs Edison":           "Tesla vs. Edison",
-		"Caverna w Forgotten Folks": "Caverna: The Cave Farmers",
-		"Dead of Winter":            "Dead of Winter: A Crossroads Game",
-		"Dr. Who: Blink":            "Blink!",
-		"Dune Imperium":             "Dune: Imperium",
-		"Firefly":                   "Firefly: The Game",
-		"Formula De Mini":           "Formula Dé Mini",
-		"Funkoverse":                "Funkoverse Strategy Game",
-		"Marvel Villainous":         "Marvel Villainous: Infinite Power",
-		"SpaceCorp: 2025-2300 AD":   "SpaceCorp: 2025-2300AD",
-		"Spector Ops":               "Specter Ops",
-		"Star Trek Ascendancy":      "Star Trek: Ascendancy",
-		"Strat-O-matic":             "Strat-O-Matic Baseball",
-		"Swords and Sorcery":        "Sword & Sorcery",
-		"Dungeon Fun":               "Dungeon Party",
-		"A Sonf of Ice and Fire - Miniatures Game": "A Song of Ice and Fire - Miniatures Game",
-		"AEGIS Combining Robots":                   "A.E.G.I.S. Combining Robots: Season 2",
-		"Anna's Roundtable":                        "Anna's Roundtable: The Fire Emblem Board Game",
-		"Ascension: Tactics":                       "Ascension Tactics: Miniatures Deckbuilding Game",
-		"Ascension; Tactics":                       "Ascension Tactics: Miniatures Deckbuilding Game",
-		"Ascension Tactics":                        "Ascension Tactics: Miniatures Deckbuilding Game",
-		"Boss Monster":                             "Boss Monster: The Dungeon Building Card Game",
-		"Captain is Dead":                          "The Captain Is Dead",
-		"Carcassone":                               "Carcassonne",
-		"cartagena":                                "Cartagena",
-		"Clank!":                                   "Clank!: A Deck-Building Adventure",
-		"Codenames Duet":                           "Codenames: Duet",
-		"Cartographers: A Roll Player Tale":        "Cartographers",
-		"Wrath of the Lich King":                   "World of Warcraft: Wrath of the Lich King",
-		"Axis & Allies 1942": "Axis & Allies: 1942",
-		"B-17 Queen of the Skies": "B-17: Queen of the Skies",
-		"Battle for Greyport": "The Red Dragon Inn: Battle for Greyport",
-		"Broadsides and Boarding Parties": "Broadsides & Boarding Parties",
-		"Manhattan Project: Energy Empire":          "The Manhattan Project: Energy Empire",
-		"Extraordinary Adventures: Pirates!":        "Extraordinary Adventures: Pirates",
-		"Fangs: Werewolves vs. Vampires vs. Humans": "Fangs: Werewolves vs Vampires vs Humans",
-		"Ascension": "Ascension: Deckbuilding Game",
-		"Affliction": "AFFLICTION: Salem 1692",
-		"5 Year Mission": "Star Trek: Five-Year Mission",
-		"Agatha Christie: Death in the Cards": "Agatha Christie: Death on the Cards",
-		"Age of Mythology": "Age of Mythology: The Boardgame",
-		"Alien - Fate of the Nostromo" : "ALIEN: Fate of the Nostromo",
-		"Anna's Roundtable: The Fire Emblem Board Game": "Anna's Roundtable: The Fan Made Fire Emblem Board Game",
-		"Broken and Beautiful": "Broken and Beautiful: A Game About Kintsugi",
-		"Cache Me If You Can!": "Cache Me If You Can!: The Geocaching Board Game",
-		"Cartographers: Heroes": "Cartographers Heroes",
-		"Castle Ravenloft": "Dungeons & Dragons: Castle Ravenloft Board Game",
-		"Caverna": "Caverna: The Cave Farmers",
-		"Conan by Monolith": "Conan",
-		"Conquest Princess": "Conquest Princess: Fashion Is Power",
-		"Decorum": "Décorum",
-		"Destination Neptune": "Destination: Neptune",
-		"Disney Sorcerer's Arena: Epic Alliances": "Disney Sorcerer's Arena: Epic Alliances Core Set",
-		"Downfall of Pompeii": "The Downfall of Pompeii",
-		"Dragon Prince: Battlecharged": "The Dragon Prince: Battlecharged",
-		"Dungeons & Dragons: The Yawning Portal Board Game": "Dungeons & Dragons: The Yawning Portal",
-		"E.T.I. Estimated Time to Invasion": "E.T.I.: Estimated Time to Invasion",
- 		"Empyreal": "Empyreal: Spells & Steam",
- 		"Escape the Dark": "The Last of Us: Escape the Dark",
- 		"Faeries and Magical Creatures": "Faeries & Magical Creatures",
- 		"Fateforge": "Fateforge: Chronicles of Kaan",
- 		"Genshin Tarot": "Genshin Tarot: The Fan Made Genshin Impact Board Game",
- 		"Great British Baking show": "The Great British Baking Show Game",
- 		"Headless Horseman": "Headless Horseman Board Game",
- 		"Hellboy The Board Game": "Hellboy: The Board Game",
- 		"Hulk Smash": "The Incredible Hulk Smash",
- 		"Ierusalem": "Ierusalem: Anno Domini",
- 		"Kinfire Chronicles": "Kinfire Chronicles: Night's Fall",
- 		"Kung-Fu Zoo": "Kung Fu Zoo",
- 		"Kutna Hora": "Kutná Hora: The City of Silver",
- 		"Ladies and Gentlmen": "Ladies & Gentlemen",
- 		"Last Night on Earth": "Last Night on Earth: The Zombie Game",
- 		"Legacy's Allure": "Legacy's Allure: Season 1",
- 		"Life of the Amazoia": "Life of the Amazonia",
- 		"Masters of Orion": "Master of Orion: The Board Game",
- 		"My Little Pony Adventures in Equestria Deck-Building Game": "My Little Pony: Adventures in Equestria Deck-Building Game",
- 		"Oath": "Oath: Chronicles of Empire and Exile",
- 		"Oltree": "Oltréé",
- 		"Orleans": "Orléans",
- 		"Overboss": "Overboss: A Boss Monster Adventure",
- 		"Persona 5 Royal": "Trick Gear: Persona 5 The Royal",
- 		"Planted": "Planted: A Game of Nature & Nurture",
- 		"Red Dragon Inn": "The Red Dragon Inn",
- 		"Roll Camera": "Roll Camera!: The Filmmaking Board Game",
- 		"Roll to the Top": "Roll to the Top!",
- 		"SHOBU": "SHŌBU",
- 		"Settlers of America": "Catan Histories: Settlers of America – Trails to Rails",
- 		"Settlers of Catan": "The Settlers of Catan",
- 		"Shadowgate the Living Castle": "Shadowgate: The Living Castle",
-
- 		"Smash Up: Disney Style!": "Smash Up: Disney Edition",
- 		"Snow White Gemstone Mining": "Snow White and the Seven Dwarfs: A Gemstone Mining Game",
- 		"Star Trek Ascendency": "Star Trek: Ascendancy",
- 		"Stupid Death": "Stupid Deaths",
- 		"Sushi Go Party": "Sushi Go Party!",
- 		"Suspects: Adele & Neville, Investigative Reporters": "Suspects: Adele and Neville, Investigative Reporters",
- 		"The Binding Of Isaac Four Souls": "The Binding of Isaac: Four Souls",
- 		"Trekking": "Trekking the World",
- 		"Trogdor!!": "Trogdor!!: The Board Game",
- 		"Tzolk'in": "Tzolk'in: The Mayan Calendar",
- 		"Unmatched": "Unmatched Game System",
- 		"Uproot Arboreal Battleship": "Uproot: Arboreal Battleship",
- 		"Villainous": "Disney Villainous",
- 		"Viticulture World": "Viticulture World: Cooperative Expansion",
- 		"Way Too Many Cats": "Way Too Many Cats!",
- 		"World of Ulos": "Dawn of Ulos",
- 		"Wrath of Ashardalon": "Dungeons & Dragons: Wrath of Ashardalon Board Game",
-		"Zombie Survival": "Zombie Survival: The Board Game",
-
-		// The difference on this one is the emdash!
-		"Disney: The Haunted Mansion - Call of the Spirits Game": "Disney: The Haunted Mansion – Call of the Spirits Game",
-	}
-
-	if canonicalSystem, found := systemRemappings[event.GameSystem]; found {
-		event.GameSystem = canonicalSystem
-	}
-
-	if event.GameSystem == "Scythe: Invaders from Afar Expansion" {
-		event.GameSystem = "Scythe"
-		event.RulesEdition = "Invaders from Afar Expansion"
-	}
-
-	if event.GameSystem == "Roll Camera! with B-Movie expansion" {
-		event.GameSystem = "Roll Camera!: The Filmmaking Board Game"
-		event.RulesEdition = "Roll Camera!: The B-Movie Expansion"
-	}
-
-	if event.GameSystem == "Betrayal at House on the Hill: Widows Walk Expansion" {
-		event.GameSystem = "Betrayal at House on the Hill"
-		event.RulesEdition = "Widows Walk Expansion"
-	}
-
-	if event.GameSystem == "Dominion" && event.RulesEdition == "Intrigue" {
-		event.GameSystem = "Dominion: Intrigue"
-	}
-
-	if event.GameSystem == "Dungeons & Dragons Adventure Board Game" && event.RulesEdition == "Castle Ravenloft" {
-		event.GameSystem = "Dungeons & Dragons: Castle Ravenloft Board Game"
-	}
-
-	if event.GameSystem == "Dungeons & Dragons Adventure Board Game" && event.RulesEdition == "The Legend of Drizzt" {
-		event.GameSystem = "Dungeons & Dragons: The Legend of Drizzt Board Game"
-	}
-
-	if event.Title == "Exit: The Forgotten Island" && event.GameSystem == "EXIT" {
-		event.GameSystem = "Exit: The Game – The Forgotten Island"
-	}
-	if event.Title == "Exit: The Haunted Rollercoaster" && event.GameSystem == "EXIT" {
-		event.GameSystem = "Exit: The Game – The Haunted Roller Coaster"
-	}
-	if event.GameSystem == "Game of Thrones" &&
-		event.Title == "Game of Thrones: The Board Game" &&
-		event.RulesEdition == "2nd" {
-		event.GameSystem = "A Game of Thrones: The Board Game (Second Edition)"
-	}
-	if event.GameSystem == "St Petersburg" {
-		if event.RulesEdition == "1st" {
-			event.GameSystem = "Saint Petersburg"
-		} else {
-			event.GameSystem = "Saint Petersburg (Second Edition)"
-		}
-	}
-
-	if strings.Contains(event.Title, "The Boys: This Is Going to Hurt") && event.GameSystem == "Tabletop" {
-		event.GameSystem = "The Boys: This Is Going to Hurt"
-	}
-
-	if event.GameSystem == "Sword & Sorcery" && event.RulesEdition == "Ancient Chronicles" {
-		event.GameSystem = "Sword & Sorcery: Ancient Chronicles"
-	}
-
-	if event.GameSystem == "Atlantis Rising" && event.RulesEdition == "2nd" {
-		event.GameSystem = "Atlantis Rising (Second Edition)"
-	}
-
-	return event
+	return defaultRemapRules.Apply(event)
 }
 
 func (e *GenconEvent) PlannerLink() string {
@@ -354,8 +140,11 @@ func (e *GenconEvent) PlannerLink() string {
 }
 
 func (e *GenconEvent) GenconLink() string {
-	_, _, _, id := splitId(e.EventId)
-	return fmt.Sprintf("http://gencon.com/events/%v", id)
+	id, err := ParseEventID(e.EventId)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("http://gencon.com/events/%v", id.Number)
 }
 
 func (e *GenconEvent) SlimEvent() *SlimEvent {
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// In 2023, gencon changed up the format of their ids. Boo.
+	// <category><2 digit year><2 letter locale><number>, eg RPG23ND12345
+	eventIdRegex = regexp.MustCompile(`^([A-Z]+)(\d\d)([A-Z][A-Z])(\d+)$`)
+	// This was the event id format before 2023: <category><2 digit year><number>
+	legacyEventIdRegex = regexp.MustCompile(`^([A-Z]+)(\d\d)(\d+)$`)
+)
+
+// The first year we have catalogs for, anything older is a typo.
+const firstEventYear = 2015
+
+// EventID is a Gen Con event id split into its parts.
+type EventID struct {
+	Category string
+	Year     int
+	// Locale is only present in 2023 and later ids. I assume it's locale at
+	// least, it's been ND for every event so far.
+	Locale string
+	// Number is kept as a string since it's zero padded.
+	Number string
+}
+
+// ParseEventID splits a raw event id, as found in the catalog or a url, into
+// its parts. Ids are case insensitive.
+func ParseEventID(rawEventId string) (EventID, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(rawEventId))
+
+	var id EventID
+	var rawYear string
+	if fields := eventIdRegex.FindStringSubmatch(normalized); fields != nil {
+		id.Category, rawYear, id.Locale, id.Number = fields[1], fields[2], fields[3], fields[4]
+	} else if fields := legacyEventIdRegex.FindStringSubmatch(normalized); fields != nil {
+		id.Category, rawYear, id.Number = fields[1], fields[2], fields[3]
+	} else {
+		return EventID{}, fmt.Errorf("malformed event id %q", rawEventId)
+	}
+
+	// Can't fail, the regex only matched two digits
+	twoDigitYear, _ := strconv.Atoi(rawYear)
+	id.Year = 2000 + twoDigitYear
+
+	if err := id.Validate(); err != nil {
+		return EventID{}, err
+	}
+	return id, nil
+}
+
+// String formats the id the way Gen Con does, so it round trips through
+// ParseEventID.
+func (id EventID) String() string {
+	return fmt.Sprintf("%s%02d%s%s", id.Category, id.Year%100, id.Locale, id.Number)
+}
+
+// Validate checks that each part of the id is well formed.
+func (id EventID) Validate() error {
+	if id.Category == "" || strings.IndexFunc(id.Category, notUpper) >= 0 {
+		return fmt.Errorf("bad category %q in event id", id.Category)
+	}
+	if id.Year < firstEventYear || id.Year >= 2100 {
+		return fmt.Errorf("unsupported year %d in event id %v", id.Year, id)
+	}
+	if id.Locale != "" && (len(id.Locale) != 2 || strings.IndexFunc(id.Locale, notUpper) >= 0) {
+		return fmt.Errorf("bad locale %q in event id", id.Locale)
+	}
+	if id.Number == "" || strings.IndexFunc(id.Number, notDigit) >= 0 {
+		return fmt.Errorf("bad number %q in event id", id.Number)
+	}
+	return nil
+}
+
+func notUpper(r rune) bool {
+	return r < 'A' || r > 'Z'
+}
+
+func notDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
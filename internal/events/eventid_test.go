@@ -0,0 +1,81 @@
+package events
+
+import "testing"
+
+func TestParseEventID(t *testing.T) {
+	cases := map[string]EventID{
+		"RPG23ND12345":  {Category: "RPG", Year: 2023, Locale: "ND", Number: "12345"},
+		"RPGA24ND00042": {Category: "RPGA", Year: 2024, Locale: "ND", Number: "00042"},
+		"BGM15001":      {Category: "BGM", Year: 2015, Number: "001"},
+		"TDA19123456":   {Category: "TDA", Year: 2019, Number: "123456"},
+	}
+	for raw, expected := range cases {
+		id, err := ParseEventID(raw)
+		if err != nil {
+			t.Errorf("ParseEventID(%q) unexpected error: %v", raw, err)
+			continue
+		}
+		if id != expected {
+			t.Errorf("ParseEventID(%q) = %+v, expected %+v", raw, id, expected)
+		}
+		if id.String() != raw {
+			t.Errorf("Expected %q to round trip, got %q", raw, id.String())
+		}
+	}
+}
+
+func TestParseEventIDNormalizes(t *testing.T) {
+	id, err := ParseEventID(" rpg23nd12345 ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id.String() != "RPG23ND12345" {
+		t.Errorf("Expected canonical id, got %q", id.String())
+	}
+}
+
+func TestParseEventIDMalformed(t *testing.T) {
+	for _, raw := range []string{
+		"",
+		"RPG",
+		"23ND12345",
+		"RPG2",
+		"RPG14001",           // Before we have catalogs
+		"RPG23ND",            // No number
+		"RPG23N12345",        // Half a locale
+		"RPG23ND12345; DROP", // Trailing junk
+		"../../etc/passwd",
+	} {
+		if id, err := ParseEventID(raw); err == nil {
+			t.Errorf("Expected ParseEventID(%q) to fail, got %+v", raw, id)
+		}
+	}
+}
+
+func TestEventIDValidate(t *testing.T) {
+	if err := (EventID{Category: "BGM", Year: 2023, Locale: "ND", Number: "1"}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	invalid := []EventID{
+		{Year: 2023, Number: "1"},
+		{Category: "bgm", Year: 2023, Number: "1"},
+		{Category: "BGM", Year: 2010, Number: "1"},
+		{Category: "BGM", Year: 2023, Locale: "N", Number: "1"},
+		{Category: "BGM", Year: 2023, Number: "1a"},
+		{Category: "BGM", Year: 2023},
+	}
+	for _, id := range invalid {
+		if err := id.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", id)
+		}
+	}
+}
+
+func TestYearAndCategoryFromEvent(t *testing.T) {
+	if YearFromEvent("BGM22123") != 2022 || CategoryFromEvent("BGM22123") != "BGM" {
+		t.Errorf("Unexpected year/category for legacy id")
+	}
+	if YearFromEvent("bogus") != 0 || CategoryFromEvent("bogus") != "" {
+		t.Errorf("Expected zero values for malformed id")
+	}
+}
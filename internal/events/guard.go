@@ -0,0 +1,59 @@
+package events
+
+import "fmt"
+
+// Below this many active events a year's catalog is still filling in, so big
+// swings are expected and the limits don't apply.
+const minGuardedEvents = 100
+
+// DeactivationLimits guard against importing a truncated catalog, which
+// would deactivate every missing event and empty everyone's starred lists.
+// Limits are percentages of a year's active events, zero means no limit.
+type DeactivationLimits struct {
+	// At most this much of the active events can be deactivated at once.
+	MaxDeactivatedPercent float64
+	// The catalog can have at most this much fewer events than are active.
+	MaxDropPercent float64
+}
+
+// DeactivationError is an import the limits stopped.
+type DeactivationError struct {
+	Year        int
+	Active      int
+	Parsed      int
+	Deactivated int
+	Reason      string
+}
+
+func (e *DeactivationError) Error() string {
+	return fmt.Sprintf("aborted the %d import: %s", e.Year, e.Reason)
+}
+
+// Check returns a *DeactivationError if importing parsed events for a year
+// with active events would deactivate too many of them. A nil limits never
+// stops an import.
+func (l *DeactivationLimits) Check(year, active, parsed, deactivated int) error {
+	if l == nil || active < minGuardedEvents {
+		return nil
+	}
+	reason := ""
+	deactivatedPercent := 100 * float64(deactivated) / float64(active)
+	dropPercent := 100 * float64(active-parsed) / float64(active)
+	if l.MaxDeactivatedPercent > 0 && deactivatedPercent > l.MaxDeactivatedPercent {
+		reason = fmt.Sprintf("it would deactivate %d of %d active events (%.1f%%), more than the %v%% limit",
+			deactivated, active, deactivatedPercent, l.MaxDeactivatedPercent)
+	} else if l.MaxDropPercent > 0 && dropPercent > l.MaxDropPercent {
+		reason = fmt.Sprintf("it has %d events, down %.1f%% from %d active, more than the %v%% limit",
+			parsed, dropPercent, active, l.MaxDropPercent)
+	}
+	if reason == "" {
+		return nil
+	}
+	return &DeactivationError{
+		Year:        year,
+		Active:      active,
+		Parsed:      parsed,
+		Deactivated: deactivated,
+		Reason:      reason,
+	}
+}
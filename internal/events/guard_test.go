@@ -0,0 +1,53 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDeactivationLimits(t *testing.T) {
+	limits := &DeactivationLimits{MaxDeactivatedPercent: 10, MaxDropPercent: 20}
+	tests := []struct {
+		name        string
+		active      int
+		parsed      int
+		deactivated int
+		expected    string
+	}{
+		{"normal update", 1000, 1010, 20, ""},
+		{"truncated", 1000, 300, 700, "deactivate 700 of 1000"},
+		{"renumbered", 1000, 1000, 150, "deactivate 150 of 1000"},
+		{"dropped rows", 1000, 750, 50, "down 25.0%"},
+		{"first catalog", 0, 500, 0, ""},
+		{"too few to judge", 50, 5, 45, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := limits.Check(2023, test.active, test.parsed, test.deactivated)
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			var deactivationErr *DeactivationError
+			if !errors.As(err, &deactivationErr) || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("Expected an error containing %q, got %v", test.expected, err)
+			}
+			if deactivationErr.Year != 2023 || deactivationErr.Deactivated != test.deactivated {
+				t.Errorf("Unexpected error details %+v", deactivationErr)
+			}
+		})
+	}
+}
+
+func TestNoDeactivationLimits(t *testing.T) {
+	var limits *DeactivationLimits
+	if err := limits.Check(2023, 1000, 0, 1000); err != nil {
+		t.Errorf("Expected nil limits to allow anything, got %v", err)
+	}
+	if err := (&DeactivationLimits{}).Check(2023, 1000, 0, 1000); err != nil {
+		t.Errorf("Expected zero limits to allow anything, got %v", err)
+	}
+}
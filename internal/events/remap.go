@@ -0,0 +1,123 @@
+package events
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Organizers type game systems in by hand, so the same game shows up under
+// many spellings. These rules map them to the name BGG uses, so we can find
+// ratings and group events together. Rules that ship with the code live in
+// system_remaps.json, rules added through the admin page live in the
+// system_remaps table and run after them.
+//
+//go:embed system_remaps.json
+var systemRemapsJson []byte
+
+var defaultRemapRules = mustParseRemapRules(systemRemapsJson)
+
+// RemapRule rewrites the game system and/or rules edition of events that
+// match all of its non-empty match fields.
+type RemapRule struct {
+	// Only set for rules stored in the database.
+	Id int64 `json:"-"`
+
+	GameSystem    string `json:"game_system,omitempty"`
+	RulesEdition  string `json:"rules_edition,omitempty"`
+	Title         string `json:"title,omitempty"`
+	TitleContains string `json:"title_contains,omitempty"`
+
+	NewGameSystem   string `json:"new_game_system,omitempty"`
+	NewRulesEdition string `json:"new_rules_edition,omitempty"`
+
+	Note string `json:"note,omitempty"`
+}
+
+// RemapRules are applied in order, each rule seeing the result of the ones
+// before it. That lets a spelling fix be followed by an edition specific
+// rule for the corrected name.
+type RemapRules []RemapRule
+
+type remapRulesFile struct {
+	Version int         `json:"version"`
+	Rules   []RemapRule `json:"rules"`
+}
+
+func ParseRemapRules(rawJson []byte) (RemapRules, error) {
+	var file remapRulesFile
+	if err := json.Unmarshal(rawJson, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported remap rules version %d", file.Version)
+	}
+	for i := range file.Rules {
+		if err := file.Rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+func mustParseRemapRules(rawJson []byte) RemapRules {
+	rules, err := ParseRemapRules(rawJson)
+	if err != nil {
+		panic(fmt.Sprintf("bad system_remaps.json: %v", err))
+	}
+	return rules
+}
+
+// DefaultRemapRules returns the rules that ship with the code. Capped, so
+// appending to it copies rather than writing into the shared rules.
+func DefaultRemapRules() RemapRules {
+	n := len(defaultRemapRules)
+	return defaultRemapRules[:n:n]
+}
+
+func (r *RemapRule) Validate() error {
+	if r.GameSystem == "" && r.Title == "" && r.TitleContains == "" {
+		// Matching on edition alone would hit every game with a "2nd" edition
+		return errors.New("rule must match on game system or title")
+	}
+	if r.NewGameSystem == "" && r.NewRulesEdition == "" {
+		return errors.New("rule must set a new game system or rules edition")
+	}
+	return nil
+}
+
+func (r *RemapRule) Matches(event *GenconEvent) bool {
+	if r.GameSystem != "" && r.GameSystem != event.GameSystem {
+		return false
+	}
+	if r.RulesEdition != "" && r.RulesEdition != event.RulesEdition {
+		return false
+	}
+	if r.Title != "" && r.Title != event.Title {
+		return false
+	}
+	if r.TitleContains != "" && !strings.Contains(event.Title, r.TitleContains) {
+		return false
+	}
+	return true
+}
+
+func (r *RemapRule) apply(event *GenconEvent) {
+	if r.NewGameSystem != "" {
+		event.GameSystem = r.NewGameSystem
+	}
+	if r.NewRulesEdition != "" {
+		event.RulesEdition = r.NewRulesEdition
+	}
+}
+
+func (rules RemapRules) Apply(event *GenconEvent) *GenconEvent {
+	for i := range rules {
+		if rules[i].Matches(event) {
+			rules[i].apply(event)
+		}
+	}
+	return event
+}
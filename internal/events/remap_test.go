@@ -0,0 +1,110 @@
+package events
+
+import "testing"
+
+func TestRemapRulesChain(t *testing.T) {
+	cases := []struct {
+		in, expected GenconEvent
+	}{
+		// Spelling fix, then the edition rule for the corrected name
+		{
+			GenconEvent{GameSystem: "Swords and Sorcery", RulesEdition: "Ancient Chronicles"},
+			GenconEvent{GameSystem: "Sword & Sorcery: Ancient Chronicles", RulesEdition: "Ancient Chronicles"},
+		},
+		// Edition specific rule, then a catch all for the other editions
+		{
+			GenconEvent{GameSystem: "St Petersburg", RulesEdition: "1st"},
+			GenconEvent{GameSystem: "Saint Petersburg", RulesEdition: "1st"},
+		},
+		{
+			GenconEvent{GameSystem: "St Petersburg", RulesEdition: "2nd"},
+			GenconEvent{GameSystem: "Saint Petersburg (Second Edition)", RulesEdition: "2nd"},
+		},
+		{
+			GenconEvent{GameSystem: "Tabletop", Title: "Play The Boys: This Is Going to Hurt"},
+			GenconEvent{GameSystem: "The Boys: This Is Going to Hurt"},
+		},
+		{
+			GenconEvent{GameSystem: "Tabletop", Title: "Something else"},
+			GenconEvent{GameSystem: "Tabletop"},
+		},
+		// Each spelling is renamed once, not on to the other's name
+		{
+			GenconEvent{GameSystem: "Anna's Roundtable"},
+			GenconEvent{GameSystem: "Anna's Roundtable: The Fire Emblem Board Game"},
+		},
+		{
+			GenconEvent{GameSystem: "Anna's Roundtable: The Fire Emblem Board Game"},
+			GenconEvent{GameSystem: "Anna's Roundtable: The Fan Made Fire Emblem Board Game"},
+		},
+		{
+			GenconEvent{GameSystem: "Unknown Game", RulesEdition: "2nd"},
+			GenconEvent{GameSystem: "Unknown Game", RulesEdition: "2nd"},
+		},
+	}
+	for _, c := range cases {
+		got := c.in
+		NormalizeEvent(&got)
+		if got.GameSystem != c.expected.GameSystem || got.RulesEdition != c.expected.RulesEdition {
+			t.Errorf("%q/%q/%q: expected %q/%q, got %q/%q",
+				c.in.GameSystem, c.in.RulesEdition, c.in.Title,
+				c.expected.GameSystem, c.expected.RulesEdition, got.GameSystem, got.RulesEdition)
+		}
+	}
+}
+
+// Renames were a single lookup before they were rules, so one rename
+// feeding another would change how events are normalized.
+func TestDefaultRenamesDontChain(t *testing.T) {
+	isRename := func(rule RemapRule) bool {
+		return rule.RulesEdition == "" && rule.Title == "" && rule.TitleContains == "" && rule.NewRulesEdition == ""
+	}
+	rules := DefaultRemapRules()
+	for i, rule := range rules {
+		if !isRename(rule) {
+			continue
+		}
+		for _, later := range rules[i+1:] {
+			if isRename(later) && later.GameSystem == rule.NewGameSystem {
+				t.Errorf("%q is renamed to %q, then again to %q", rule.GameSystem, rule.NewGameSystem, later.NewGameSystem)
+			}
+		}
+	}
+}
+
+func TestRemapRulesInOrder(t *testing.T) {
+	rules := RemapRules{
+		{GameSystem: "A", NewGameSystem: "B"},
+		{GameSystem: "B", NewGameSystem: "C", NewRulesEdition: "2nd"},
+		{GameSystem: "A", NewGameSystem: "Never"},
+	}
+	event := rules.Apply(&GenconEvent{GameSystem: "A", RulesEdition: "1st"})
+	if event.GameSystem != "C" || event.RulesEdition != "2nd" {
+		t.Errorf("Expected C/2nd, got %v/%v", event.GameSystem, event.RulesEdition)
+	}
+}
+
+func TestRemapRuleValidate(t *testing.T) {
+	if err := (&RemapRule{RulesEdition: "2nd", NewRulesEdition: "Second"}).Validate(); err == nil {
+		t.Errorf("Expected an edition only match to be rejected")
+	}
+	if err := (&RemapRule{GameSystem: "A"}).Validate(); err == nil {
+		t.Errorf("Expected a rule without a rewrite to be rejected")
+	}
+	if err := (&RemapRule{TitleContains: "A", NewGameSystem: "B"}).Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestParseRemapRules(t *testing.T) {
+	if _, err := ParseRemapRules([]byte(`{"version": 2, "rules": []}`)); err == nil {
+		t.Errorf("Expected an unknown version to be rejected")
+	}
+	if _, err := ParseRemapRules([]byte(`{"version": 1, "rules": [{"game_system": "A"}]}`)); err == nil {
+		t.Errorf("Expected an invalid rule to be rejected")
+	}
+	rules, err := ParseRemapRules([]byte(`{"version": 1, "rules": [{"game_system": "A", "new_game_system": "B"}]}`))
+	if err != nil || len(rules) != 1 || rules[0].NewGameSystem != "B" {
+		t.Errorf("Unexpected result %v, %v", rules, err)
+	}
+}
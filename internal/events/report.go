@@ -0,0 +1,135 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Past this many, the text report just gives a count. The json report always
+// has everything.
+const maxReportedIds = 20
+
+// ReportChange is a field change to one event.
+type ReportChange struct {
+	EventId  string `json:"event_id"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// CategoryReport is what an import would do to one category's events.
+type CategoryReport struct {
+	New         []string                       `json:"new"`
+	Deactivated []string                       `json:"deactivated"`
+	Reactivated []string                       `json:"reactivated"`
+	Changes     map[ChangeKind][]*ReportChange `json:"changes"`
+}
+
+// DiffReport summarizes the changes an import would make, grouped by
+// category, for a person deciding whether to run it.
+type DiffReport struct {
+	NumNew         int                        `json:"num_new"`
+	NumDeactivated int                        `json:"num_deactivated"`
+	NumReactivated int                        `json:"num_reactivated"`
+	NumChanged     int                        `json:"num_changed"`
+	Categories     map[string]*CategoryReport `json:"categories"`
+	// Why the limits would abort the import, if they would
+	AbortReason string `json:"abort_reason,omitempty"`
+}
+
+func NewDiffReport(changes []EventChange) *DiffReport {
+	report := &DiffReport{Categories: make(map[string]*CategoryReport)}
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		category := CategoryFromEvent(change.EventId)
+		categoryReport := report.Categories[category]
+		if categoryReport == nil {
+			categoryReport = &CategoryReport{
+				New:         make([]string, 0),
+				Deactivated: make([]string, 0),
+				Reactivated: make([]string, 0),
+				Changes:     make(map[ChangeKind][]*ReportChange),
+			}
+			report.Categories[category] = categoryReport
+		}
+
+		switch change.Kind {
+		case ChangeAdded:
+			report.NumNew++
+			categoryReport.New = append(categoryReport.New, change.EventId)
+		case ChangeCancelled:
+			report.NumDeactivated++
+			categoryReport.Deactivated = append(categoryReport.Deactivated, change.EventId)
+		case ChangeReactivated:
+			report.NumReactivated++
+			categoryReport.Reactivated = append(categoryReport.Reactivated, change.EventId)
+		default:
+			changed[change.EventId] = true
+			categoryReport.Changes[change.Kind] = append(categoryReport.Changes[change.Kind], &ReportChange{
+				EventId:  change.EventId,
+				OldValue: change.OldValue,
+				NewValue: change.NewValue,
+			})
+		}
+	}
+	report.NumChanged = len(changed)
+	return report
+}
+
+func writeReportIds(w io.Writer, label string, eventIds []string) {
+	if len(eventIds) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "    %v: %d\n", label, len(eventIds))
+	for i, eventId := range eventIds {
+		if i == maxReportedIds {
+			fmt.Fprintf(w, "      ... and %d more\n", len(eventIds)-i)
+			break
+		}
+		fmt.Fprintf(w, "      %v\n", eventId)
+	}
+}
+
+// WriteText writes the report for a person to read.
+func (r *DiffReport) WriteText(w io.Writer) {
+	if r.AbortReason != "" {
+		fmt.Fprintf(w, "Warning: %v\nUnless forced, nothing below would change.\n\n", r.AbortReason)
+	}
+	fmt.Fprintf(w, "New events:         %d\n", r.NumNew)
+	fmt.Fprintf(w, "Deactivated events: %d\n", r.NumDeactivated)
+	fmt.Fprintf(w, "Reactivated events: %d\n", r.NumReactivated)
+	fmt.Fprintf(w, "Changed events:     %d\n", r.NumChanged)
+
+	categories := make([]string, 0, len(r.Categories))
+	for category := range r.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	for _, category := range categories {
+		categoryReport := r.Categories[category]
+		fmt.Fprintf(w, "\n%v\n", LongCategory(category))
+		writeReportIds(w, "New", categoryReport.New)
+		writeReportIds(w, "Deactivated", categoryReport.Deactivated)
+		writeReportIds(w, "Reactivated", categoryReport.Reactivated)
+
+		kinds := make([]ChangeKind, 0, len(categoryReport.Changes))
+		for kind := range categoryReport.Changes {
+			kinds = append(kinds, kind)
+		}
+		sort.Slice(kinds, func(i, j int) bool {
+			return changeKindOrder[kinds[i]] < changeKindOrder[kinds[j]]
+		})
+		for _, kind := range kinds {
+			kindChanges := categoryReport.Changes[kind]
+			fmt.Fprintf(w, "    %v changed: %d\n", kind, len(kindChanges))
+			for i, change := range kindChanges {
+				if i == maxReportedIds {
+					fmt.Fprintf(w, "      ... and %d more\n", len(kindChanges)-i)
+					break
+				}
+				fmt.Fprintf(w, "      %v: %v -> %v\n", change.EventId, change.OldValue, change.NewValue)
+			}
+		}
+	}
+}
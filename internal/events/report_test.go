@@ -0,0 +1,50 @@
+package events
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffReport(t *testing.T) {
+	changes := []EventChange{
+		{EventId: "BGM23ND00001", Kind: ChangeAdded},
+		{EventId: "BGM23ND00002", Kind: ChangeCancelled},
+		{EventId: "BGM23ND00003", Kind: ChangeRoom, OldValue: "ICC / Hall D", NewValue: "ICC / Hall E"},
+		{EventId: "BGM23ND00003", Kind: ChangeCost, OldValue: "4", NewValue: "6"},
+		{EventId: "RPG23ND00001", Kind: ChangeCost, OldValue: "2", NewValue: "0"},
+		{EventId: "RPG23ND00002", Kind: ChangeReactivated},
+	}
+	report := NewDiffReport(changes)
+
+	if report.NumNew != 1 || report.NumDeactivated != 1 || report.NumReactivated != 1 || report.NumChanged != 2 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+	bgm, rpg := report.Categories["BGM"], report.Categories["RPG"]
+	if bgm == nil || rpg == nil || len(report.Categories) != 2 {
+		t.Fatalf("Expected BGM and RPG categories, got %v", report.Categories)
+	}
+	if len(bgm.New) != 1 || len(bgm.Deactivated) != 1 || len(bgm.Changes[ChangeRoom]) != 1 || len(bgm.Changes[ChangeCost]) != 1 {
+		t.Errorf("Unexpected BGM report %+v", bgm)
+	}
+	if len(rpg.Reactivated) != 1 || rpg.Changes[ChangeCost][0].NewValue != "0" {
+		t.Errorf("Unexpected RPG report %+v", rpg)
+	}
+
+	var text bytes.Buffer
+	report.WriteText(&text)
+	for _, expected := range []string{
+		"New events:         1",
+		"Board Games",
+		"      BGM23ND00003: ICC / Hall D -> ICC / Hall E",
+		"    cost changed: 1",
+	} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("Expected %q in report:\n%v", expected, text.String())
+		}
+	}
+	// Room changes are listed before cost changes
+	if strings.Index(text.String(), "room changed") > strings.Index(text.String(), "cost changed") {
+		t.Errorf("Expected changes in kind order:\n%v", text.String())
+	}
+}
@@ -0,0 +1,35 @@
+package events
+
+// Requirement is one of the fixed choices the catalog has for an event's age
+// or experience requirement. The catalog follows the label with details, like
+// "Teen (13+)", so matching is on the label as a prefix.
+type Requirement struct {
+	Key   string
+	Label string
+}
+
+// AgeGroups are the age requirements, youngest first.
+var AgeGroups = []Requirement{
+	{"kids", "Kids Only"},
+	{"everyone", "Everyone"},
+	{"teen", "Teen"},
+	{"mature", "Mature"},
+	{"adults", "Adults Only"},
+}
+
+// ExperienceLevels are the experience requirements, least first.
+var ExperienceLevels = []Requirement{
+	{"none", "None"},
+	{"some", "Some"},
+	{"expert", "Expert"},
+}
+
+// FindRequirement finds the requirement with a key, if there is one.
+func FindRequirement(requirements []Requirement, key string) (Requirement, bool) {
+	for _, requirement := range requirements {
+		if requirement.Key == key {
+			return requirement, true
+		}
+	}
+	return Requirement{}, false
+}
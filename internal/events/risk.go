@@ -0,0 +1,202 @@
+package events
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TicketCount is how many tickets an event had as of a point in time.
+type TicketCount struct {
+	At      time.Time
+	Tickets int
+}
+
+const (
+	// Only this much of an event's recent history counts toward its own
+	// sales rate. Registration day is nothing like a month later.
+	salesWindow = 72 * time.Hour
+	// The prior counts as much as this many hours of an event's own history,
+	// so a new event leans on its category until it has a track record.
+	priorWeightHours = 24.0
+	// A game system needs this many past events before its prior is used
+	// instead of the category's.
+	minSystemSamples = 5
+)
+
+// SellOutEstimate is how fast an event is selling and when it'll run out at
+// that pace. HoursToSellOut is 0 for sold out events and +Inf for events
+// that aren't selling.
+type SellOutEstimate struct {
+	RatePerHour    float64
+	HoursToSellOut float64
+}
+
+// Risk maps the time until sell out onto 0 to 1, where 1 is sold out and
+// an event a day from selling out is 0.5.
+func (e SellOutEstimate) Risk() float64 {
+	return SellOutRisk(e.HoursToSellOut)
+}
+
+func SellOutRisk(hoursToSellOut float64) float64 {
+	if math.IsInf(hoursToSellOut, 1) || math.IsNaN(hoursToSellOut) {
+		return 0
+	}
+	return 1 / (1 + math.Max(hoursToSellOut, 0)/24)
+}
+
+// sortTicketCounts orders history oldest first, which everything below
+// assumes.
+func sortTicketCounts(history []TicketCount) {
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].At.Before(history[j].At)
+	})
+}
+
+// recentSalesRate is the tickets sold per hour over the sales window ending
+// at now, along with how many hours of history that covers. A count holds
+// until the next observation, and counts going up (Gen Con adding seats)
+// aren't negative sales.
+func recentSalesRate(history []TicketCount, now time.Time) (float64, float64) {
+	if len(history) == 0 {
+		return 0, 0
+	}
+	windowStart := now.Add(-salesWindow)
+	if history[0].At.After(windowStart) {
+		windowStart = history[0].At
+	}
+	hours := now.Sub(windowStart).Hours()
+	if hours <= 0 {
+		return 0, 0
+	}
+
+	sold := 0
+	for i := 1; i < len(history); i++ {
+		if history[i].At.Before(windowStart) || history[i].At.After(now) {
+			continue
+		}
+		if drop := history[i-1].Tickets - history[i].Tickets; drop > 0 {
+			sold += drop
+		}
+	}
+	return float64(sold) / hours, hours
+}
+
+type priorStat struct {
+	total   float64
+	samples int
+}
+
+func (s *priorStat) add(value float64) {
+	s.total += value
+	s.samples++
+}
+
+func (s *priorStat) mean() float64 {
+	if s == nil || s.samples == 0 {
+		return 0
+	}
+	return s.total / float64(s.samples)
+}
+
+// SellOutPriors are how fast past events sold, as a fraction of their seats
+// per hour, by category and game system.
+type SellOutPriors struct {
+	all        priorStat
+	categories map[string]*priorStat
+	systems    map[string]*priorStat
+}
+
+func NewSellOutPriors() *SellOutPriors {
+	return &SellOutPriors{
+		categories: make(map[string]*priorStat),
+		systems:    make(map[string]*priorStat),
+	}
+}
+
+// Add records a past event's sales. Its rate runs from the first
+// observation until it stopped selling, either by selling out or by its
+// last sale.
+func (p *SellOutPriors) Add(category, gameSystem string, history []TicketCount) {
+	if len(history) < 2 {
+		return
+	}
+	sortTicketCounts(history)
+
+	capacity := 0
+	sold := 0
+	lastSale := history[0].At
+	for i, count := range history {
+		if count.Tickets > capacity {
+			capacity = count.Tickets
+		}
+		if i > 0 {
+			if drop := history[i-1].Tickets - count.Tickets; drop > 0 {
+				sold += drop
+				lastSale = count.At
+			}
+		}
+	}
+	if capacity == 0 {
+		return
+	}
+
+	rate := 0.0
+	if hours := lastSale.Sub(history[0].At).Hours(); hours > 0 {
+		rate = float64(sold) / float64(capacity) / hours
+	}
+	p.all.add(rate)
+	if p.categories[category] == nil {
+		p.categories[category] = &priorStat{}
+	}
+	p.categories[category].add(rate)
+	if gameSystem != "" {
+		if p.systems[gameSystem] == nil {
+			p.systems[gameSystem] = &priorStat{}
+		}
+		p.systems[gameSystem].add(rate)
+	}
+}
+
+// rate is the expected fraction of seats sold per hour, from the most
+// specific group with enough history.
+func (p *SellOutPriors) rate(category, gameSystem string) float64 {
+	if p == nil {
+		return 0
+	}
+	if system := p.systems[gameSystem]; system != nil && system.samples >= minSystemSamples {
+		return system.mean()
+	}
+	if cat := p.categories[category]; cat != nil && cat.samples > 0 {
+		return cat.mean()
+	}
+	return p.all.mean()
+}
+
+// EstimateSellOut projects when an event will run out of tickets, blending
+// its own recent sales with how similar events sold in past years.
+func EstimateSellOut(category, gameSystem string, tickets int, history []TicketCount, priors *SellOutPriors, now time.Time) SellOutEstimate {
+	sortTicketCounts(history)
+
+	capacity := tickets
+	for _, count := range history {
+		if count.Tickets > capacity {
+			capacity = count.Tickets
+		}
+	}
+
+	ownRate, ownHours := recentSalesRate(history, now)
+	priorRate := priors.rate(category, gameSystem) * float64(capacity)
+	rate := (ownRate*ownHours + priorRate*priorWeightHours) / (ownHours + priorWeightHours)
+
+	estimate := SellOutEstimate{RatePerHour: rate}
+	switch {
+	case tickets <= 0:
+		estimate.HoursToSellOut = 0
+	case rate <= 0:
+		estimate.HoursToSellOut = math.Inf(1)
+	default:
+		estimate.HoursToSellOut = float64(tickets) / rate
+	}
+	return estimate
+}
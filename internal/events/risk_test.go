@@ -0,0 +1,86 @@
+package events
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var riskNow = time.Date(2023, time.May, 10, 12, 0, 0, 0, time.UTC)
+
+func hoursAgo(hours int, tickets int) TicketCount {
+	return TicketCount{At: riskNow.Add(-time.Duration(hours) * time.Hour), Tickets: tickets}
+}
+
+func TestRecentSalesRate(t *testing.T) {
+	history := []TicketCount{
+		// Before the window, only sets the starting count
+		hoursAgo(200, 50),
+		hoursAgo(100, 40),
+		hoursAgo(48, 30),
+		// Gen Con added seats, not negative sales
+		hoursAgo(24, 36),
+		hoursAgo(12, 30),
+	}
+	rate, hours := recentSalesRate(history, riskNow)
+	if hours != 72 {
+		t.Errorf("Expected 72 hours of history, got %v", hours)
+	}
+	// 10 at 48 hours ago, 6 at 12 hours ago
+	if math.Abs(rate-16.0/72) > 1e-9 {
+		t.Errorf("Expected rate %v, got %v", 16.0/72, rate)
+	}
+}
+
+func TestEstimateSellOutOwnHistory(t *testing.T) {
+	// Selling 1 ticket an hour, with no prior to pull it around
+	history := []TicketCount{hoursAgo(72, 82), hoursAgo(36, 46), hoursAgo(0, 10)}
+	estimate := EstimateSellOut("BGM", "Catan", 10, history, nil, riskNow)
+
+	// Blended with a zero prior: 72 hours of 1/hour plus 24 hours of 0
+	expectedRate := 72.0 / 96
+	if math.Abs(estimate.RatePerHour-expectedRate) > 1e-9 {
+		t.Errorf("Expected rate %v, got %v", expectedRate, estimate.RatePerHour)
+	}
+	if math.Abs(estimate.HoursToSellOut-10/expectedRate) > 1e-9 {
+		t.Errorf("Expected %v hours, got %v", 10/expectedRate, estimate.HoursToSellOut)
+	}
+}
+
+func TestEstimateSellOutPriors(t *testing.T) {
+	priors := NewSellOutPriors()
+	// Past RPG events sold half their seats over 10 hours, 5% an hour
+	for i := 0; i < 3; i++ {
+		priors.Add("RPG", "Starfinder", []TicketCount{hoursAgo(20, 6), hoursAgo(10, 3)})
+	}
+	// No Pathfinder events to go on, so the category is used
+	if rate := priors.rate("RPG", "Pathfinder"); math.Abs(rate-0.05) > 1e-9 {
+		t.Errorf("Expected category rate 0.05, got %v", rate)
+	}
+	for i := 0; i < minSystemSamples; i++ {
+		priors.Add("RPG", "Pathfinder", []TicketCount{hoursAgo(20, 10), hoursAgo(10, 0)})
+	}
+	if rate := priors.rate("RPG", "Pathfinder"); math.Abs(rate-0.1) > 1e-9 {
+		t.Errorf("Expected system rate 0.1, got %v", rate)
+	}
+
+	// A brand new event with no history gets the prior alone
+	estimate := EstimateSellOut("RPG", "Pathfinder", 6, []TicketCount{hoursAgo(0, 6)}, priors, riskNow)
+	if math.Abs(estimate.RatePerHour-0.6) > 1e-9 || math.Abs(estimate.HoursToSellOut-10) > 1e-9 {
+		t.Errorf("Unexpected estimate %+v", estimate)
+	}
+}
+
+func TestEstimateSellOutEdges(t *testing.T) {
+	soldOut := EstimateSellOut("BGM", "", 0, []TicketCount{hoursAgo(10, 4), hoursAgo(0, 0)}, nil, riskNow)
+	if soldOut.HoursToSellOut != 0 || soldOut.Risk() != 1 {
+		t.Errorf("Expected sold out, got %+v", soldOut)
+	}
+	stalled := EstimateSellOut("BGM", "", 4, []TicketCount{hoursAgo(10, 4)}, nil, riskNow)
+	if !math.IsInf(stalled.HoursToSellOut, 1) || stalled.Risk() != 0 {
+		t.Errorf("Expected no sell out, got %+v", stalled)
+	}
+	if risk := SellOutRisk(24); risk != 0.5 {
+		t.Errorf("Expected a day out to be 0.5, got %v", risk)
+	}
+}
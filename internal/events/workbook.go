@@ -0,0 +1,424 @@
+package events
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal reader for the parts of the xlsx format we need: the first
+// worksheet, shared strings and enough of the styles to know which numeric
+// cells are really dates. Gen Con's own export only uses inline strings, but
+// once someone opens and re-saves it in Excel or LibreOffice, all of these
+// show up.
+
+type relationship struct {
+	Id     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type relationships struct {
+	Relationships []relationship `xml:"Relationship"`
+}
+
+type workbookXml struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		RelId string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// richText is the shape of both shared strings and inline strings, either a
+// single <t> or several formatted runs which each have their own <t>.
+type richText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt *richText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.Text
+	}
+	var sb strings.Builder
+	for _, run := range rt.Runs {
+		sb.WriteString(run.Text)
+	}
+	return sb.String()
+}
+
+type sharedStringsXml struct {
+	Items []richText `xml:"si"`
+}
+
+type stylesXml struct {
+	NumFmts []struct {
+		Id         int    `xml:"numFmtId,attr"`
+		FormatCode string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtId int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type excelCell struct {
+	Type   string   `xml:"t,attr"`
+	CellId string   `xml:"r,attr"`
+	Style  int      `xml:"s,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+type excelRow struct {
+	RowNum int         `xml:"r,attr"`
+	Cells  []excelCell `xml:"c"`
+}
+
+// cellValue is a cell with shared strings, numbers and dates resolved.
+type cellValue struct {
+	Text     string
+	Number   float64
+	IsNumber bool
+	Time     time.Time
+	IsTime   bool
+}
+
+type workbook struct {
+	files         map[string]*zip.File
+	sheetPath     string
+	sharedStrings []string
+	dateStyles    map[int]bool
+	date1904      bool
+}
+
+func openWorkbook(rawBytes []byte) (*workbook, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(rawBytes), (int64)(len(rawBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+	wb := &workbook{
+		files:      make(map[string]*zip.File, len(zipReader.File)),
+		dateStyles: make(map[int]bool),
+	}
+	for _, f := range zipReader.File {
+		wb.files[f.Name] = f
+	}
+
+	// The package relationships point at the workbook, which is almost
+	// always xl/workbook.xml, but don't count on it.
+	workbookPath := "xl/workbook.xml"
+	var rootRels relationships
+	if found, err := wb.decode("_rels/.rels", &rootRels); err != nil {
+		return nil, err
+	} else if found {
+		for _, rel := range rootRels.Relationships {
+			if strings.HasSuffix(rel.Type, "/officeDocument") {
+				workbookPath = resolvePart("", rel.Target)
+			}
+		}
+	}
+
+	var book workbookXml
+	if found, err := wb.decode(workbookPath, &book); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("xlsx has no workbook at %s", workbookPath)
+	}
+	wb.date1904 = book.Properties.Date1904 == "1" || book.Properties.Date1904 == "true"
+	if len(book.Sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	workbookDir := path.Dir(workbookPath)
+	relsPath := path.Join(workbookDir, "_rels", path.Base(workbookPath)+".rels")
+	var bookRels relationships
+	if _, err := wb.decode(relsPath, &bookRels); err != nil {
+		return nil, err
+	}
+	sharedStringsPath := ""
+	stylesPath := ""
+	for _, rel := range bookRels.Relationships {
+		target := resolvePart(workbookDir, rel.Target)
+		switch {
+		case rel.Id == book.Sheets[0].RelId:
+			wb.sheetPath = target
+		case strings.HasSuffix(rel.Type, "/sharedStrings"):
+			sharedStringsPath = target
+		case strings.HasSuffix(rel.Type, "/styles"):
+			stylesPath = target
+		}
+	}
+	if wb.sheetPath == "" {
+		return nil, fmt.Errorf("can't find sheet %q in workbook", book.Sheets[0].Name)
+	}
+
+	if sharedStringsPath != "" {
+		var sst sharedStringsXml
+		if _, err := wb.decode(sharedStringsPath, &sst); err != nil {
+			return nil, err
+		}
+		wb.sharedStrings = make([]string, len(sst.Items))
+		for i := range sst.Items {
+			wb.sharedStrings[i] = sst.Items[i].String()
+		}
+	}
+
+	if stylesPath != "" {
+		var styles stylesXml
+		if _, err := wb.decode(stylesPath, &styles); err != nil {
+			return nil, err
+		}
+		customFormats := make(map[int]string)
+		for _, f := range styles.NumFmts {
+			customFormats[f.Id] = f.FormatCode
+		}
+		for i, xf := range styles.CellXfs {
+			if code, found := customFormats[xf.NumFmtId]; found {
+				wb.dateStyles[i] = isDateFormat(code)
+			} else {
+				wb.dateStyles[i] = isBuiltinDateFormat(xf.NumFmtId)
+			}
+		}
+	}
+
+	return wb, nil
+}
+
+// resolvePart turns a relationship target into a path within the zip.
+// Targets are relative to the part that owns the relationship, unless they
+// start with a slash.
+func resolvePart(baseDir string, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(baseDir, target)
+}
+
+// decode unmarshals the named part into v, reporting false if the part
+// doesn't exist.
+func (wb *workbook) decode(name string, v interface{}) (bool, error) {
+	f, found := wb.files[name]
+	if !found {
+		return false, nil
+	}
+	reader, err := f.Open()
+	if err != nil {
+		return true, err
+	}
+	defer reader.Close()
+	if err = xml.NewDecoder(reader).Decode(v); err != nil {
+		return true, fmt.Errorf("unable to parse %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// eachRow streams the rows of the first sheet, since the full sheet is
+// large enough that we don't want to unmarshal it all at once.
+func (wb *workbook) eachRow(fn func(rowNum int, cells []cellValue) error) error {
+	f := wb.files[wb.sheetPath]
+	if f == nil {
+		return fmt.Errorf("xlsx is missing %s", wb.sheetPath)
+	}
+	reader, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decoder := xml.NewDecoder(reader)
+	rowNum := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("unable to parse %s: %w", wb.sheetPath, err)
+		}
+		t, ok := token.(xml.StartElement)
+		if !ok || t.Name.Local != "row" {
+			continue
+		}
+		var row excelRow
+		if err = decoder.DecodeElement(&row, &t); err != nil {
+			return fmt.Errorf("unable to parse row after %d: %w", rowNum, err)
+		}
+		// The row number is optional, when missing it follows the previous row
+		if row.RowNum > 0 {
+			rowNum = row.RowNum
+		} else {
+			rowNum++
+		}
+		cells, err := wb.resolveCells(&row)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", rowNum, err)
+		}
+		if err = fn(rowNum, cells); err != nil {
+			return err
+		}
+	}
+}
+
+// resolveCells lays the row's cells out by column. Excel omits empty cells
+// entirely, so the n-th cell in the row isn't necessarily in the n-th column.
+func (wb *workbook) resolveCells(row *excelRow) ([]cellValue, error) {
+	var cells []cellValue
+	for i, cell := range row.Cells {
+		col := cellColumn(cell.CellId)
+		if col < 0 {
+			col = i
+		}
+		for len(cells) <= col {
+			cells = append(cells, cellValue{})
+		}
+		value, err := wb.resolveCell(&cell)
+		if err != nil {
+			return nil, fmt.Errorf("cell %s: %w", cell.CellId, err)
+		}
+		cells[col] = value
+	}
+	return cells, nil
+}
+
+func (wb *workbook) resolveCell(cell *excelCell) (cellValue, error) {
+	switch cell.Type {
+	case "inlineStr":
+		return cellValue{Text: cell.Inline.String()}, nil
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || index < 0 || index >= len(wb.sharedStrings) {
+			return cellValue{}, fmt.Errorf("bad shared string index %q", cell.Value)
+		}
+		return cellValue{Text: wb.sharedStrings[index]}, nil
+	case "str", "e":
+		// Formula results and errors, both are stored as plain text
+		return cellValue{Text: cell.Value}, nil
+	case "b":
+		if cell.Value == "1" {
+			return cellValue{Text: "TRUE", Number: 1, IsNumber: true}, nil
+		}
+		return cellValue{Text: "FALSE", IsNumber: true}, nil
+	case "d":
+		// ISO 8601 dates, only written by some non-Excel tools
+		parsed, err := time.ParseInLocation("2006-01-02T15:04:05", cell.Value, indianapolis())
+		if err != nil {
+			// Leave it as text, reading the field will report the problem
+			return cellValue{Text: cell.Value}, nil
+		}
+		return cellValue{Text: cell.Value, Time: parsed, IsTime: true}, nil
+	}
+
+	// Numeric, the default when there's no type. Some writers leave the
+	// inline string in place without setting the type, so honor that too.
+	if cell.Value == "" {
+		return cellValue{Text: cell.Inline.String()}, nil
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(cell.Value), 64)
+	if err != nil {
+		// Leave it as text, reading the field will report the problem
+		return cellValue{Text: cell.Value}, nil
+	}
+	value := cellValue{
+		Text:     formatNumber(number),
+		Number:   number,
+		IsNumber: true,
+	}
+	if wb.dateStyles[cell.Style] {
+		value.Time = excelTime(number, wb.date1904)
+		value.IsTime = true
+	}
+	return value, nil
+}
+
+// formatNumber renders whole numbers without a decimal point, so that room
+// and table numbers come out as "12" rather than "12.000000".
+func formatNumber(number float64) string {
+	if number == math.Trunc(number) && math.Abs(number) < 1e15 {
+		return strconv.FormatInt(int64(number), 10)
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// excelTime converts a serial date to a time. Serial dates are days since
+// the workbook's epoch, with the time of day as the fraction. They have no
+// time zone, and everything at Gen Con happens in Indianapolis.
+func excelTime(serial float64, date1904 bool) time.Time {
+	epoch := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, time.January, 1, 0, 0, 0, 0, time.UTC)
+	} else if serial < 60 {
+		// Excel treats 1900 as a leap year for Lotus 1-2-3 compatibility, so
+		// serials before the phantom Feb 29th are off by one.
+		serial++
+	}
+	wallClock := epoch.Add(time.Duration(math.Round(serial*24*60*60)) * time.Second)
+	return time.Date(wallClock.Year(), wallClock.Month(), wallClock.Day(),
+		wallClock.Hour(), wallClock.Minute(), wallClock.Second(), 0, indianapolis())
+}
+
+// isBuiltinDateFormat reports whether one of the number formats predefined
+// by the spec, which aren't listed in styles.xml, is a date or time.
+func isBuiltinDateFormat(numFmtId int) bool {
+	return (numFmtId >= 14 && numFmtId <= 22) ||
+		(numFmtId >= 27 && numFmtId <= 36) ||
+		(numFmtId >= 45 && numFmtId <= 47) ||
+		(numFmtId >= 50 && numFmtId <= 58)
+}
+
+// isDateFormat reports whether a custom number format displays a date or
+// time, ignoring quoted literals, escaped characters and [color] sections.
+func isDateFormat(formatCode string) bool {
+	for i := 0; i < len(formatCode); i++ {
+		c := formatCode[i]
+		switch {
+		case c == '"':
+			end := strings.IndexByte(formatCode[i+1:], '"')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case c == '[':
+			end := strings.IndexByte(formatCode[i+1:], ']')
+			if end < 0 {
+				return false
+			}
+			// Elapsed time, like [h]:mm, as opposed to [Red] or [$-409]
+			section := strings.Trim(formatCode[i+1:i+1+end], "hHmMsS")
+			if end > 0 && section == "" {
+				return true
+			}
+			i += end + 1
+		case c == '\\' || c == '_' || c == '*':
+			// The next character is a literal or padding
+			i++
+		case strings.IndexByte("dDmMyYhHsS", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// cellColumn returns the zero-based column index from a cell reference like
+// "AB12", or -1 if the reference doesn't start with a column.
+func cellColumn(cellId string) int {
+	index := 0
+	i := 0
+	for ; i < len(cellId) && cellId[i] >= 'A' && cellId[i] <= 'Z'; i++ {
+		index = index*26 + int(cellId[i]-'A') + 1
+	}
+	if i == 0 {
+		return -1
+	}
+	return index - 1
+}
@@ -0,0 +1,322 @@
+package events
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+const (
+	contentTypesXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`
+	rootRelsXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	singleSheetWorkbookXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Events" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	singleSheetRelsXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+)
+
+// buildXlsx zips up the given parts, filling in the package boilerplate
+// that isn't part of the test.
+func buildXlsx(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	defaults := map[string]string{
+		"[Content_Types].xml":        contentTypesXml,
+		"_rels/.rels":                rootRelsXml,
+		"xl/workbook.xml":            singleSheetWorkbookXml,
+		"xl/_rels/workbook.xml.rels": singleSheetRelsXml,
+	}
+	for name, contents := range parts {
+		defaults[name] = contents
+	}
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range defaults {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sheetXml(rows string) string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		rows + `</sheetData></worksheet>`
+}
+
+const inlineHeaderRow = `<row r="1">
+<c r="A1" t="inlineStr"><is><t>Game ID</t></is></c>
+<c r="B1" t="inlineStr"><is><t>Title</t></is></c>
+<c r="C1" t="inlineStr"><is><t>Event Type</t></is></c>
+<c r="D1" t="inlineStr"><is><t>Start Date &amp; Time</t></is></c>
+<c r="E1" t="inlineStr"><is><t>Duration</t></is></c>
+<c r="F1" t="inlineStr"><is><t>Room Name</t></is></c>
+<c r="G1" t="inlineStr"><is><t>Tickets Available</t></is></c>
+<c r="H1" t="inlineStr"><is><t>Last Modified</t></is></c>
+</row>`
+
+func TestParseInlineStrings(t *testing.T) {
+	// This is the shape of the sheet as Gen Con publishes it
+	raw := buildXlsx(t, map[string]string{
+		"xl/workbook.xml":            `<workbook><sheets><sheet name="Events" sheetId="1" r:id="rId1" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": sheetXml(inlineHeaderRow + `<row r="2">
+<c r="A2" t="inlineStr"><is><t>BGM23ND12345</t></is></c>
+<c r="B2" t="inlineStr"><is><t>Learn to Play</t></is></c>
+<c r="C2" t="inlineStr"><is><t>BGM - Board Game</t></is></c>
+<c r="D2" t="inlineStr"><is><t>08/03/2023 03:00 PM</t></is></c>
+<c r="E2"><v>1.5</v></c>
+<c r="F2"><v>12</v></c>
+<c r="H2"><v>45139.5</v></c>
+</row>`),
+	})
+
+	parsed, rowErrors, err := ParseGenconSheet(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("Unexpected row errors: %v", rowErrors)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(parsed))
+	}
+	e := parsed[0]
+	if e.EventId != "BGM23ND12345" || e.Title != "Learn to Play" || e.Duration != 90 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if e.RoomName != "Room 12" {
+		t.Errorf("Expected numeric room to be named, got %q", e.RoomName)
+	}
+	// The tickets cell was omitted entirely, which shouldn't shift anything
+	if e.TicketsAvailable != 0 {
+		t.Errorf("Expected no tickets, got %d", e.TicketsAvailable)
+	}
+	if e.StartTime.Hour() != 15 || e.StartTime.Day() != 3 {
+		t.Errorf("Unexpected start time %v", e.StartTime)
+	}
+	if e.LastModified.Year() != 2023 || e.LastModified.Month() != time.August ||
+		e.LastModified.Day() != 1 || e.LastModified.Hour() != 12 {
+		t.Errorf("Unexpected last modified %v", e.LastModified)
+	}
+}
+
+func TestParseSharedStringsAndDateStyles(t *testing.T) {
+	// What the sheet looks like after a round trip through Excel
+	raw := buildXlsx(t, map[string]string{
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="9" uniqueCount="9">
+<si><t>Game ID</t></si>
+<si><t>Title</t></si>
+<si><t>Event Type</t></si>
+<si><t>Start Date &amp; Time</t></si>
+<si><t>Duration</t></si>
+<si><t>Last Modified</t></si>
+<si><t>RPG23ND00042</t></si>
+<si><r><rPr><b/></rPr><t>Dragons</t></r><r><t xml:space="preserve"> and Dungeons</t></r></si>
+<si><t>RPG - Role Playing Game</t></si>
+</sst>`,
+		"xl/styles.xml": `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="mm/dd/yyyy\ hh:mm\ AM/PM"/></numFmts>
+<cellStyleXfs count="1"><xf numFmtId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="164" applyNumberFormat="1"/><xf numFmtId="22" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`,
+		"xl/worksheets/sheet1.xml": sheetXml(`<row r="1">
+<c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c>
+<c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>4</v></c><c r="F1" t="s"><v>5</v></c>
+</row>
+<row r="2">
+<c r="A2" t="s"><v>6</v></c><c r="B2" t="s"><v>7</v></c><c r="C2" t="s"><v>8</v></c>
+<c r="D2" s="1"><v>45141.625</v></c><c r="E2"><v>4</v></c><c r="F2" s="2"><v>45139.25</v></c>
+</row>
+<row r="3"><c r="A3" s="1"/></row>`),
+	})
+
+	parsed, rowErrors, err := ParseGenconSheet(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("Unexpected row errors: %v", rowErrors)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("Expected 1 event, blank rows skipped, got %d", len(parsed))
+	}
+	e := parsed[0]
+	if e.EventId != "RPG23ND00042" || e.ShortCategory != "RPG" || e.Year != 2023 {
+		t.Errorf("Unexpected id fields %+v", e)
+	}
+	if e.Title != "Dragons and Dungeons" {
+		t.Errorf("Expected rich text runs to be joined, got %q", e.Title)
+	}
+	if e.StartTime.Weekday() != time.Thursday || e.StartTime.Hour() != 15 {
+		t.Errorf("Expected Thursday 3pm, got %v", e.StartTime)
+	}
+	if e.EndTime.Hour() != 19 {
+		t.Errorf("Expected 7pm end, got %v", e.EndTime)
+	}
+	if _, offset := e.StartTime.Zone(); offset != -4*60*60 {
+		t.Errorf("Expected EDT, got offset %v", offset)
+	}
+	if e.LastModified.Day() != 1 || e.LastModified.Hour() != 6 {
+		t.Errorf("Unexpected last modified %v", e.LastModified)
+	}
+}
+
+func TestParseDate1904AndSheetOrder(t *testing.T) {
+	// The first sheet in the workbook isn't sheet1.xml, which holds notes
+	raw := buildXlsx(t, map[string]string{
+		"_rels/.rels": `<Relationships><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="/xl/workbook.xml"/></Relationships>`,
+		"xl/workbook.xml": `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<workbookPr date1904="true"/>
+<sheets><sheet name="Events" sheetId="2" r:id="rId7"/><sheet name="Notes" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId7" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`,
+		"xl/styles.xml":            `<styleSheet><cellXfs><xf numFmtId="0"/><xf numFmtId="22"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": sheetXml(`<row r="1"><c r="A1" t="inlineStr"><is><t>Not the events</t></is></c></row>`),
+		"xl/worksheets/sheet2.xml": sheetXml(inlineHeaderRow + `<row r="2">
+<c r="A2" t="inlineStr"><is><t>TDA23ND00001</t></is></c>
+<c r="B2" t="inlineStr"><is><t>True Dungeon</t></is></c>
+<c r="C2" t="inlineStr"><is><t>TDA - True Dungeon</t></is></c>
+<c r="D2" s="1"><v>43679.625</v></c>
+<c r="E2"><v>2</v></c>
+<c r="F2" t="inlineStr"><is><t>Ballroom</t></is></c>
+<c r="G2"><v>8</v></c>
+</row>`),
+	})
+
+	parsed, rowErrors, err := ParseGenconSheet(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("Unexpected row errors: %v", rowErrors)
+	}
+	if len(parsed) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(parsed))
+	}
+	e := parsed[0]
+	if e.EventId != "TDA23ND00001" || e.RoomName != "Ballroom" || e.TicketsAvailable != 8 {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	expected := time.Date(2023, time.August, 3, 15, 0, 0, 0, indianapolis())
+	if !e.StartTime.Equal(expected) {
+		t.Errorf("Expected %v with the 1904 epoch, got %v", expected, e.StartTime)
+	}
+}
+
+func TestParseMissingColumn(t *testing.T) {
+	raw := buildXlsx(t, map[string]string{
+		"xl/worksheets/sheet1.xml": sheetXml(`<row r="1"><c r="A1" t="inlineStr"><is><t>Game ID</t></is></c></row>`),
+	})
+	if _, _, err := ParseGenconSheet(raw); err == nil {
+		t.Errorf("Expected an error for a sheet without required columns")
+	}
+}
+
+func TestParseNotXlsx(t *testing.T) {
+	if _, _, err := ParseGenconSheet([]byte("Game ID,Title\n")); err == nil {
+		t.Errorf("Expected an error for a non-zip file")
+	}
+}
+
+func TestExcelTime(t *testing.T) {
+	indy := indianapolis()
+	cases := []struct {
+		serial   float64
+		date1904 bool
+		expected time.Time
+	}{
+		{1, false, time.Date(1900, time.January, 1, 0, 0, 0, 0, indy)},
+		{61, false, time.Date(1900, time.March, 1, 0, 0, 0, 0, indy)},
+		{45141.625, false, time.Date(2023, time.August, 3, 15, 0, 0, 0, indy)},
+		{0, true, time.Date(1904, time.January, 1, 0, 0, 0, 0, indy)},
+		{43679.625, true, time.Date(2023, time.August, 3, 15, 0, 0, 0, indy)},
+	}
+	for _, c := range cases {
+		if got := excelTime(c.serial, c.date1904); !got.Equal(c.expected) {
+			t.Errorf("excelTime(%v, %v) = %v, expected %v", c.serial, c.date1904, got, c.expected)
+		}
+	}
+}
+
+func TestIsDateFormat(t *testing.T) {
+	cases := map[string]bool{
+		"General":               false,
+		"0.00":                  false,
+		"#,##0 \"days\"":        false,
+		"[Red]0.00":             false,
+		"[Magenta]#,##0":        false,
+		"mm/dd/yyyy":            true,
+		"[$-409]h:mm AM/PM":     true,
+		"[h]:mm":                true,
+		"yyyy\\-mm\\-dd":        true,
+		"0\\d":                  false,
+		"\"Day \"0":             false,
+		"dddd, mmmm dd, yyyy":   true,
+		"_(\"$\"* #,##0_)":      false,
+		"m/d/yy h:mm;@":         true,
+		"0.00E+00":              false,
+		"#,##0.00 [$€-1];[Red]": false,
+	}
+	for code, expected := range cases {
+		if got := isDateFormat(code); got != expected {
+			t.Errorf("isDateFormat(%q) = %v, expected %v", code, got, expected)
+		}
+	}
+}
+
+func TestParseBadRows(t *testing.T) {
+	raw := buildXlsx(t, map[string]string{
+		"xl/worksheets/sheet1.xml": sheetXml(inlineHeaderRow + `<row r="2">
+<c r="A2" t="inlineStr"><is><t>BGM23ND00001</t></is></c>
+<c r="B2" t="inlineStr"><is><t>Bad Duration</t></is></c>
+<c r="C2" t="inlineStr"><is><t>BGM - Board Game</t></is></c>
+<c r="D2" t="inlineStr"><is><t>08/03/2023 03:00 PM</t></is></c>
+<c r="E2" t="inlineStr"><is><t>two hours</t></is></c>
+</row>
+<row r="7">
+<c r="A7" t="inlineStr"><is><t>BGM23ND00002</t></is></c>
+<c r="B7" t="inlineStr"><is><t>Fine</t></is></c>
+<c r="C7" t="inlineStr"><is><t>BGM - Board Game</t></is></c>
+<c r="D7" t="inlineStr"><is><t>08/03/2023 03:00 PM</t></is></c>
+<c r="E7"><v>2</v></c>
+</row>`),
+	})
+
+	parsed, rowErrors, err := ParseGenconSheet(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(parsed) != 1 || parsed[0].EventId != "BGM23ND00002" {
+		t.Errorf("Expected only the good row, got %v", parsed)
+	}
+	if len(rowErrors) != 1 {
+		t.Fatalf("Expected 1 row error, got %v", rowErrors)
+	}
+	if rowErrors[0].Row != 2 || rowErrors[0].Column != string(colDuration) || rowErrors[0].Value != "two hours" {
+		t.Errorf("Unexpected row error %+v", rowErrors[0])
+	}
+}
@@ -1,155 +1,227 @@
 package events
 
 import (
-	"archive/zip"
-	"bytes"
-	"encoding/xml"
-	"io/ioutil"
+	"errors"
 	"strconv"
+	"strings"
 	"time"
 )
 
-type excelCell struct {
-	Type   string  `xml:"t,attr"`
-	CellId string  `xml:"r,attr"`
-	String string  `xml:"is>t"`
-	Number float64 `xml:"v"`
+func indianapolis() *time.Location {
+	location, _ := time.LoadLocation("America/Indianapolis")
+	return location
 }
 
-type excelRow struct {
-	Cells []excelCell `xml:"c"`
+func parseTime(dateString string) time.Time {
+	parsed, _ := parseTimeField(dateString)
+	return parsed
 }
 
-func parseTime(dateString string) time.Time {
+func parseTimeField(dateString string) (time.Time, error) {
 	// source format:			07/30/2015 03:00 PM
 	// canonical go time: 		Mon Jan 2 15:04:05 -0700 MST 2006
 	// reformatted canonical: 	01/02/2006 03:04 PM
-	location, _ := time.LoadLocation("America/Indianapolis")
-	parsed, _ := time.ParseInLocation(
+	return time.ParseInLocation(
 		"01/02/2006 03:04 PM",
 		dateString,
-		location)
-	return parsed
+		indianapolis())
 }
 
-func parseCellToString(cell excelCell) string {
-	value := cell.String
-	if value == "" {
-		if cell.Number != 0 {
-			value = strconv.FormatInt((int64)(cell.Number), 10)
+func parseCellToString(cell cellValue) string {
+	if cell.IsNumber && cell.Number == 0 {
+		return ""
+	}
+	return cell.Text
+}
+
+func parseRoom(cell cellValue) string {
+	if cell.IsNumber {
+		if cell.Number == 0 {
+			return ""
 		}
+		return "Room " + cell.Text
 	}
-	return value
+	return cell.Text
+}
+
+// Layouts Last Modified has shown up in, when it isn't an Excel date.
+var lastModifiedLayouts = []string{
+	"01/02/2006 03:04 PM",
+	"01/02/2006 15:04",
+	"01/02/2006",
+	"01-02-06",
+	"2006-01-02 15:04:05",
 }
 
-func parseRoom(cell excelCell) string {
-	value := cell.String
-	if value == "" {
-		if cell.Number != 0 {
-			value = "Room " + strconv.FormatInt((int64)(cell.Number), 10)
+// parseLastModified reads the Last Modified column. Gen Con's export doesn't
+// style it, but it's still a date, and csv exports have it as text. It's
+// informational only, so a bad value is left as the zero time rather than
+// rejecting the row.
+func parseLastModified(cell cellValue, date1904 bool) time.Time {
+	if cell.IsTime {
+		return cell.Time
+	}
+	if cell.IsNumber {
+		return excelTime(cell.Number, date1904)
+	}
+	text := strings.TrimSpace(cell.Text)
+	for _, layout := range lastModifiedLayouts {
+		if parsed, err := time.ParseInLocation(layout, text, indianapolis()); err == nil {
+			return parsed
 		}
 	}
-	return value
+	return time.Time{}
 }
 
-func rowToEvent(row *excelRow) *GenconEvent {
-	cells := row.Cells
-	startTime := parseTime(cells[14].String)
-	duration := (int)(60 * cells[15].Number)
+func headers(cells []cellValue) []string {
+	headers := make([]string, len(cells))
+	for i, cell := range cells {
+		headers[i] = cell.Text
+	}
+	return headers
+}
+
+// sheetRow is a data row from the spreadsheet, or a csv converted to cells,
+// addressed by logical column.
+type sheetRow struct {
+	rowErrors
+	cells   []cellValue
+	columns columnMap
+}
+
+func (r *sheetRow) cell(c column) cellValue {
+	i := r.columns.index(c)
+	if i < 0 || i >= len(r.cells) {
+		return cellValue{}
+	}
+	return r.cells[i]
+}
+
+func (r *sheetRow) str(c column) string {
+	return parseCellToString(r.cell(c))
+}
+
+// num reads a numeric cell, also accepting numbers that were stored as text.
+func (r *sheetRow) num(c column) float64 {
+	cell := r.cell(c)
+	if cell.IsNumber {
+		return cell.Number
+	}
+	text := strings.TrimSpace(cell.Text)
+	if text == "" {
+		return 0
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		r.fail(c, cell.Text, err)
+	}
+	return number
+}
+
+// time reads either a date formatted cell, or Gen Con's text timestamps.
+func (r *sheetRow) time(c column) time.Time {
+	cell := r.cell(c)
+	if cell.IsTime {
+		return cell.Time
+	}
+	parsed, err := parseTimeField(cell.Text)
+	if err != nil {
+		r.fail(c, cell.Text, err)
+	}
+	return parsed
+}
+
+func rowToEvent(row *sheetRow, date1904 bool) (*GenconEvent, *RowError) {
+	startTime := row.time(colStartTime)
+	duration := (int)(60 * row.num(colDuration))
 	// We don't trust the end time supplied in the sheet, it's disagreed
 	// with what gencon.com listed, so calculate based on duration
 	// time.Duration is in nano seconds, convert minutes to seconds
 	endTime := startTime.Add((time.Duration)(1e9 * 60 * duration))
 
-	eventId := cells[0].String
-	shortCategory, year, _, _ := splitId(eventId)
-
-	indy, _ := time.LoadLocation("America/Indianapolis")
-	excelReferenceDate := time.Date(1900, time.January, 01, 0, 0, 0, 0, indy)
-	// This doesn't quite get us the last update time, but it's close enough
-	lastModifiedDuration := (time.Duration)(cells[31].Number * (float64)(time.Hour) * 24)
-	lastModified := excelReferenceDate.Add(lastModifiedDuration)
+	eventId := row.str(colEventId)
+	id, err := ParseEventID(eventId)
+	if err != nil {
+		row.fail(colEventId, eventId, err)
+	}
 
-	return NormalizeEvent(&GenconEvent{
+	event := &GenconEvent{
 		EventId:              eventId,
-		Year:                 year,
+		Year:                 id.Year,
 		Active:               true,
-		Group:                cells[1].String,
-		Title:                parseCellToString(cells[2]),
-		ShortDescription:     cells[3].String,
-		LongDescription:      cells[4].String,
-		EventType:            cells[5].String,
-		GameSystem:           cells[6].String,
-		RulesEdition:         cells[7].String,
-		MinPlayers:           (int)(cells[8].Number),
-		MaxPlayers:           (int)(cells[9].Number),
-		AgeRequired:          cells[10].String,
-		ExperienceRequired:   cells[11].String,
-		MaterialsProvided:    cells[12].String == "Yes",
+		Group:                row.str(colGroup),
+		Title:                parseCellToString(row.cell(colTitle)),
+		ShortDescription:     row.str(colShortDescription),
+		LongDescription:      row.str(colLongDescription),
+		EventType:            row.str(colEventType),
+		GameSystem:           row.str(colGameSystem),
+		RulesEdition:         row.str(colRulesEdition),
+		MinPlayers:           (int)(row.num(colMinPlayers)),
+		MaxPlayers:           (int)(row.num(colMaxPlayers)),
+		AgeRequired:          row.str(colAgeRequired),
+		ExperienceRequired:   row.str(colExperienceRequired),
+		MaterialsProvided:    row.str(colMaterialsProvided) == "Yes",
 		StartTime:            startTime,
 		Duration:             duration,
 		EndTime:              endTime,
-		GMNames:              cells[17].String,
-		Website:              cells[18].String,
-		Email:                cells[19].String,
-		Tournament:           cells[20].String == "Yes",
-		RoundNumber:          (int)(cells[21].Number),
-		TotalRounds:          (int)(cells[22].Number),
-		MinPlayTime:          (int)(60 * cells[23].Number),
-		AttendeeRegistration: cells[24].String,
-		Cost:                 (int)(cells[25].Number),
-		Location:             cells[26].String,
-		RoomName:             parseRoom(cells[27]),
-		TableNumber:          parseCellToString(cells[28]),
-		SpecialCategory:      cells[29].String,
-		TicketsAvailable:     (int)(cells[30].Number),
-		LastModified:         lastModified,
-		ShortCategory:        shortCategory,
-	})
+		GMNames:              row.str(colGMNames),
+		Website:              row.str(colWebsite),
+		Email:                row.str(colEmail),
+		Tournament:           row.str(colTournament) == "Yes",
+		RoundNumber:          (int)(row.num(colRoundNumber)),
+		TotalRounds:          (int)(row.num(colTotalRounds)),
+		MinPlayTime:          (int)(60 * row.num(colMinPlayTime)),
+		AttendeeRegistration: row.str(colAttendeeRegistration),
+		Cost:                 (int)(row.num(colCost)),
+		Location:             row.str(colLocation),
+		RoomName:             parseRoom(row.cell(colRoomName)),
+		TableNumber:          parseCellToString(row.cell(colTableNumber)),
+		SpecialCategory:      row.str(colSpecialCategory),
+		TicketsAvailable:     (int)(row.num(colTicketsAvailable)),
+		LastModified:         parseLastModified(row.cell(colLastModified), date1904),
+		ShortCategory:        id.Category,
+	}
+	if row.err != nil {
+		return nil, row.err
+	}
+	return NormalizeEvent(event), nil
 }
 
-func ParseGenconSheet(rawBytes []byte) []*GenconEvent {
-	zipReader, err := zip.NewReader(bytes.NewReader(rawBytes), (int64)(len(rawBytes)))
+func ParseGenconSheet(rawBytes []byte) ([]*GenconEvent, []RowError, error) {
+	wb, err := openWorkbook(rawBytes)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 
-	var sheet *zip.File
-	for i := 0; i < len(zipReader.File); i++ {
-		sheet = zipReader.File[i]
-		if sheet.Name == "xl/worksheets/sheet1.xml" {
-			break
+	var columns columnMap
+	var events []*GenconEvent
+	var rowErrors []RowError
+	err = wb.eachRow(func(rowNum int, cells []cellValue) error {
+		// The first row is the header, which tells us where to find each field
+		if columns == nil {
+			var err error
+			columns, err = newColumnMap(headers(cells))
+			return err
 		}
-	}
-	dataSheet, err := sheet.Open()
-	if err != nil {
-		panic(err)
-	}
-	sheetBytes, err := ioutil.ReadAll(dataSheet)
+		row := &sheetRow{cells: cells, columns: columns}
+		row.rowNum = rowNum
+		if row.str(colEventId) == "" {
+			// Blank rows, usually left at the bottom after editing by hand
+			return nil
+		}
+		event, rowErr := rowToEvent(row, wb.date1904)
+		if rowErr != nil {
+			rowErrors = append(rowErrors, *rowErr)
+			return nil
+		}
+		events = append(events, event)
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	decoder := xml.NewDecoder(bytes.NewBuffer(sheetBytes))
-
-	seenHeader := false
-	var events []*GenconEvent
-	for token, err := decoder.Token(); err == nil; token, err = decoder.Token() {
-		switch t := token.(type) {
-		case xml.StartElement:
-			if t.Name.Local == "row" {
-				// Header row won't fit in the text
-				if !seenHeader {
-					seenHeader = true
-					continue
-				}
-				var row excelRow
-				err = decoder.DecodeElement(&row, &t)
-				if err != nil {
-					panic(err)
-				}
-				events = append(events, rowToEvent(&row))
-			}
-		}
+	if columns == nil {
+		return nil, nil, errors.New("spreadsheet has no header row")
 	}
-	return events
+	return events, rowErrors, nil
 }
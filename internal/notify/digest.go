@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"strings"
+	"time"
+)
+
+// AlertKinds are the changes worth telling someone about. New events and
+// ticket counts change constantly, so they're left out.
+var AlertKinds = map[events.ChangeKind]bool{
+	events.ChangeCancelled:   true,
+	events.ChangeReactivated: true,
+	events.ChangeTime:        true,
+	events.ChangeRoom:        true,
+	events.ChangeCost:        true,
+}
+
+// Digest is everything that changed on one user's starred events in a
+// single import.
+type Digest struct {
+	Email  string         `json:"email"`
+	Events []*DigestEvent `json:"events"`
+}
+
+type DigestEvent struct {
+	EventId string               `json:"event_id"`
+	Title   string               `json:"title"`
+	Link    string               `json:"link"`
+	Changes []events.EventChange `json:"-"`
+	Summary []string             `json:"changes"`
+}
+
+// AddChange adds a change to the digest, grouping it with earlier changes to
+// the same event.
+func (d *Digest) AddChange(title, link string, change events.EventChange) {
+	var event *DigestEvent
+	for _, e := range d.Events {
+		if e.EventId == change.EventId {
+			event = e
+			break
+		}
+	}
+	if event == nil {
+		event = &DigestEvent{EventId: change.EventId, Title: title, Link: link}
+		d.Events = append(d.Events, event)
+	}
+	event.Changes = append(event.Changes, change)
+	event.Summary = append(event.Summary, DescribeChange(change))
+}
+
+func (d *Digest) Subject() string {
+	if len(d.Events) == 1 {
+		return fmt.Sprintf("Gen Con Planner: %s changed", d.Events[0].Title)
+	}
+	return fmt.Sprintf("Gen Con Planner: %d of your starred events changed", len(d.Events))
+}
+
+// Text renders the digest as a plain text email body.
+func (d *Digest) Text() string {
+	var b strings.Builder
+	b.WriteString("Some events you starred have changed since the last catalog update.\n")
+	for _, event := range d.Events {
+		fmt.Fprintf(&b, "\n%s (%s)\n", event.Title, event.EventId)
+		for _, line := range event.Summary {
+			fmt.Fprintf(&b, "  - %s\n", line)
+		}
+		if event.Link != "" {
+			fmt.Fprintf(&b, "  %s\n", event.Link)
+		}
+	}
+	b.WriteString("\nYou can turn these alerts off on your user page.\n")
+	return b.String()
+}
+
+// DescribeChange says what changed in a sentence.
+func DescribeChange(change events.EventChange) string {
+	switch change.Kind {
+	case events.ChangeCancelled:
+		return "Cancelled, it's no longer in the Gen Con catalog"
+	case events.ChangeReactivated:
+		return "Back in the Gen Con catalog, " + formatInterval(change.NewValue)
+	case events.ChangeTime:
+		return fmt.Sprintf("Time changed from %s to %s",
+			formatInterval(change.OldValue), formatInterval(change.NewValue))
+	case events.ChangeRoom:
+		return fmt.Sprintf("Location changed from %s to %s",
+			orUnknown(change.OldValue), orUnknown(change.NewValue))
+	case events.ChangeCost:
+		return fmt.Sprintf("Cost changed from $%s to $%s", change.OldValue, change.NewValue)
+	case events.ChangeTickets:
+		return fmt.Sprintf("Tickets available changed from %s to %s", change.OldValue, change.NewValue)
+	case events.ChangeAdded:
+		return "Added to the Gen Con catalog"
+	}
+	return fmt.Sprintf("%s changed from %s to %s", change.Kind, change.OldValue, change.NewValue)
+}
+
+// formatInterval turns the start/end interval used for time changes into
+// "Thu 6:00 PM - 8:00 PM".
+func formatInterval(interval string) string {
+	parts := strings.SplitN(interval, "/", 2)
+	if len(parts) != 2 {
+		return interval
+	}
+	start, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return interval
+	}
+	end, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return interval
+	}
+	if start.YearDay() != end.YearDay() {
+		return start.Format("Mon 3:04 PM") + " - " + end.Format("Mon 3:04 PM")
+	}
+	return start.Format("Mon 3:04 PM") + " - " + end.Format("3:04 PM")
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
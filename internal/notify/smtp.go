@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends digests over SMTP.
+type Mailer struct {
+	// Addr is host:port of the SMTP server.
+	Addr string
+	From string
+	// Auth is optional, net/smtp only sends credentials over TLS or to
+	// localhost.
+	Auth smtp.Auth
+}
+
+func (m *Mailer) Send(d *Digest) error {
+	if strings.ContainsAny(d.Email, "\r\n") {
+		return fmt.Errorf("bad email address %q", d.Email)
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{d.Email}, m.message(d))
+}
+
+func (m *Mailer) message(d *Digest) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", d.Email)
+	// Titles are organizer supplied, so they need encoding to be safe in a
+	// header.
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", d.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(d.Text(), "\n", "\r\n"))
+	return b.Bytes()
+}
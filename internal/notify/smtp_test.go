@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bufio"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSmtpServer accepts a single message and hands back what it received.
+func fakeSmtpServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost fake smtp")
+
+		var rcpt []string
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "RCPT":
+				rcpt = append(rcpt, line)
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(rcpt, "\n") + "\n" + strings.Join(data, "\n")
+				text.PrintfLine("250 OK")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func testDigest() *Digest {
+	d := &Digest{Email: "player@example.com"}
+	d.AddChange("Catan Open Play", "https://example.com/event/BGM23ND00001", events.EventChange{
+		EventId:  "BGM23ND00001",
+		Kind:     events.ChangeTime,
+		OldValue: "2023-08-03T18:00:00-04:00/2023-08-03T20:00:00-04:00",
+		NewValue: "2023-08-03T19:00:00-04:00/2023-08-03T21:00:00-04:00",
+	})
+	d.AddChange("Catan Open Play", "https://example.com/event/BGM23ND00001", events.EventChange{
+		EventId:  "BGM23ND00001",
+		Kind:     events.ChangeRoom,
+		OldValue: "ICC / Hall D",
+		NewValue: "ICC / Hall E",
+	})
+	d.AddChange("Dungeon Delve", "", events.EventChange{
+		EventId: "RPG23ND00002",
+		Kind:    events.ChangeCancelled,
+	})
+	return d
+}
+
+func TestMailerSend(t *testing.T) {
+	addr, received := fakeSmtpServer(t)
+	mailer := &Mailer{Addr: addr, From: "alerts@example.com"}
+
+	if err := mailer.Send(testDigest()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	message := <-received
+	for _, expected := range []string{
+		"<player@example.com>",
+		"Subject: Gen Con Planner: 2 of your starred events changed",
+		"Catan Open Play (BGM23ND00001)",
+		"Time changed from Thu 6:00 PM - 8:00 PM to Thu 7:00 PM - 9:00 PM",
+		"Location changed from ICC / Hall D to ICC / Hall E",
+		"Dungeon Delve (RPG23ND00002)",
+		"Cancelled",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("Expected message to contain %q, got:\n%s", expected, message)
+		}
+	}
+}
+
+func TestMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := &Mailer{Addr: "127.0.0.1:1", From: "alerts@example.com"}
+	d := testDigest()
+	d.Email = "player@example.com\r\nBcc: everyone@example.com"
+	if err := mailer.Send(d); err == nil {
+		t.Errorf("Expected an error for an email with a newline")
+	}
+}
+
+func TestSubjectEncoding(t *testing.T) {
+	d := &Digest{Email: "player@example.com"}
+	d.AddChange("Evil\r\nBcc: x@example.com", "", events.EventChange{EventId: "BGM23ND00001", Kind: events.ChangeCancelled})
+	message := string((&Mailer{From: "alerts@example.com"}).message(d))
+	headers, err := textproto.NewReader(bufio.NewReader(strings.NewReader(message))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers["Bcc"]) != 0 {
+		t.Errorf("Title escaped into the headers: %v", headers)
+	}
+}
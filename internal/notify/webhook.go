@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var errPrivateAddress = errors.New("webhooks can't point at private addresses")
+
+// WebhookPoster posts digests as JSON to user supplied urls.
+type WebhookPoster struct {
+	Client *http.Client
+}
+
+// NewWebhookPoster returns a poster that refuses to connect to loopback and
+// private addresses. The urls come from users, and we don't want them
+// poking at things on our network.
+func NewWebhookPoster() *WebhookPoster {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &WebhookPoster{
+		Client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast())
+}
+
+// ValidateWebhookUrl checks a url is something we're willing to post to.
+func ValidateWebhookUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("webhook url must be http or https, not %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return errors.New("webhook url must have a host")
+	}
+	return nil
+}
+
+func (p *WebhookPoster) Post(webhookUrl string, d *Digest) error {
+	if err := ValidateWebhookUrl(webhookUrl); err != nil {
+		return err
+	}
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Post(webhookUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %v returned %v", webhookUrl, resp.Status)
+	}
+	return nil
+}
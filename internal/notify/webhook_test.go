@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookPost(t *testing.T) {
+	var received Digest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("Bad body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	// The test server is on loopback, which the default poster refuses
+	poster := &WebhookPoster{Client: server.Client()}
+	if err := poster.Post(server.URL, testDigest()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Email != "player@example.com" || len(received.Events) != 2 {
+		t.Fatalf("Unexpected digest %+v", received)
+	}
+	if summary := received.Events[0].Summary; len(summary) != 2 || summary[1] != "Location changed from ICC / Hall D to ICC / Hall E" {
+		t.Errorf("Unexpected changes %v", summary)
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Request shouldn't have been made")
+	}))
+	defer server.Close()
+
+	if err := NewWebhookPoster().Post(server.URL, testDigest()); err == nil {
+		t.Errorf("Expected posting to loopback to fail")
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	poster := &WebhookPoster{Client: server.Client()}
+	if err := poster.Post(server.URL, testDigest()); err == nil {
+		t.Errorf("Expected an error for a 500")
+	}
+}
+
+func TestValidateWebhookUrl(t *testing.T) {
+	for _, bad := range []string{"file:///etc/passwd", "https://", "gopher://example.com", "::"} {
+		if ValidateWebhookUrl(bad) == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+	if err := ValidateWebhookUrl("https://example.com/hook"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+)
+
+// AlertSettings is how a user wants to hear about changes to their starred
+// events. Users without settings don't get alerts.
+type AlertSettings struct {
+	Email        string
+	EmailEnabled bool
+	WebhookUrl   string
+}
+
+// StarredAlert is a user who starred an event that changed.
+type StarredAlert struct {
+	AlertSettings
+	EventId string
+	Title   string
+}
+
+func LoadAlertSettings(db *sql.DB, email string) (*AlertSettings, error) {
+	settings := AlertSettings{Email: email}
+	err := db.QueryRow(`
+SELECT email_enabled, webhook_url
+FROM alert_settings
+WHERE email = $1
+`, email).Scan(&settings.EmailEnabled, &settings.WebhookUrl)
+	if err == sql.ErrNoRows {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func SaveAlertSettings(db *sql.DB, settings *AlertSettings) error {
+	_, err := db.Exec(`
+INSERT INTO alert_settings (email, email_enabled, webhook_url)
+VALUES ($1, $2, $3)
+ON CONFLICT (email)
+    DO UPDATE SET email_enabled = $2, webhook_url = $3
+`, settings.Email, settings.EmailEnabled, settings.WebhookUrl)
+	return err
+}
+
+// LoadStarredAlerts finds everyone with alerts turned on who starred one of
+// the given events.
+func LoadStarredAlerts(db *sql.DB, eventIds []string) ([]*StarredAlert, error) {
+	rows, err := db.Query(`
+SELECT a.email, a.email_enabled, a.webhook_url, se.event_id, COALESCE(e.title, '')
+FROM starred_events se
+     JOIN alert_settings a ON a.email = se.email
+     JOIN events e ON e.event_id = se.event_id
+WHERE se.event_id = ANY($1)
+  AND (a.email_enabled OR a.webhook_url <> '')
+ORDER BY a.email, e.start_time, se.event_id
+`, pq.Array(eventIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]*StarredAlert, 0)
+	for rows.Next() {
+		var alert StarredAlert
+		err = rows.Scan(&alert.Email, &alert.EmailEnabled, &alert.WebhookUrl, &alert.EventId, &alert.Title)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+	return alerts, rows.Err()
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/lib/pq"
+	"time"
+)
+
+// EventChange is a change found during an import, along with when.
+type EventChange struct {
+	events.EventChange
+	DetectedAt time.Time
+}
+
+func insertEventChanges(tx *sql.Tx, changes []events.EventChange, detectedAt time.Time) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	eventIds := make([]string, len(changes))
+	years := make([]int64, len(changes))
+	kinds := make([]string, len(changes))
+	oldValues := make([]string, len(changes))
+	newValues := make([]string, len(changes))
+	for i, change := range changes {
+		eventIds[i] = change.EventId
+		years[i] = int64(change.Year)
+		kinds[i] = string(change.Kind)
+		oldValues[i] = change.OldValue
+		newValues[i] = change.NewValue
+	}
+
+	// Arrays keep this to one statement, however many changes there are
+	_, err := tx.Exec(`
+INSERT INTO event_changes (event_id, year, kind, old_value, new_value, detected_at)
+SELECT n.*, $6 FROM unnest($1::text[], $2::integer[], $3::text[], $4::text[], $5::text[]) AS n
+`, pq.Array(eventIds), pq.Array(years), pq.Array(kinds), pq.Array(oldValues), pq.Array(newValues), detectedAt)
+	return err
+}
+
+// LoadEventChanges loads the changes to an event, most recent first.
+func LoadEventChanges(db *sql.DB, eventId string) ([]*EventChange, error) {
+	rows, err := db.Query(`
+SELECT event_id, year, kind, old_value, new_value, detected_at
+FROM event_changes
+WHERE event_id = $1
+ORDER BY detected_at DESC, id DESC
+`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEventChanges(rows)
+}
+
+// LoadChangesSince loads every change to a year's events detected after the
+// given time, oldest first.
+func LoadChangesSince(db *sql.DB, year int, since time.Time) ([]*EventChange, error) {
+	rows, err := db.Query(`
+SELECT event_id, year, kind, old_value, new_value, detected_at
+FROM event_changes
+WHERE year = $1 AND detected_at > $2
+ORDER BY detected_at, id
+`, year, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEventChanges(rows)
+}
+
+func scanEventChanges(rows *sql.Rows) ([]*EventChange, error) {
+	changes := make([]*EventChange, 0)
+	for rows.Next() {
+		var change EventChange
+		var kind string
+		err := rows.Scan(&change.EventId, &change.Year, &kind,
+			&change.OldValue, &change.NewValue, &change.DetectedAt)
+		if err != nil {
+			return nil, err
+		}
+		change.Kind = events.ChangeKind(kind)
+		changes = append(changes, &change)
+	}
+	return changes, rows.Err()
+}
@@ -2,10 +2,13 @@ package postgres
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/search"
 	"github.com/lib/pq"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
@@ -53,12 +56,44 @@ type EventGroup struct {
 	SatTickets    int
 	SunTickets    int
 	TotalTickets  int
+	// Projected hours until the whole cluster sells out, nil when it isn't
+	// selling or we have no estimate.
+	SellOutHours *float64
+	// SellOutHours on a 0 to 1 scale, see events.SellOutRisk.
+	SellOutRisk float64
+	// Where the cluster is in the order of the search that found it, only
+	// set by FindEvents.
+	SortKey SortKey
 }
 
+// SortKey is the values a search result is ordered by, as text, nil for
+// NULL. Results change between searches, so paging after a result's key
+// rather than an offset keeps pages from repeating or skipping results.
+type SortKey []*string
+
+// ErrBadSortKey means a SortKey didn't come from a search with the same
+// sort.
+var ErrBadSortKey = errors.New("sort key isn't from this sort")
+
+// How search results can be ordered, by relevance when SortBy is empty.
+const (
+	// SortBySellOutRisk orders search results by how soon they'll sell out.
+	SortBySellOutRisk = "risk"
+	// SortByStart orders search results by when their first event starts.
+	SortByStart = "start"
+	// SortByTitle orders search results alphabetically.
+	SortByTitle = "title"
+)
+
+// SortOrders lists every SortBy a search accepts, relevance first.
+var SortOrders = []string{"", SortBySellOutRisk, SortByStart, SortByTitle}
+
 type ParsedQuery struct {
-	// TODO(alek): make a significantly more robust query parser
-	// add exact match on fields,
-	TextQueries     []string
+	// Words or phrases to search for, and to exclude
+	TextQueries  []string
+	ExcludedText []string
+	// Searches on specific fields, like cost<=4
+	Filters         []*search.Term
 	Year            int
 	DaysOfWeek      map[string]bool
 	RawQuery        string
@@ -66,12 +101,67 @@ type ParsedQuery struct {
 	StartAfterHour  int
 	EndBeforeHour   int
 	EndAfterHour    int
-	OrgId 			int
+	OrgId           int
+	SortBy          string
+	// Pages through the results when Limit is set, 0 returns them all. Pages
+	// after the first start after the SortKey of the last result before them.
+	Limit int
+	After SortKey
+	EventFilters
+}
+
+// EventFilters narrow a search by what an event asks of the people playing
+// it. The zero value filters nothing.
+type EventFilters struct {
+	// Nil for any cost, so that 0 can mean free
+	MaxCost *int
+	// Keys from events.AgeGroups and events.ExperienceLevels, any of which
+	// can match
+	AgeGroups  []string
+	Experience []string
+	// Only events that can seat this many players, 0 for any
+	Players int
+	// In minutes, 0 for any
+	MaxDuration       int
+	MaterialsProvided bool
+	// Nil for either
+	Tournament *bool
+}
+
+func (f EventFilters) HasAgeGroup(key string) bool {
+	return contains(f.AgeGroups, key)
+}
+
+func (f EventFilters) HasExperience(key string) bool {
+	return contains(f.Experience, key)
 }
 
-func rowToGroup(rows *sql.Rows) (*EventGroup, error) {
+func (f EventFilters) TournamentIs(tournament bool) bool {
+	return f.Tournament != nil && *f.Tournament == tournament
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// How long until a cluster sells out, from the estimates of its events that
+// still have tickets. Relies on sellout_estimates being joined in.
+const clusterSellOutHours = `
+CASE WHEN sum(tickets_available) = 0 THEN 0
+     WHEN sum(CASE WHEN tickets_available > 0 THEN rate_per_hour ELSE 0 END) > 0
+     THEN sum(tickets_available) / sum(CASE WHEN tickets_available > 0 THEN rate_per_hour ELSE 0 END)
+END`
+
+// rowToGroup scans a cluster, along with any extra columns after it.
+func rowToGroup(rows *sql.Rows, extra ...interface{}) (*EventGroup, error) {
 	var group EventGroup
-	if err := rows.Scan(
+	var sellOutHours sql.NullFloat64
+	if err := rows.Scan(append([]interface{}{
 		&group.EventId,
 		&group.Name,
 		&group.Description,
@@ -85,9 +175,14 @@ func rowToGroup(rows *sql.Rows) (*EventGroup, error) {
 		&group.FriTickets,
 		&group.SatTickets,
 		&group.SunTickets,
-	); err != nil {
+		&sellOutHours,
+	}, extra...)...); err != nil {
 		return nil, err
 	}
+	if sellOutHours.Valid {
+		group.SellOutHours = &sellOutHours.Float64
+		group.SellOutRisk = events.SellOutRisk(sellOutHours.Float64)
+	}
 	return &group, nil
 }
 
@@ -110,7 +205,8 @@ SELECT
 	   c.thursday_tickets,
 	   c.friday_tickets,
 	   c.saturday_tickets,
-	   c.sunday_tickets
+	   c.sunday_tickets,
+	   c.sellout_hours
 FROM events e 
 	JOIN (
 		SELECT 
@@ -124,8 +220,9 @@ FROM events e
 			   sum(CASE WHEN day_of_week = 4 THEN tickets_available ELSE 0 END) as thursday_tickets,
 			   sum(CASE WHEN day_of_week = 5 THEN tickets_available ELSE 0 END) as friday_tickets,
 			   sum(CASE WHEN day_of_week = 6 THEN tickets_available ELSE 0 END) as saturday_tickets,
-			   sum(CASE WHEN day_of_week = 0 THEN tickets_available ELSE 0 END) as sunday_tickets	   
-		FROM events
+			   sum(CASE WHEN day_of_week = 0 THEN tickets_available ELSE 0 END) as sunday_tickets,
+			   `+clusterSellOutHours+` as sellout_hours
+		FROM events LEFT JOIN sellout_estimates USING (event_id)
 		WHERE active and year=$1 and short_category=$2
 		GROUP BY cluster_key, short_category, title
 		) as c ON e.title = c.title 
@@ -214,32 +311,82 @@ ORDER BY e1.start_time`, fields), eventId, year, userEmail)
 	return loadedEvents, nil
 }
 
-func FindEvents(db *sql.DB, query *ParsedQuery) ([]*EventGroup, error) {
-	innerFrom := "events"
-	innerWhere := fmt.Sprintf("active AND year = %v", query.Year)
+// Columns of the cluster subquery with each day's tickets, for the days a
+// search can be limited to.
+var dayTicketColumns = map[string]string{
+	"wed": "c.wed_tickets",
+	"thu": "c.thu_tickets",
+	"fri": "c.fri_tickets",
+	"sat": "c.sat_tickets",
+	"sun": "c.sun_tickets",
+}
+
+// eventSearch is the parts of a search that both its results and facets are
+// built from, with the query's values bound in b.
+type eventSearch struct {
+	b *queryBuilder
+	// What each event is matched on
+	from  string
+	where []string
+	// Matching events grouped into clusters, and what the clusters are
+	// filtered on once joined to their first event as e and organizer as o
+	clusters     string
+	clusterWhere []string
+}
+
+// buildEventSearch binds a search's values and builds the conditions for
+// it. Every value from the query is bound as an argument, the sql only
+// depends on which filters are used.
+func buildEventSearch(query *ParsedQuery) (*eventSearch, error) {
+	b := &queryBuilder{}
+	year := b.arg(query.Year)
+
+	innerFrom := "events LEFT JOIN sellout_estimates USING (event_id)"
+	innerWhere := []string{"active", "year = " + year}
 	if query.StartBeforeHour >= 0 {
-		innerWhere = fmt.Sprintf("%v AND EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') <= %v", innerWhere, query.StartBeforeHour)
+		innerWhere = append(innerWhere, b.cond("EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') <= ?", query.StartBeforeHour))
 	}
 	if query.StartAfterHour >= 0 {
-		innerWhere = fmt.Sprintf("%v AND EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') >= %v", innerWhere, query.StartAfterHour)
+		innerWhere = append(innerWhere, b.cond("EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') >= ?", query.StartAfterHour))
 	}
 	if query.EndBeforeHour >= 0 {
-		innerWhere = fmt.Sprintf("%v AND EXTRACT(HOUR FROM end_time AT TIME ZONE 'EDT') <= %v", innerWhere, query.EndBeforeHour)
+		innerWhere = append(innerWhere, b.cond("EXTRACT(HOUR FROM end_time AT TIME ZONE 'EDT') <= ?", query.EndBeforeHour))
 	}
 	if query.EndAfterHour >= 0 {
-		innerWhere = fmt.Sprintf("%v AND EXTRACT(HOUR FROM end_time AT TIME ZONE 'EDT') >= %v", innerWhere, query.EndAfterHour)
+		innerWhere = append(innerWhere, b.cond("EXTRACT(HOUR FROM end_time AT TIME ZONE 'EDT') >= ?", query.EndAfterHour))
+	}
+	innerWhere = append(innerWhere, query.EventFilters.conditions(b)...)
+	for _, filter := range query.Filters {
+		condition, err := b.filterCondition(filter)
+		if err != nil {
+			return nil, err
+		}
+		innerWhere = append(innerWhere, condition)
 	}
 
 	titleRank := "1"
 	searchRank := "1"
-
-	tsquery := strings.Join(query.TextQueries, " & ")
-	tsquery = strings.ReplaceAll(tsquery, "'", "")
-	if len(tsquery) > 0 {
-		innerFrom = fmt.Sprintf("%v, to_tsquery('%v') q", innerFrom, tsquery)
-		innerWhere = fmt.Sprintf("%v AND search_key @@ q", innerWhere)
+	fuzzyRank := "1"
+	if text := websearchText(query.TextQueries, query.ExcludedText); text != "" {
+		innerFrom += b.cond(", websearch_to_tsquery('english', ?) q", text)
+		textMatch := "search_key @@ q"
+		if inexact := b.inexactTextConditions(query); len(inexact) > 0 {
+			// Partial words and misspellings only match when nothing matches
+			// exactly, so searching a title doesn't find everything that looks
+			// a little like it
+			noneExact := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %v WHERE %v)", innerFrom, allOf(append(innerWhere, textMatch)))
+			textMatch = anyOf([]string{textMatch, allOf([]string{noneExact, anyOf(inexact)})})
+		}
+		innerWhere = append(innerWhere, textMatch)
 		titleRank = "min(ts_rank(title_tsv, q))"
 		searchRank = "min(ts_rank(search_key, q))"
+		if len(query.TextQueries) > 0 {
+			similar := b.arg(cleanText(strings.Join(query.TextQueries, " ")))
+			fuzzyRank = fmt.Sprintf(`min(greatest(
+		word_similarity(%[1]v, title),
+		word_similarity(%[1]v, COALESCE(game_system, '')),
+		word_similarity(%[1]v, COALESCE(org_group, ''))))`, similar)
+		}
 	}
 
 	innerQuery := fmt.Sprintf(`
@@ -255,29 +402,69 @@ SELECT
 	sum(CASE WHEN day_of_week = 5 THEN tickets_available ELSE 0 END) as fri_tickets,
 	sum(CASE WHEN day_of_week = 6 THEN tickets_available ELSE 0 END) as sat_tickets,
 	sum(CASE WHEN day_of_week = 0 THEN tickets_available ELSE 0 END) as sun_tickets,
+	`+clusterSellOutHours+` as sellout_hours,
     %v as title_rank,
-    %v as search_rank
+    %v as search_rank,
+    %v as fuzzy_rank
 FROM %v
 WHERE %v
 GROUP BY cluster_key, short_category, title
-`, titleRank, searchRank, innerFrom, innerWhere)
-
-	// Default to true so we don't filter anything out
-	// if no days were requested
-	dayPart := "true"
-	if len(query.DaysOfWeek) > 0 {
-		var days []string
-		for d := range query.DaysOfWeek {
-			if query.DaysOfWeek[d] {
-				days = append(days, fmt.Sprintf("c.%v_tickets > 0", d))
-			}
+`, titleRank, searchRank, fuzzyRank, innerFrom, allOf(innerWhere))
+
+	fullWhere := []string{"e.year = " + year}
+	// No days requested means any day
+	var days []string
+	for _, day := range []string{"wed", "thu", "fri", "sat", "sun"} {
+		if query.DaysOfWeek[day] {
+			days = append(days, dayTicketColumns[day]+" > 0")
 		}
-		dayPart = strings.Join(days, " OR ")
 	}
-	fullWhere := fmt.Sprintf("e.year = %v AND (%v)", query.Year, dayPart)
-
+	if len(days) > 0 {
+		fullWhere = append(fullWhere, anyOf(days))
+	}
 	if query.OrgId > 0 {
-		fullWhere = fmt.Sprintf("(%v) AND o.id = %v", fullWhere, query.OrgId)
+		fullWhere = append(fullWhere, b.cond("o.id = ?", query.OrgId))
+	}
+
+	return &eventSearch{
+		b:            b,
+		from:         innerFrom,
+		where:        innerWhere,
+		clusters:     innerQuery,
+		clusterWhere: fullWhere,
+	}, nil
+}
+
+// buildFindEventsQuery builds the sql for a search, returning the first
+// event of each matching cluster.
+func buildFindEventsQuery(query *ParsedQuery) (string, []interface{}, error) {
+	s, err := buildEventSearch(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := sortColumns(query.SortBy)
+	orderBy := make([]string, len(columns))
+	sortKey := make([]string, len(columns))
+	for i, column := range columns {
+		orderBy[i] = column.expr
+		if column.desc {
+			orderBy[i] += " desc"
+		}
+		sortKey[i] = fmt.Sprintf("CAST(%v AS text)", column.expr)
+	}
+
+	after := ""
+	if query.After != nil {
+		condition, err := afterCondition(s.b, columns, query.After)
+		if err != nil {
+			return "", nil, err
+		}
+		after = "\n  AND " + condition
+	}
+	page := ""
+	if query.Limit > 0 {
+		page = "LIMIT " + s.b.arg(query.Limit)
 	}
 
 	fullQuery := fmt.Sprintf(`
@@ -293,131 +480,209 @@ SELECT
 	   c.thu_tickets,
 	   c.fri_tickets,
 	   c.sat_tickets,
-	   c.sun_tickets
-FROM events e JOIN (%v) AS c 
+	   c.sun_tickets,
+	   c.sellout_hours,
+	   ARRAY[%v] AS sort_key
+FROM %v%v
+ORDER BY %v
+%v
+`, strings.Join(sortKey, ", "), s.clusterJoin(), after, strings.Join(orderBy, ", "), page)
+	return fullQuery, s.b.args, nil
+}
+
+// sortColumn is one of the values search results are ordered by. Nulls sort
+// last ascending and first descending, as postgres sorts them by default.
+type sortColumn struct {
+	expr string
+	desc bool
+}
+
+// sortColumns are what a sort orders search results by, most relevant first
+// to break ties, then the event so that every result has its own place.
+func sortColumns(sortBy string) []sortColumn {
+	columns := []sortColumn{
+		{"c.title_rank", true},
+		{"c.search_rank", true},
+		{"c.fuzzy_rank", true},
+		{"c.tickets_available", true},
+		{"e.event_id", false},
+	}
+	switch sortBy {
+	case SortBySellOutRisk:
+		columns = append([]sortColumn{{"c.tickets_available = 0", false}, {"c.sellout_hours", false}}, columns...)
+	case SortByStart:
+		columns = append([]sortColumn{{"c.start_time", false}}, columns...)
+	case SortByTitle:
+		columns = append([]sortColumn{{"lower(e.title)", false}}, columns...)
+	}
+	return columns
+}
+
+// afterCondition matches the results that sort after the one with the given
+// key: those that sort after it on a column, and the same on every column
+// before that one. Nulls sort after every value.
+func afterCondition(b *queryBuilder, columns []sortColumn, after SortKey) (string, error) {
+	if len(after) != len(columns) {
+		return "", ErrBadSortKey
+	}
+	// same is sliced to its length before appending, so each alternative
+	// gets its own copy
+	var later, same []string
+	for i, column := range columns {
+		expr := "(" + column.expr + ")"
+		if after[i] == nil {
+			if column.desc {
+				later = append(later, allOf(append(same[:len(same):len(same)], expr+" IS NOT NULL")))
+			}
+			same = append(same, expr+" IS NULL")
+			continue
+		}
+		value := b.arg(*after[i])
+		laterValue := fmt.Sprintf("(%[1]v > %[2]v OR %[1]v IS NULL)", expr, value)
+		if column.desc {
+			laterValue = fmt.Sprintf("%v < %v", expr, value)
+		}
+		later = append(later, allOf(append(same[:len(same):len(same)], laterValue)))
+		same = append(same, fmt.Sprintf("%v = %v", expr, value))
+	}
+	return anyOf(later), nil
+}
+
+// clusterJoin joins each matching cluster to its first event and that
+// event's organizer, with the cluster filters applied.
+func (s *eventSearch) clusterJoin() string {
+	return fmt.Sprintf(`events e JOIN (%v) AS c 
 	ON e.title = c.title
         AND e.short_category = c.short_category
         AND e.cluster_key = c.cluster_key
         AND e.start_time = c.start_time
     JOIN orgs o ON lower(o.alias) = lower(e.org_group)
-WHERE %v
-ORDER BY c.title_rank desc, c.search_rank desc, c.tickets_available desc
-`, innerQuery, fullWhere)
+WHERE %v`, s.clusters, allOf(s.clusterWhere))
+}
 
-	log.Printf(fullQuery)
+// FindEvents finds the clusters of events matching a search, along with how
+// the events in them break down by each facet. Facets are only loaded for
+// the first page of a paged search.
+func FindEvents(db *sql.DB, query *ParsedQuery) ([]*EventGroup, []*Facet, error) {
+	fullQuery, args, err := buildFindEventsQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	loadedEvents := make([]*EventGroup, 0)
-	rows, err := db.Query(fullQuery)
+	rows, err := db.Query(fullQuery, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	// Load all the events
 	for rows.Next() {
-		group, err := rowToGroup(rows)
+		var sortKey []sql.NullString
+		group, err := rowToGroup(rows, pq.Array(&sortKey))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		for _, value := range sortKey {
+			value := value
+			if value.Valid {
+				group.SortKey = append(group.SortKey, &value.String)
+			} else {
+				group.SortKey = append(group.SortKey, nil)
+			}
 		}
 
 		loadedEvents = append(loadedEvents, group)
 	}
-	return loadedEvents, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	// Facets are the same for every page, so only the first loads them
+	if len(loadedEvents) == 0 || query.After != nil {
+		return loadedEvents, nil, nil
+	}
+
+	facets, err := loadFacets(db, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	return loadedEvents, facets, nil
 }
 
-func loadEventIds(tx *sql.Tx, year int) (map[string]time.Time, map[string]time.Time, error) {
-	// load all events: ids + last update time
-	rows, err := tx.Query(`
-SELECT event_id, active, last_modified
+// loadYearEvents loads every event we have for a year, active or not, so a
+// new catalog can be diffed against it.
+func loadYearEvents(tx *sql.Tx, year int) ([]*events.GenconEvent, error) {
+	rows, err := tx.Query(fmt.Sprintf(`
+SELECT %s, false, 0
 FROM events
-WHERE year=$1`, year)
+WHERE year=$1`, strings.Join(eventFields(), ", ")), year)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	var activeEvents map[string]time.Time
-	var inactiveEvents map[string]time.Time
-	activeEvents = make(map[string]time.Time)
-	inactiveEvents = make(map[string]time.Time)
-
+	loadedEvents := make([]*events.GenconEvent, 0)
 	for rows.Next() {
-		var id string
-		var active bool
-		var updateTime time.Time
-
-		err := rows.Scan(&id, &active, &updateTime)
+		event, err := scanEvent(rows)
 		if err != nil {
-			return nil, nil, err
-		}
-
-		if active {
-			activeEvents[id] = updateTime
-		} else {
-			inactiveEvents[id] = updateTime
+			return nil, err
 		}
+		loadedEvents = append(loadedEvents, event)
 	}
-
-	return activeEvents, inactiveEvents, nil
+	return loadedEvents, rows.Err()
 }
 
-func bulkDelete(tx *sql.Tx, deletedEvents []string) error {
-	// Deletes aren't true deletes, we mark them as inactive
-	batchSize := 100
-	for len(deletedEvents) > 0 {
-		if len(deletedEvents) < batchSize {
-			batchSize = len(deletedEvents)
+// BulkUpdateEvents brings the stored events for each year in the catalog in
+// line with the catalog, recording what changed in event_changes and ticket
+// counts in ticket_history as of the given time. The changes are returned as
+// well. Years the catalog doesn't have events for are left alone. If a year
+// would deactivate more events than limits allow, nothing for that year is
+// written and the returned error is an *events.DeactivationError.
+func BulkUpdateEvents(tx *sql.Tx, parsedEvents []*events.GenconEvent, asOf time.Time, limits *events.DeactivationLimits) ([]events.EventChange, error) {
+	eventsByYear := make(map[int][]*events.GenconEvent)
+	var years []int
+	for _, event := range parsedEvents {
+		if _, found := eventsByYear[event.Year]; !found {
+			years = append(years, event.Year)
 		}
-		batch := make([]string, 0, batchSize)
-		for _, eventId := range deletedEvents[0:batchSize:batchSize] {
-			batch = append(batch, "'"+eventId+"'")
-		}
-
-		deletedEvents = deletedEvents[batchSize:]
-		updateStatement := fmt.Sprintf(
-			"UPDATE events SET active = FALSE WHERE event_id in (%s)",
-			strings.Join(batch, ","))
-
-		_, err := tx.Exec(updateStatement)
+		eventsByYear[event.Year] = append(eventsByYear[event.Year], event)
+	}
+	sort.Ints(years)
 
+	var changes []events.EventChange
+	for _, year := range years {
+		yearChanges, err := updateYearEvents(tx, year, eventsByYear[year], asOf, limits)
 		if err != nil {
-			log.Printf("Error on processing event: %s %v", batch, err.(pq.PGError))
-			return err
+			return nil, fmt.Errorf("updating %v events: %w", year, err)
 		}
+		changes = append(changes, yearChanges...)
 	}
-	return nil
+	return changes, nil
 }
 
-func BulkUpdateEvents(tx *sql.Tx, parsedEvents []*events.GenconEvent) error {
-	year := parsedEvents[0].Year
-	activeEvents, inactiveEvents, err := loadEventIds(tx, year)
-	persistedEvents := make(map[string]time.Time, len(activeEvents)+len(inactiveEvents))
-	for id, updateTime := range activeEvents {
-		persistedEvents[id] = updateTime
-	}
-	for id, updateTime := range inactiveEvents {
-		persistedEvents[id] = updateTime
-	}
-
+func updateYearEvents(tx *sql.Tx, year int, parsedEvents []*events.GenconEvent, asOf time.Time, limits *events.DeactivationLimits) ([]events.EventChange, error) {
+	persistedEvents, err := loadYearEvents(tx, year)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	log.Printf("Loaded %d Rows\n", len(persistedEvents))
 
-	var newEvents []*events.GenconEvent
-	var updatedEvents []*events.GenconEvent
+	activeEvents := make(map[string]bool, len(persistedEvents))
+	persistedIds := make(map[string]bool, len(persistedEvents))
+	for _, event := range persistedEvents {
+		persistedIds[event.EventId] = true
+		if event.Active {
+			activeEvents[event.EventId] = true
+		}
+	}
+	numActive := len(activeEvents)
 
-	latestUpdate := parsedEvents[0].LastModified
+	numNew := 0
 	for _, parsedEvent := range parsedEvents {
-		if _, found := persistedEvents[parsedEvent.EventId]; found {
-			updatedEvents = append(updatedEvents, parsedEvent)
-			delete(activeEvents, parsedEvent.EventId)
-		} else {
-			newEvents = append(newEvents, parsedEvent)
-		}
-		if latestUpdate.Before(parsedEvent.LastModified) {
-			latestUpdate = parsedEvent.LastModified
+		if !persistedIds[parsedEvent.EventId] {
+			numNew++
 		}
+		delete(activeEvents, parsedEvent.EventId)
 	}
 
 	// Any remaining active events should be deleted
@@ -425,29 +690,39 @@ func BulkUpdateEvents(tx *sql.Tx, parsedEvents []*events.GenconEvent) error {
 	for event := range activeEvents {
 		deletedEvents = append(deletedEvents, event)
 	}
+	err = limits.Check(year, numActive, len(parsedEvents), len(deletedEvents))
+	if err != nil {
+		return nil, err
+	}
 
-	log.Printf("Inserting %d events\n", len(newEvents))
-	log.Printf("Updating %d events\n", len(updatedEvents))
+	changes := events.DiffEvents(persistedEvents, parsedEvents)
+
+	log.Printf("Inserting %d events\n", numNew)
+	log.Printf("Updating %d events\n", len(parsedEvents)-numNew)
 	log.Printf("Deleting %d events\n", len(deletedEvents))
+	log.Printf("Recording %d changes\n", len(changes))
 
-	err = bulkInsert(tx, newEvents)
+	err = stageEvents(tx, parsedEvents)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = bulkUpdate(tx, updatedEvents)
+	err = applyStagedEvents(tx, year)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = bulkDelete(tx, deletedEvents)
-	return err
-}
-
-func rangeSlice(min, max int) []interface{} {
-	a := make([]interface{}, max-min+1)
-	for i := range a {
-		a[i] = min + i
+	err = insertEventChanges(tx, changes, asOf)
+	if err != nil {
+		return nil, err
+	}
+	err = recordTicketHistory(tx, parsedEvents, asOf)
+	if err != nil {
+		return nil, err
+	}
+	err = UpdateSellOutEstimates(tx, year, asOf)
+	if err != nil {
+		return nil, err
 	}
-	return a
+	return changes, nil
 }
 
 func eventFields() []string {
@@ -575,69 +850,77 @@ func scanEvent(row *sql.Rows) (*events.GenconEvent, error) {
 	return &event, err
 }
 
-func bulkUpdate(tx *sql.Tx, updatedRows []*events.GenconEvent) error {
+// stageEvents copies events into the staged_events temp table, replacing
+// whatever was staged before. The table lasts until the transaction ends.
+func stageEvents(tx *sql.Tx, stagedEvents []*events.GenconEvent) error {
 	eventFields := eventFields()
-	numEventFields := len(eventFields)
-
-	for _, row := range updatedRows {
-		whereClause := fmt.Sprintf(
-			"(%s) = %s",
-			strings.Join(eventFields, ", "),
-			fmt.Sprintf(
-				"($%d"+strings.Repeat(", $%d", numEventFields-1)+")",
-				rangeSlice(1, numEventFields)...))
-		updateStatement := fmt.Sprintf(
-			"UPDATE events SET %s WHERE event_id='%s'",
-			whereClause,
-			row.EventId)
-
-		valueArgs := eventToDbFields(row)
-		_, err := tx.Exec(updateStatement, valueArgs...)
+	_, err := tx.Exec(fmt.Sprintf(`
+CREATE TEMP TABLE IF NOT EXISTS staged_events ON COMMIT DROP AS
+SELECT %s FROM events WITH NO DATA`, strings.Join(eventFields, ", ")))
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("TRUNCATE staged_events"); err != nil {
+		return err
+	}
 
-		if err != nil {
-			log.Printf("Error on updating event: %v %v", row, err.(pq.PGError))
-			return err
+	stmt, err := tx.Prepare(pq.CopyIn("staged_events", eventFields...))
+	if err != nil {
+		return err
+	}
+	for _, event := range stagedEvents {
+		if _, err = stmt.Exec(eventToDbFields(event)...); err != nil {
+			stmt.Close()
+			return fmt.Errorf("staging event %v: %w", event.EventId, err)
 		}
 	}
-
-	return nil
+	// An Exec with no args flushes the copy
+	if _, err = stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	return stmt.Close()
 }
 
-func bulkInsert(tx *sql.Tx, newRows []*events.GenconEvent) error {
-	batchSize := 100
-
+// applyStagedEvents brings a year's events in line with the staged events.
+// Events already stored are updated, including reactivating any that were
+// inactive, new ones are inserted and active ones that aren't staged are
+// marked inactive. Deletes aren't true deletes, so stars and history stay.
+func applyStagedEvents(tx *sql.Tx, year int) error {
 	eventFields := eventFields()
-	numEventFields := len(eventFields)
-
-	for len(newRows) > 0 {
-		if batchSize > len(newRows) {
-			// This is the final batch
-			batchSize = len(newRows)
-		}
-		batch := newRows[0:batchSize:batchSize]
-		newRows = newRows[batchSize:]
-
-		valueStrings := make([]string, 0, len(batch))
-		valueArgs := make([]interface{}, 0, len(batch)*numEventFields)
-		for i, row := range batch {
-			valueStrings = append(
-				valueStrings,
-				fmt.Sprintf(
-					"( $%d "+strings.Repeat(",$%d", numEventFields-1)+" )",
-					rangeSlice(i*numEventFields+1, i*numEventFields+numEventFields)...))
-			valueArgs = append(valueArgs, eventToDbFields(row)...)
-		}
-		insertStatement := fmt.Sprintf(
-			"INSERT INTO events (%s) VALUES %s",
-			strings.Join(eventFields, ","),
-			strings.Join(valueStrings, ","))
-		_, err := tx.Exec(insertStatement, valueArgs...)
+	// Everything but event_id, which is first
+	updatedFields := eventFields[1:]
+	stagedFields := make([]string, len(updatedFields))
+	for i, field := range updatedFields {
+		stagedFields[i] = "s." + field
+	}
+
+	_, err := tx.Exec(fmt.Sprintf(`
+UPDATE events e
+SET (%s) = (%s)
+FROM staged_events s
+WHERE e.event_id = s.event_id`, strings.Join(updatedFields, ", "), strings.Join(stagedFields, ", ")))
+	if err != nil {
+		return fmt.Errorf("updating events: %w", err)
+	}
 
-		if err != nil {
-			log.Printf("Error on processing event: %s %v", batch, err.(pq.PGError))
-			return err
-		}
+	_, err = tx.Exec(fmt.Sprintf(`
+INSERT INTO events (%[1]s)
+SELECT %[1]s
+FROM staged_events s
+WHERE NOT EXISTS (SELECT 1 FROM events e WHERE e.event_id = s.event_id)`, strings.Join(eventFields, ", ")))
+	if err != nil {
+		return fmt.Errorf("inserting events: %w", err)
 	}
 
+	_, err = tx.Exec(`
+UPDATE events e
+SET active = FALSE
+WHERE e.year = $1
+  AND e.active
+  AND NOT EXISTS (SELECT 1 FROM staged_events s WHERE s.event_id = e.event_id)`, year)
+	if err != nil {
+		return fmt.Errorf("deactivating events: %w", err)
+	}
 	return nil
 }
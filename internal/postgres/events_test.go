@@ -0,0 +1,335 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"strings"
+	"testing"
+	"time"
+)
+
+// These need a migrated database, for example
+//   go test ./internal/postgres -run none -bench . -args -db "dbname=genconplanner_test"
+// Tests that need one are skipped without -db.
+// Every import is rolled back, but use a scratch database regardless.
+
+const benchmarkYear = 1999
+const benchmarkEvents = 25000
+
+func openTestDb(tb testing.TB) *sql.DB {
+	if *dbConnectString == "" {
+		tb.Skip("no -db to run against")
+	}
+	db, err := OpenDb()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// syntheticCatalog is a catalog the size of a real one, spread over the
+// categories and days of the con.
+func syntheticCatalog(year, numEvents int) []*events.GenconEvent {
+	categories := []string{"BGM", "RPG", "TCG", "NMN", "SEM", "ENT", "TDA", "MHE"}
+	conStart := time.Date(year, time.August, 1, 8, 0, 0, 0, INDIANAPOLIS)
+	catalog := make([]*events.GenconEvent, numEvents)
+	for i := range catalog {
+		category := categories[i%len(categories)]
+		startTime := conStart.Add(time.Duration(i%96) * time.Hour)
+		catalog[i] = &events.GenconEvent{
+			EventId:            fmt.Sprintf("%v%02dND%06d", category, year%100, i),
+			Year:               year,
+			Active:             true,
+			Group:              fmt.Sprintf("Organizer %d", i%500),
+			Title:              fmt.Sprintf("Synthetic event %d", i%2000),
+			ShortDescription:   "A game for the benchmark",
+			LongDescription:    strings.Repeat("Long description. ", 20),
+			EventType:          category + " - Synthetic",
+			GameSystem:         fmt.Sprintf("System %d", i%300),
+			MinPlayers:         2,
+			MaxPlayers:         6,
+			AgeRequired:        "Everyone (6+)",
+			ExperienceRequired: "None (You've never played before - rules will be taught)",
+			StartTime:          startTime,
+			Duration:           120,
+			EndTime:            startTime.Add(120 * time.Minute),
+			GMNames:            "Some GM",
+			Cost:               4,
+			Location:           "ICC",
+			RoomName:           "Hall A",
+			TableNumber:        fmt.Sprint(i % 200),
+			TicketsAvailable:   6,
+			LastModified:       conStart.AddDate(0, -3, 0),
+			ShortCategory:      category,
+		}
+	}
+	return catalog
+}
+
+// reimportedCatalog is the catalog as a later import sees it, with tickets
+// sold and a few events dropped.
+func reimportedCatalog(catalog []*events.GenconEvent) []*events.GenconEvent {
+	reimported := make([]*events.GenconEvent, 0, len(catalog))
+	for i, event := range catalog {
+		if i%100 == 0 {
+			continue
+		}
+		updated := *event
+		updated.TicketsAvailable = i % 7
+		reimported = append(reimported, &updated)
+	}
+	return reimported
+}
+
+type bulkLoad func(tx *sql.Tx, year int, catalog []*events.GenconEvent) error
+
+func copyLoad(tx *sql.Tx, year int, catalog []*events.GenconEvent) error {
+	if err := stageEvents(tx, catalog); err != nil {
+		return err
+	}
+	return applyStagedEvents(tx, year)
+}
+
+func benchmarkLoad(b *testing.B, load bulkLoad, reimport bool) {
+	db := openTestDb(b)
+	defer db.Close()
+
+	catalog := syntheticCatalog(benchmarkYear, benchmarkEvents)
+	loaded := catalog
+	if reimport {
+		loaded = reimportedCatalog(catalog)
+	}
+
+	var loading time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		tx, err := db.Begin()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if reimport {
+			if err = copyLoad(tx, benchmarkYear, catalog); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+
+		started := time.Now()
+		if err = load(tx, benchmarkYear, loaded); err != nil {
+			b.Fatal(err)
+		}
+		loading += time.Since(started)
+
+		b.StopTimer()
+		if err = tx.Rollback(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	// Comparable across catalog sizes, unlike ns/op
+	b.ReportMetric(float64(len(loaded)*b.N)/loading.Seconds(), "events/s")
+}
+
+func BenchmarkCopyLoadNewCatalog(b *testing.B) {
+	benchmarkLoad(b, copyLoad, false)
+}
+
+func BenchmarkCopyLoadReimport(b *testing.B) {
+	benchmarkLoad(b, copyLoad, true)
+}
+
+func BenchmarkStatementLoadNewCatalog(b *testing.B) {
+	benchmarkLoad(b, statementLoad, false)
+}
+
+func BenchmarkStatementLoadReimport(b *testing.B) {
+	benchmarkLoad(b, statementLoad, true)
+}
+
+// BenchmarkBulkUpdateEvents is a whole import, change tracking and all.
+func BenchmarkBulkUpdateEvents(b *testing.B) {
+	benchmarkLoad(b, func(tx *sql.Tx, year int, catalog []*events.GenconEvent) error {
+		_, err := BulkUpdateEvents(tx, catalog, time.Now(), nil)
+		return err
+	}, true)
+}
+
+func TestImportEventsWithoutGroup(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	catalog := syntheticCatalog(benchmarkYear, 2)
+	catalog[0].Group = ""
+	if _, err = BulkUpdateEvents(tx, catalog, time.Now(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next import only sees the other group lose its name and tickets
+	// sell
+	reimported := make([]*events.GenconEvent, len(catalog))
+	for i, event := range catalog {
+		updated := *event
+		updated.Group = ""
+		reimported[i] = &updated
+	}
+	reimported[0].TicketsAvailable = 1
+	changes, err := BulkUpdateEvents(tx, reimported, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []events.ChangeKind
+	for _, change := range changes {
+		kinds = append(kinds, change.Kind)
+	}
+	if len(kinds) != 1 || kinds[0] != events.ChangeTickets {
+		t.Errorf("Expected only tickets to change, got %v", changes)
+	}
+
+	stored, err := loadYearEvents(tx, benchmarkYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(catalog) {
+		t.Fatalf("Expected every event stored, got %d", len(stored))
+	}
+	for _, event := range stored {
+		if event.Group != "" || (event.EventId == catalog[0].EventId && event.TicketsAvailable != 1) {
+			t.Errorf("Expected the reimported event, got %+v", event)
+		}
+	}
+}
+
+// statementLoad is how imports were written before staging with COPY: batched
+// multi row inserts, an update per event and batched deactivations. It's only
+// kept to compare against.
+func statementLoad(tx *sql.Tx, year int, catalog []*events.GenconEvent) error {
+	persisted, err := loadYearEvents(tx, year)
+	if err != nil {
+		return err
+	}
+	activeEvents := make(map[string]bool)
+	persistedIds := make(map[string]bool)
+	for _, event := range persisted {
+		persistedIds[event.EventId] = true
+		if event.Active {
+			activeEvents[event.EventId] = true
+		}
+	}
+	var newEvents, updatedEvents []*events.GenconEvent
+	for _, event := range catalog {
+		if persistedIds[event.EventId] {
+			updatedEvents = append(updatedEvents, event)
+			delete(activeEvents, event.EventId)
+		} else {
+			newEvents = append(newEvents, event)
+		}
+	}
+	deletedEvents := make([]string, 0, len(activeEvents))
+	for eventId := range activeEvents {
+		deletedEvents = append(deletedEvents, eventId)
+	}
+
+	if err = statementInsert(tx, newEvents); err != nil {
+		return err
+	}
+	if err = statementUpdate(tx, updatedEvents); err != nil {
+		return err
+	}
+	return statementDelete(tx, deletedEvents)
+}
+
+func paramRange(min, max int) []interface{} {
+	a := make([]interface{}, max-min+1)
+	for i := range a {
+		a[i] = min + i
+	}
+	return a
+}
+
+func statementInsert(tx *sql.Tx, newRows []*events.GenconEvent) error {
+	batchSize := 100
+	eventFields := eventFields()
+	numEventFields := len(eventFields)
+	for len(newRows) > 0 {
+		if batchSize > len(newRows) {
+			batchSize = len(newRows)
+		}
+		batch := newRows[0:batchSize:batchSize]
+		newRows = newRows[batchSize:]
+
+		valueStrings := make([]string, 0, len(batch))
+		valueArgs := make([]interface{}, 0, len(batch)*numEventFields)
+		for i, row := range batch {
+			valueStrings = append(valueStrings, fmt.Sprintf(
+				"( $%d "+strings.Repeat(",$%d", numEventFields-1)+" )",
+				paramRange(i*numEventFields+1, i*numEventFields+numEventFields)...))
+			valueArgs = append(valueArgs, eventToDbFields(row)...)
+		}
+		_, err := tx.Exec(fmt.Sprintf(
+			"INSERT INTO events (%s) VALUES %s",
+			strings.Join(eventFields, ","),
+			strings.Join(valueStrings, ",")), valueArgs...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statementUpdate(tx *sql.Tx, updatedRows []*events.GenconEvent) error {
+	eventFields := eventFields()
+	numEventFields := len(eventFields)
+	updateStatement := fmt.Sprintf(
+		"UPDATE events SET (%s) = ($1"+strings.Repeat(", $%d", numEventFields-1)+") WHERE event_id = $1",
+		append([]interface{}{strings.Join(eventFields, ", ")}, paramRange(2, numEventFields)...)...)
+	for _, row := range updatedRows {
+		if _, err := tx.Exec(updateStatement, eventToDbFields(row)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func statementDelete(tx *sql.Tx, deletedEvents []string) error {
+	batchSize := 100
+	for len(deletedEvents) > 0 {
+		if len(deletedEvents) < batchSize {
+			batchSize = len(deletedEvents)
+		}
+		batch := make([]string, 0, batchSize)
+		for _, eventId := range deletedEvents[0:batchSize:batchSize] {
+			batch = append(batch, "'"+eventId+"'")
+		}
+		deletedEvents = deletedEvents[batchSize:]
+		_, err := tx.Exec(fmt.Sprintf(
+			"UPDATE events SET active = FALSE WHERE event_id in (%s)",
+			strings.Join(batch, ",")))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSyntheticCatalog(t *testing.T) {
+	catalog := syntheticCatalog(2023, 1000)
+	seen := make(map[string]bool)
+	for _, event := range catalog {
+		if len(event.EventId) != 13 {
+			t.Fatalf("Event id %v doesn't fit the events table", event.EventId)
+		}
+		if seen[event.EventId] {
+			t.Fatalf("Duplicate event id %v", event.EventId)
+		}
+		seen[event.EventId] = true
+	}
+	if len(reimportedCatalog(catalog)) != 990 {
+		t.Errorf("Expected 1 in 100 events dropped on reimport")
+	}
+}
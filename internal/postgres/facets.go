@@ -0,0 +1,278 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+)
+
+// The fields search results are faceted on
+const (
+	FacetCategory   = "category"
+	FacetDay        = "day"
+	FacetStart      = "start"
+	FacetCost       = "cost"
+	FacetExperience = "experience"
+	FacetAge        = "age"
+	FacetOrg        = "org"
+)
+
+// Facet is how the events matching a search break down by one field.
+type Facet struct {
+	Name   string
+	Label  string
+	Values []*FacetValue
+}
+
+type FacetValue struct {
+	// What a search would refine on to narrow to these events, like the
+	// category code, a bucket key or the org id
+	Value string
+	Label string
+	Count int
+}
+
+// Bucket is a range of a number that's faceted on, from From up to but not
+// including To. A To of 0 means there's no upper bound.
+type Bucket struct {
+	Key   string
+	Label string
+	From  int
+	To    int
+}
+
+// Hours events start, in the con's time zone
+var StartBuckets = []Bucket{
+	{"morning", "Morning", 0, 12},
+	{"afternoon", "Afternoon", 12, 17},
+	{"evening", "Evening", 17, 21},
+	{"night", "Late night", 21, 0},
+}
+
+var CostBuckets = []Bucket{
+	{"free", "Free", 0, 1},
+	{"low", "$1 to $4", 1, 5},
+	{"medium", "$5 to $12", 5, 13},
+	{"high", "$13 to $32", 13, 33},
+	{"highest", "$33 and up", 33, 0},
+}
+
+// facetOption is a value a facet shows in a fixed order.
+type facetOption struct {
+	key   string
+	label string
+}
+
+// Days of the con, in order, keyed as the search grammar names them
+var facetDays = []facetOption{
+	{"wed", "Wednesday"},
+	{"thu", "Thursday"},
+	{"fri", "Friday"},
+	{"sat", "Saturday"},
+	{"sun", "Sunday"},
+}
+
+var facetDayOfWeek = map[string]int{"wed": 3, "thu": 4, "fri": 5, "sat": 6, "sun": 0}
+
+// Most values shown for facets that are ordered by count
+const maxFacetValues = 10
+
+type facetSpec struct {
+	name  string
+	label string
+	// sql for an event's value, null to leave it out. Columns are of the
+	// matched event m and its organizer o.
+	value string
+	// sql for a value's label, empty to label it in go
+	valueLabel string
+	// The values in the order they're shown, nil to show the most common
+	// first
+	options []facetOption
+}
+
+func bucketOptions(buckets []Bucket) []facetOption {
+	options := make([]facetOption, len(buckets))
+	for i, bucket := range buckets {
+		options[i] = facetOption{bucket.Key, bucket.Label}
+	}
+	return options
+}
+
+func requirementOptions(requirements []events.Requirement) []facetOption {
+	options := make([]facetOption, len(requirements))
+	for i, requirement := range requirements {
+		options[i] = facetOption{requirement.Key, requirement.Label}
+	}
+	return options
+}
+
+// bucketCase is the sql for which bucket an expression falls in.
+func bucketCase(expression string, buckets []Bucket) string {
+	var cases strings.Builder
+	cases.WriteString("CASE")
+	for _, bucket := range buckets {
+		condition := fmt.Sprintf("%v >= %d", expression, bucket.From)
+		if bucket.To > 0 {
+			condition += fmt.Sprintf(" AND %v < %d", expression, bucket.To)
+		}
+		fmt.Fprintf(&cases, " WHEN %v THEN %v", condition, pq.QuoteLiteral(bucket.Key))
+	}
+	cases.WriteString(" END")
+	return cases.String()
+}
+
+// requirementCase is the sql for which requirement a column starts with.
+func requirementCase(column string, requirements []events.Requirement) string {
+	var cases strings.Builder
+	cases.WriteString("CASE")
+	for _, requirement := range requirements {
+		fmt.Fprintf(&cases, " WHEN %v ILIKE %v THEN %v", column,
+			pq.QuoteLiteral(likeEscaper.Replace(requirement.Label)+"%"), pq.QuoteLiteral(requirement.Key))
+	}
+	cases.WriteString(" END")
+	return cases.String()
+}
+
+func dayCase(column string) string {
+	var cases strings.Builder
+	cases.WriteString("CASE " + column)
+	for _, day := range facetDays {
+		fmt.Fprintf(&cases, " WHEN %d THEN %v", facetDayOfWeek[day.key], pq.QuoteLiteral(day.key))
+	}
+	cases.WriteString(" END")
+	return cases.String()
+}
+
+var facetSpecs = []*facetSpec{
+	{name: FacetCategory, label: "Category", value: "m.short_category"},
+	{name: FacetDay, label: "Day", value: dayCase("m.day_of_week"), options: facetDays},
+	{
+		name:    FacetStart,
+		label:   "Starts",
+		value:   bucketCase("EXTRACT(HOUR FROM m.start_time AT TIME ZONE 'EDT')", StartBuckets),
+		options: bucketOptions(StartBuckets),
+	},
+	{name: FacetCost, label: "Cost", value: bucketCase("m.cost", CostBuckets), options: bucketOptions(CostBuckets)},
+	{
+		name:    FacetExperience,
+		label:   "Experience",
+		value:   requirementCase("m.experience_required", events.ExperienceLevels),
+		options: requirementOptions(events.ExperienceLevels),
+	},
+	{
+		name:    FacetAge,
+		label:   "Ages",
+		value:   requirementCase("m.age_required", events.AgeGroups),
+		options: requirementOptions(events.AgeGroups),
+	},
+	{name: FacetOrg, label: "Organizer", value: "CAST(o.id AS text)", valueLabel: "m.org_group"},
+}
+
+// orgAliases has one row per alias, ignoring case. Joining orgs itself would
+// count an event once for each alias differing only by case.
+const orgAliases = "(SELECT lower(alias) AS alias, min(id) AS id FROM orgs GROUP BY lower(alias))"
+
+// buildFacetsQuery builds the sql counting the events in the clusters a
+// search finds by each facet, as rows of facet, value, label and count.
+func buildFacetsQuery(query *ParsedQuery) (string, []interface{}, error) {
+	s, err := buildEventSearch(query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	values := make([]string, len(facetSpecs))
+	for i, spec := range facetSpecs {
+		valueLabel := spec.valueLabel
+		if valueLabel == "" {
+			valueLabel = "NULL"
+		}
+		values[i] = fmt.Sprintf("(%v, %v, %v)", pq.QuoteLiteral(spec.name), spec.value, valueLabel)
+	}
+	where := append(s.where,
+		"(cluster_key, short_category, title) IN (SELECT c.cluster_key, c.short_category, c.title FROM "+s.clusterJoin()+")")
+
+	facetsQuery := fmt.Sprintf(`
+SELECT f.facet, f.value, COALESCE(min(f.label), ''), count(1)
+FROM (
+	SELECT short_category, day_of_week, start_time, cost, experience_required, age_required, org_group
+	FROM %v
+	WHERE %v
+) m LEFT JOIN %v o ON o.alias = lower(m.org_group)
+	CROSS JOIN LATERAL (VALUES %v) AS f(facet, value, label)
+WHERE f.value IS NOT NULL
+GROUP BY f.facet, f.value
+`, s.from, allOf(where), orgAliases, strings.Join(values, ",\n\t\t"))
+	return facetsQuery, s.b.args, nil
+}
+
+func loadFacets(db *sql.DB, query *ParsedQuery) ([]*Facet, error) {
+	facetsQuery, args, err := buildFacetsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(facetsQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	valuesByFacet := make(map[string][]*FacetValue)
+	for rows.Next() {
+		var facet string
+		var value FacetValue
+		if err := rows.Scan(&facet, &value.Value, &value.Label, &value.Count); err != nil {
+			return nil, err
+		}
+		valuesByFacet[facet] = append(valuesByFacet[facet], &value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return groupFacets(valuesByFacet), nil
+}
+
+// groupFacets orders and labels the counted values of each facet, leaving
+// out facets nothing was counted for.
+func groupFacets(valuesByFacet map[string][]*FacetValue) []*Facet {
+	facets := make([]*Facet, 0, len(facetSpecs))
+	for _, spec := range facetSpecs {
+		values := valuesByFacet[spec.name]
+		if len(values) == 0 {
+			continue
+		}
+
+		if spec.options != nil {
+			counts := make(map[string]*FacetValue)
+			for _, value := range values {
+				counts[value.Value] = value
+			}
+			values = values[:0]
+			for _, option := range spec.options {
+				if value, found := counts[option.key]; found {
+					value.Label = option.label
+					values = append(values, value)
+				}
+			}
+		} else {
+			if spec.name == FacetCategory {
+				for _, value := range values {
+					value.Label = events.LongCategory(value.Value)
+				}
+			}
+			sort.Slice(values, func(i, j int) bool {
+				if values[i].Count != values[j].Count {
+					return values[i].Count > values[j].Count
+				}
+				return values[i].Label < values[j].Label
+			})
+			if len(values) > maxFacetValues {
+				values = values[:maxFacetValues]
+			}
+		}
+		facets = append(facets, &Facet{Name: spec.name, Label: spec.label, Values: values})
+	}
+	return facets
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFacetsQueryMatchesSearch(t *testing.T) {
+	query := plainQuery()
+	query.TextQueries = []string{"'; DROP TABLE events; --"}
+	query.OrgId = 42
+	query.DaysOfWeek = map[string]bool{"sat": true}
+	query.Experience = []string{"none"}
+
+	sql, args, err := buildFacetsQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, searchArgs, _ := buildFindEventsQuery(query)
+	if len(args) != len(searchArgs) {
+		t.Errorf("Expected the search's args %v, got %v", searchArgs, args)
+	}
+	for _, expected := range []string{
+		"search_key @@ q",
+		"o.id = $",
+		"c.sat_tickets > 0",
+		"experience_required ILIKE $",
+		"WHEN m.cost >= 0 AND m.cost < 1 THEN 'free'",
+		"WHEN m.age_required ILIKE 'Kids Only%' THEN 'kids'",
+		"CASE m.day_of_week WHEN 3 THEN 'wed'",
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("Expected %v in the sql: %v", expected, sql)
+		}
+	}
+	if strings.Contains(sql, "DROP") {
+		t.Errorf("Search text made it into the sql: %v", sql)
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestFacetsCountEventsOnce(t *testing.T) {
+	sql, _, err := buildFacetsQuery(plainQuery())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// An org aliased as both "Paizo" and "paizo" joins each event once
+	if !strings.Contains(sql, "LEFT JOIN "+orgAliases+" o ON o.alias = lower(m.org_group)") {
+		t.Errorf("Expected events joined to one org per alias: %v", sql)
+	}
+	if strings.Contains(sql, "LEFT JOIN orgs ") {
+		t.Errorf("Expected orgs deduped by alias before joining: %v", sql)
+	}
+}
+
+func TestFacetsWithAliasesDifferingByCase(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	catalog := syntheticCatalog(benchmarkYear, 3)
+	for _, event := range catalog {
+		event.Group = "Case Org"
+	}
+	if err = copyLoad(tx, benchmarkYear, catalog); err != nil {
+		t.Fatal(err)
+	}
+	var orgId int
+	if err = tx.QueryRow("SELECT COALESCE(max(id), 0) + 1 FROM orgs").Scan(&orgId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("INSERT INTO orgs (id, alias) VALUES ($1, 'Case Org'), ($1, 'case org')", orgId); err != nil {
+		t.Fatal(err)
+	}
+
+	query := plainQuery()
+	query.Year = benchmarkYear
+	facetsQuery, args, err := buildFacetsQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := tx.Query(facetsQuery, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var facet, value, label string
+		var count int
+		if err = rows.Scan(&facet, &value, &label, &count); err != nil {
+			t.Fatal(err)
+		}
+		counts[facet] += count
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if counts[FacetOrg] != len(catalog) || counts[FacetCategory] != len(catalog) {
+		t.Errorf("Expected each of the %d events counted once, got %v", len(catalog), counts)
+	}
+}
+
+func TestGroupFacets(t *testing.T) {
+	facets := groupFacets(map[string][]*FacetValue{
+		FacetCategory: {{Value: "RPG", Count: 3}, {Value: "BGM", Count: 7}, {Value: "ANI", Count: 3}},
+		FacetDay:      {{Value: "sun", Count: 1}, {Value: "wed", Count: 2}, {Value: "fri", Count: 9}},
+		FacetOrg:      {{Value: "2", Label: "Catalyst", Count: 4}},
+	})
+
+	if len(facets) != 3 || facets[0].Name != FacetCategory || facets[1].Name != FacetDay || facets[2].Name != FacetOrg {
+		t.Fatalf("Expected category, day and org facets, got %+v", facets)
+	}
+
+	var categories []string
+	for _, value := range facets[0].Values {
+		categories = append(categories, value.Value+" "+value.Label)
+	}
+	if strings.Join(categories, ", ") != "BGM Board Games, ANI Anime Activities, RPG Role Playing Games" {
+		t.Errorf("Expected categories by count then label, got %v", categories)
+	}
+
+	var days []string
+	for _, value := range facets[1].Values {
+		days = append(days, value.Label)
+	}
+	if strings.Join(days, ", ") != "Wednesday, Friday, Sunday" {
+		t.Errorf("Expected days in con order, got %v", days)
+	}
+
+	if facets[2].Values[0].Label != "Catalyst" {
+		t.Errorf("Expected the org label from the database, got %+v", facets[2].Values[0])
+	}
+}
+
+func TestGroupFacetsLimitsValues(t *testing.T) {
+	var orgs []*FacetValue
+	for i := 0; i < maxFacetValues+5; i++ {
+		orgs = append(orgs, &FacetValue{Value: string(rune('a' + i)), Count: i})
+	}
+	facets := groupFacets(map[string][]*FacetValue{FacetOrg: orgs})
+	if len(facets[0].Values) != maxFacetValues || facets[0].Values[0].Count != maxFacetValues+4 {
+		t.Errorf("Expected the %d most common orgs, got %+v", maxFacetValues, facets[0].Values)
+	}
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"time"
+)
+
+// AbortedImport is an import the deactivation limits stopped.
+type AbortedImport struct {
+	Id                int64     `json:"id"`
+	Source            string    `json:"source"`
+	AbortedAt         time.Time `json:"aborted_at"`
+	Year              int       `json:"year"`
+	ActiveEvents      int       `json:"active_events"`
+	ParsedEvents      int       `json:"parsed_events"`
+	DeactivatedEvents int       `json:"deactivated_events"`
+	Reason            string    `json:"reason"`
+}
+
+func RecordAbortedImport(db *sql.DB, source string, abortErr *events.DeactivationError) error {
+	_, err := db.Exec(`
+INSERT INTO aborted_imports (source, year, active_events, parsed_events, deactivated_events, reason)
+VALUES ($1, $2, $3, $4, $5, $6)
+`, source, abortErr.Year, abortErr.Active, abortErr.Parsed, abortErr.Deactivated, abortErr.Reason)
+	return err
+}
+
+// LoadAbortedImports loads the most recent aborted imports, newest first.
+func LoadAbortedImports(db *sql.DB, limit int) ([]*AbortedImport, error) {
+	rows, err := db.Query(`
+SELECT id, source, aborted_at, year, active_events, parsed_events, deactivated_events, reason
+FROM aborted_imports
+ORDER BY aborted_at DESC, id DESC
+LIMIT $1
+`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aborted := make([]*AbortedImport, 0)
+	for rows.Next() {
+		var abortedImport AbortedImport
+		err = rows.Scan(&abortedImport.Id, &abortedImport.Source, &abortedImport.AbortedAt, &abortedImport.Year,
+			&abortedImport.ActiveEvents, &abortedImport.ParsedEvents, &abortedImport.DeactivatedEvents,
+			&abortedImport.Reason)
+		if err != nil {
+			return nil, err
+		}
+		aborted = append(aborted, &abortedImport)
+	}
+	return aborted, rows.Err()
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobRun is one run of a background job. FinishedAt is nil while it's still
+// running, or if the instance running it died partway through.
+type JobRun struct {
+	Id         int64          `json:"id"`
+	JobName    string         `json:"job_name"`
+	Instance   string         `json:"instance"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at"`
+	Status     string         `json:"status"`
+	Counts     map[string]int `json:"counts"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Duration is how long the run took, or has been running so far.
+func (r *JobRun) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return time.Since(r.StartedAt).Round(time.Second)
+	}
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Second)
+}
+
+// TryJobLock takes the advisory lock for a job, returning false if another
+// session already holds it. Advisory locks belong to a connection, so the
+// lock is held, and must be released, on the same conn.
+func TryJobLock(ctx context.Context, conn *sql.Conn, jobName string) (bool, error) {
+	var locked bool
+	err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext('job:' || $1))`, jobName).Scan(&locked)
+	return locked, err
+}
+
+func ReleaseJobLock(ctx context.Context, conn *sql.Conn, jobName string) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext('job:' || $1))`, jobName)
+	return err
+}
+
+// StartJobRun records that a job started, returning the run's id.
+func StartJobRun(db *sql.DB, jobName, instance string) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+INSERT INTO job_runs (job_name, instance, started_at, status)
+VALUES ($1, $2, now(), $3)
+RETURNING id
+`, jobName, instance, JobRunning).Scan(&id)
+	return id, err
+}
+
+// jobRunResult is how a run is stored: its status, counts as json and error.
+func jobRunResult(counts map[string]int, runErr error) (string, string, string, error) {
+	status := JobSucceeded
+	errorText := ""
+	if runErr != nil {
+		status = JobFailed
+		errorText = runErr.Error()
+	}
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	countsJson, err := json.Marshal(counts)
+	return status, string(countsJson), errorText, err
+}
+
+// FinishJobRun records how a job run went.
+func FinishJobRun(db *sql.DB, id int64, counts map[string]int, runErr error) error {
+	status, countsJson, errorText, err := jobRunResult(counts, runErr)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+UPDATE job_runs
+SET finished_at = now(), status = $2, counts = $3, error = $4
+WHERE id = $1
+`, id, status, countsJson, errorText)
+	return err
+}
+
+// RecordJobRun records a run that already finished, for jobs only worth
+// recording once it's known how they went.
+func RecordJobRun(db *sql.DB, jobName, instance string, startedAt time.Time, counts map[string]int, runErr error) error {
+	status, countsJson, errorText, err := jobRunResult(counts, runErr)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+INSERT INTO job_runs (job_name, instance, started_at, finished_at, status, counts, error)
+VALUES ($1, $2, $3, now(), $4, $5, $6)
+`, jobName, instance, startedAt, status, countsJson, errorText)
+	return err
+}
+
+// LastJobStart is when a job last started on any instance, zero if it never
+// has.
+func LastJobStart(db *sql.DB, jobName string) (time.Time, error) {
+	var started sql.NullTime
+	err := db.QueryRow(`
+SELECT max(started_at)
+FROM job_runs
+WHERE job_name = $1
+`, jobName).Scan(&started)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return started.Time, nil
+}
+
+// LoadJobRuns loads the most recent runs, newest first, of one job or of
+// every job if jobName is empty.
+func LoadJobRuns(db *sql.DB, jobName string, limit int) ([]*JobRun, error) {
+	rows, err := db.Query(`
+SELECT id, job_name, instance, started_at, finished_at, status, counts, error
+FROM job_runs
+WHERE $1 = '' OR job_name = $1
+ORDER BY started_at DESC, id DESC
+LIMIT $2
+`, jobName, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*JobRun, 0)
+	for rows.Next() {
+		var run JobRun
+		var finishedAt sql.NullTime
+		var countsJson []byte
+		err = rows.Scan(&run.Id, &run.JobName, &run.Instance, &run.StartedAt, &finishedAt,
+			&run.Status, &countsJson, &run.Error)
+		if err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		if err = json.Unmarshal(countsJson, &run.Counts); err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
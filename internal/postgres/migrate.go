@@ -0,0 +1,260 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration files are named 0001_name.up.sql and 0001_name.down.sql.
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered change to the schema and how to undo it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and when it was applied, nil if it hasn't
+// been.
+type MigrationState struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// SchemaError is returned when a database is missing migrations.
+type SchemaError struct {
+	Version int
+	Latest  int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("database schema is at version %d, %d is needed, run migrate up", e.Version, e.Latest)
+}
+
+// LoadMigrations loads the embedded migrations, in order.
+func LoadMigrations() ([]*Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %v", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %v and %v", version, migration.Name, match[2])
+		}
+		data, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("expected migration %d, found %d", i+1, migration.Version)
+		}
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down", migration.Version)
+		}
+	}
+	return migrations, nil
+}
+
+func createMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version integer PRIMARY KEY,
+    name text NOT NULL,
+    applied_at timestamp with time zone NOT NULL DEFAULT now()
+)`)
+	return err
+}
+
+// querier is either a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func appliedMigrations(q querier) (map[int]time.Time, error) {
+	rows, err := q.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runMigration applies or undoes a single migration in its own transaction.
+// The lock keeps two instances from migrating at once, and applied is
+// rechecked under it in case another one just did.
+func runMigration(db *sql.DB, migration *Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(tx)
+	if err != nil {
+		return err
+	}
+	if _, found := applied[migration.Version]; found == up {
+		return tx.Commit()
+	}
+
+	if up {
+		log.Printf("Applying migration %d %v", migration.Version, migration.Name)
+		_, err = tx.Exec(migration.Up)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				migration.Version, migration.Name)
+		}
+	} else {
+		log.Printf("Undoing migration %d %v", migration.Version, migration.Name)
+		_, err = tx.Exec(migration.Down)
+		if err == nil {
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("migration %d %v: %w", migration.Version, migration.Name, err)
+	}
+	return tx.Commit()
+}
+
+// MigrateUp applies every migration up to and including version, or all of
+// them if version is 0.
+func MigrateUp(db *sql.DB, version int) error {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+	if err = createMigrationsTable(db); err != nil {
+		return err
+	}
+	for _, migration := range migrations {
+		if version > 0 && migration.Version > version {
+			break
+		}
+		if err = runMigration(db, migration, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown undoes the most recent steps applied migrations.
+func MigrateDown(db *sql.DB, steps int) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	for i := len(states) - 1; i >= 0 && steps > 0; i-- {
+		if states[i].AppliedAt == nil {
+			continue
+		}
+		if err = runMigration(db, states[i].Migration, false); err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus is every known migration and whether it's been applied.
+func MigrationStatus(db *sql.DB) ([]*MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err = createMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]*MigrationState, len(migrations))
+	for i, migration := range migrations {
+		states[i] = &MigrationState{Migration: migration}
+		if appliedAt, found := applied[migration.Version]; found {
+			states[i].AppliedAt = &appliedAt
+		}
+	}
+	return states, nil
+}
+
+// CheckSchema returns a *SchemaError if the database is missing any of the
+// migrations this binary knows about. A database ahead of the binary is
+// fine, so a bad deploy can be rolled back without undoing its migrations.
+func CheckSchema(db *sql.DB) error {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return fmt.Errorf("unable to check the schema version, has migrate up been run? %w", err)
+	}
+	version := 0
+	for version+1 <= len(migrations) {
+		if _, found := applied[version+1]; !found {
+			break
+		}
+		version++
+	}
+	if version < len(migrations) {
+		return &SchemaError{Version: version, Latest: len(migrations)}
+	}
+	return nil
+}
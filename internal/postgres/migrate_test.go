@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Name != "baseline" {
+		t.Fatalf("Expected the baseline migration first, got %v", migrations)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected version %d, got %d", i+1, migration.Version)
+		}
+		if strings.Contains(migration.Up, "OWNER") {
+			t.Errorf("Migration %d sets an owner, which only works for one role", migration.Version)
+		}
+	}
+}
+
+func TestUpdateOrgKeepsEventsWithoutGroup(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	latest := ""
+	for _, migration := range migrations {
+		if strings.Contains(migration.Up, "FUNCTION update_org()") {
+			latest = migration.Up
+		}
+	}
+	// Returning NULL from a BEFORE trigger skips writing the row
+	if latest == "" || strings.Contains(latest, "RETURN NULL") {
+		t.Errorf("Expected update_org to keep every event: %v", latest)
+	}
+}
+
+func TestLoadMigrationsRejects(t *testing.T) {
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		expected string
+	}{
+		{"gap", fstest.MapFS{
+			"m/0001_a.up.sql": sql, "m/0001_a.down.sql": sql,
+			"m/0003_c.up.sql": sql, "m/0003_c.down.sql": sql,
+		}, "expected migration 2"},
+		{"missing down", fstest.MapFS{"m/0001_a.up.sql": sql}, "needs both"},
+		{"renamed", fstest.MapFS{"m/0001_a.up.sql": sql, "m/0001_b.down.sql": sql}, "named both"},
+		{"stray file", fstest.MapFS{"m/README": sql}, "unexpected migration file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadMigrations(test.files, "m")
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
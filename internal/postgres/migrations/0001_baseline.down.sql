@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS orgs;
+DROP SEQUENCE IF EXISTS orgs_id_seq;
+DROP TABLE IF EXISTS events;
+DROP FUNCTION IF EXISTS update_org();
+DROP FUNCTION IF EXISTS update_dow();
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS starred_events;
+DROP TABLE IF EXISTS boardgame_family;
+DROP TABLE IF EXISTS boardgame;
+DROP TABLE IF EXISTS party_members;
+DROP TABLE IF EXISTS parties;
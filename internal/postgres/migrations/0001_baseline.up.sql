@@ -0,0 +1,198 @@
+-- The schema as it was before migrations, which is also what databases set
+-- up by hand from the old pgAdmin dump have. Everything is IF NOT EXISTS so
+-- those databases can be brought under migrations by running this, and the
+-- columns the dump left out are added to them.
+
+CREATE TABLE IF NOT EXISTS parties
+(
+    party_id serial PRIMARY KEY,
+    name text NOT NULL,
+    year integer NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS party_members
+(
+    party_id integer NOT NULL,
+    email text NOT NULL,
+    CONSTRAINT party_members_pkey PRIMARY KEY (party_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS boardgame
+(
+    name text NOT NULL,
+    bgg_id integer NOT NULL,
+    family_ids integer[],
+    last_update date,
+    num_ratings integer,
+    avg_ratings double precision,
+    year_published integer,
+    type text,
+    CONSTRAINT boardgame_pkey PRIMARY KEY (bgg_id)
+);
+
+CREATE INDEX IF NOT EXISTS bg_name_idx ON boardgame USING btree (name);
+
+CREATE TABLE IF NOT EXISTS boardgame_family
+(
+    name text NOT NULL,
+    bgg_id integer NOT NULL,
+    game_ids integer[],
+    last_update date,
+    CONSTRAINT boardgame_family_pkey PRIMARY KEY (bgg_id)
+);
+
+ALTER TABLE boardgame_family ADD COLUMN IF NOT EXISTS game_ids integer[];
+
+CREATE INDEX IF NOT EXISTS bgf_name_idx ON boardgame_family USING btree (name);
+
+CREATE TABLE IF NOT EXISTS starred_events
+(
+    email text NOT NULL,
+    event_id character varying(13) NOT NULL,
+    level character varying(10),
+    CONSTRAINT starred_events_pkey PRIMARY KEY (event_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS users
+(
+    email text NOT NULL,
+    display_name text,
+    CONSTRAINT users_pkey PRIMARY KEY (email)
+);
+
+CREATE TABLE IF NOT EXISTS events
+(
+    event_id character varying(13) NOT NULL,
+    active boolean,
+    org_group text,
+    title text,
+    short_description text,
+    long_description text,
+    event_type character varying(50),
+    game_system text,
+    rules_edition text,
+    min_players integer,
+    max_players integer,
+    age_required character varying(50),
+    experience_required text,
+    materials_provided boolean,
+    start_time timestamp with time zone,
+    duration integer,
+    end_time timestamp with time zone,
+    gm_names text,
+    website text,
+    email text,
+    tournament boolean,
+    round_number integer,
+    total_rounds integer,
+    min_play_time integer,
+    attendee_registration text,
+    cost integer,
+    location text,
+    room_name text,
+    table_number text,
+    special_category text,
+    tickets_available integer,
+    year integer,
+    cluster_key tsvector,
+    last_modified timestamp with time zone,
+    short_category character varying(4),
+    title_tsv tsvector,
+    desc_tsv tsvector,
+    day_of_week integer,
+    search_key tsvector,
+    CONSTRAINT event_pkey PRIMARY KEY (event_id)
+);
+
+ALTER TABLE events
+    ADD COLUMN IF NOT EXISTS year integer,
+    ADD COLUMN IF NOT EXISTS cluster_key tsvector,
+    ADD COLUMN IF NOT EXISTS last_modified timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS short_category character varying(4),
+    ADD COLUMN IF NOT EXISTS title_tsv tsvector,
+    ADD COLUMN IF NOT EXISTS desc_tsv tsvector,
+    ADD COLUMN IF NOT EXISTS day_of_week integer,
+    ADD COLUMN IF NOT EXISTS search_key tsvector;
+
+CREATE INDEX IF NOT EXISTS dow_index ON events USING btree (day_of_week);
+CREATE INDEX IF NOT EXISTS org_group ON events USING btree (org_group);
+CREATE INDEX IF NOT EXISTS cat_hash_index ON events USING hash (short_category);
+CREATE INDEX IF NOT EXISTS cluster_key_index ON events USING gin (cluster_key);
+CREATE INDEX IF NOT EXISTS year_hash_index ON events USING hash (year);
+CREATE INDEX IF NOT EXISTS start_time_index ON events USING hash (start_time);
+CREATE INDEX IF NOT EXISTS title_index ON events USING btree (title);
+CREATE INDEX IF NOT EXISTS search_index ON events USING gin (search_key);
+
+CREATE OR REPLACE FUNCTION update_dow() RETURNS trigger AS $update_dow$
+BEGIN
+    NEW.day_of_week = EXTRACT (DOW FROM new.start_time AT TIME ZONE 'EDT');
+    RETURN NEW;
+END;
+$update_dow$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_dow ON events;
+CREATE TRIGGER update_dow
+    BEFORE INSERT OR UPDATE ON events
+    FOR EACH ROW EXECUTE PROCEDURE update_dow();
+
+DROP TRIGGER IF EXISTS cluster_vectorupdate ON events;
+CREATE TRIGGER cluster_vectorupdate
+    BEFORE INSERT OR UPDATE ON events
+    FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger('cluster_key', 'pg_catalog.english',
+        'title', 'short_description', 'org_group', 'event_type', 'game_system', 'rules_edition');
+
+DROP TRIGGER IF EXISTS desc_vectorupdate ON events;
+CREATE TRIGGER desc_vectorupdate
+    BEFORE INSERT OR UPDATE ON events
+    FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger('desc_tsv', 'pg_catalog.english',
+        'short_description', 'long_description');
+
+DROP TRIGGER IF EXISTS title_vectorupdate ON events;
+CREATE TRIGGER title_vectorupdate
+    BEFORE INSERT OR UPDATE ON events
+    FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger('title_tsv', 'pg_catalog.english', 'title');
+
+DROP TRIGGER IF EXISTS search_vectorupdate ON events;
+CREATE TRIGGER search_vectorupdate
+    BEFORE INSERT OR UPDATE ON events
+    FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger('search_key', 'pg_catalog.english',
+        'title', 'short_description', 'long_description', 'org_group', 'event_type', 'event_id', 'game_system');
+
+CREATE SEQUENCE IF NOT EXISTS orgs_id_seq;
+
+CREATE TABLE IF NOT EXISTS orgs
+(
+    id integer NOT NULL DEFAULT nextval('orgs_id_seq'::regclass),
+    alias text NOT NULL,
+    CONSTRAINT orgs_pkey PRIMARY KEY (id, alias)
+);
+
+CREATE INDEX IF NOT EXISTS alias_idx ON orgs USING btree (alias text_pattern_ops);
+
+-- Keeps orgs up to date with every org group, merging aliases that only
+-- differ by case and punctuation.
+CREATE OR REPLACE FUNCTION update_org() RETURNS trigger AS $update_org$
+BEGIN
+    IF new.org_group = '' OR new.org_group is null THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO orgs(alias)
+    SELECT new.org_group
+    WHERE NOT EXISTS (
+        SELECT alias FROM orgs WHERE new.org_group = alias
+    );
+
+    UPDATE orgs o
+    SET id = (SELECT MIN(o2.id) FROM orgs o2
+              WHERE TRANSLATE(LOWER(o2.alias), '''.",!:; ', '')
+                        = TRANSLATE(LOWER(o.alias), '''.",!:; ', ''))
+    WHERE o.alias = new.org_group;
+    RETURN NEW;
+END
+$update_org$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_org ON events;
+CREATE TRIGGER update_org
+    BEFORE INSERT OR UPDATE OF org_group ON events
+    FOR EACH ROW EXECUTE PROCEDURE update_org();
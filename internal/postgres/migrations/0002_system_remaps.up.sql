@@ -0,0 +1,14 @@
+-- Rules for cleaning up game systems and editions, added on the admin page
+CREATE TABLE IF NOT EXISTS system_remaps
+(
+    id serial PRIMARY KEY,
+    game_system text NOT NULL DEFAULT '',
+    rules_edition text NOT NULL DEFAULT '',
+    title text NOT NULL DEFAULT '',
+    title_contains text NOT NULL DEFAULT '',
+    new_game_system text NOT NULL DEFAULT '',
+    new_rules_edition text NOT NULL DEFAULT '',
+    note text NOT NULL DEFAULT '',
+    created_by text,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
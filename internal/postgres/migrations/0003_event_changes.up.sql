@@ -0,0 +1,14 @@
+-- Per field changes to events, found when importing the catalog
+CREATE TABLE IF NOT EXISTS event_changes
+(
+    id serial PRIMARY KEY,
+    event_id character varying(13) NOT NULL,
+    year integer NOT NULL,
+    kind character varying(20) NOT NULL,
+    old_value text NOT NULL DEFAULT '',
+    new_value text NOT NULL DEFAULT '',
+    detected_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS event_changes_event_idx ON event_changes USING btree (event_id);
+CREATE INDEX IF NOT EXISTS event_changes_detected_idx ON event_changes USING btree (year, detected_at);
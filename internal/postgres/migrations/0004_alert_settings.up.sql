@@ -0,0 +1,8 @@
+-- How each user wants to hear about changes to their starred events
+CREATE TABLE IF NOT EXISTS alert_settings
+(
+    email text NOT NULL,
+    email_enabled boolean NOT NULL DEFAULT false,
+    webhook_url text NOT NULL DEFAULT '',
+    CONSTRAINT alert_settings_pkey PRIMARY KEY (email)
+);
@@ -0,0 +1,8 @@
+-- Tickets available per event, as of each import that changed them
+CREATE TABLE IF NOT EXISTS ticket_history
+(
+    event_id character varying(13) NOT NULL,
+    observed_at timestamp with time zone NOT NULL,
+    tickets_available integer NOT NULL,
+    CONSTRAINT ticket_history_pkey PRIMARY KEY (event_id, observed_at)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS sellout_estimates;
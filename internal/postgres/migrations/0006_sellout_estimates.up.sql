@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS sellout_estimates
+(
+    event_id character varying(13) NOT NULL,
+    rate_per_hour double precision NOT NULL,
+    -- Null when the event isn't selling
+    hours_to_sellout double precision,
+    updated_at timestamp with time zone NOT NULL,
+    CONSTRAINT sellout_estimates_pkey PRIMARY KEY (event_id)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS job_runs
+(
+    id bigserial NOT NULL,
+    job_name text NOT NULL,
+    -- Which web dyno or host ran it
+    instance text NOT NULL DEFAULT '',
+    started_at timestamp with time zone NOT NULL DEFAULT now(),
+    -- Null while running, or if the instance died partway through
+    finished_at timestamp with time zone,
+    status text NOT NULL,
+    counts jsonb NOT NULL DEFAULT '{}',
+    error text NOT NULL DEFAULT '',
+    CONSTRAINT job_runs_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_name_started_idx ON job_runs USING btree (job_name, started_at DESC);
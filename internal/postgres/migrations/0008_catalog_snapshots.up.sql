@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS catalog_snapshots
+(
+    id bigserial NOT NULL,
+    source_url text NOT NULL,
+    sha256 character(64) NOT NULL,
+    -- Where the raw file is in the snapshot store
+    path text NOT NULL,
+    size bigint NOT NULL,
+    content_type text NOT NULL DEFAULT '',
+    etag text NOT NULL DEFAULT '',
+    last_modified text NOT NULL DEFAULT '',
+    fetched_at timestamp with time zone NOT NULL,
+    imported_at timestamp with time zone,
+    CONSTRAINT catalog_snapshots_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS catalog_snapshots_url_idx ON catalog_snapshots USING btree (source_url, imported_at DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS aborted_imports;
@@ -0,0 +1,13 @@
+-- Imports stopped for deactivating too many events
+CREATE TABLE IF NOT EXISTS aborted_imports
+(
+    id bigserial NOT NULL,
+    source text NOT NULL,
+    aborted_at timestamp with time zone NOT NULL DEFAULT now(),
+    year integer NOT NULL,
+    active_events integer NOT NULL,
+    parsed_events integer NOT NULL,
+    deactivated_events integer NOT NULL,
+    reason text NOT NULL,
+    CONSTRAINT aborted_imports_pkey PRIMARY KEY (id)
+);
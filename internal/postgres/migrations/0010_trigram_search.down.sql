@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS org_group_trgm_idx;
+DROP INDEX IF EXISTS game_system_trgm_idx;
+DROP INDEX IF EXISTS title_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
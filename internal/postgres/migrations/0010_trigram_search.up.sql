@@ -0,0 +1,7 @@
+-- Lets searches match misspellings and partial words of titles, game
+-- systems and organizers
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS title_trgm_idx ON events USING gin (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS game_system_trgm_idx ON events USING gin (game_system gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS org_group_trgm_idx ON events USING gin (org_group gin_trgm_ops);
@@ -0,0 +1,20 @@
+CREATE OR REPLACE FUNCTION update_org() RETURNS trigger AS $update_org$
+BEGIN
+    IF new.org_group = '' OR new.org_group is null THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO orgs(alias)
+    SELECT new.org_group
+    WHERE NOT EXISTS (
+        SELECT alias FROM orgs WHERE new.org_group = alias
+    );
+
+    UPDATE orgs o
+    SET id = (SELECT MIN(o2.id) FROM orgs o2
+              WHERE TRANSLATE(LOWER(o2.alias), '''.",!:; ', '')
+                        = TRANSLATE(LOWER(o.alias), '''.",!:; ', ''))
+    WHERE o.alias = new.org_group;
+    RETURN NEW;
+END
+$update_org$ LANGUAGE plpgsql;
@@ -0,0 +1,255 @@
+package postgres
+
+import (
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/search"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// queryBuilder binds arguments for a query as it's built, so that nothing a
+// user typed ends up in the sql itself.
+type queryBuilder struct {
+	args []interface{}
+}
+
+// arg binds a value, returning its placeholder. The placeholder can be used
+// any number of times.
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// cond returns condition with each ? in it bound to the next of args. The
+// condition itself must never come from user input.
+func (b *queryBuilder) cond(condition string, args ...interface{}) string {
+	parts := strings.Split(condition, "?")
+	if len(parts) != len(args)+1 {
+		panic(fmt.Sprintf("%d args for condition %q", len(args), condition))
+	}
+	var bound strings.Builder
+	for i, part := range parts {
+		bound.WriteString(part)
+		if i < len(args) {
+			bound.WriteString(b.arg(args[i]))
+		}
+	}
+	return bound.String()
+}
+
+// allOf ands conditions together, true if there are none.
+func allOf(conditions []string) string {
+	if len(conditions) == 0 {
+		return "true"
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")"
+}
+
+// anyOf ors conditions together, false if there are none.
+func anyOf(conditions []string) string {
+	if len(conditions) == 0 {
+		return "false"
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// websearchText turns search terms into text for websearch_to_tsquery, which
+// accepts anything without error. Terms with spaces are searched as phrases
+// and excluded terms are negated. Quotes and dashes inside a term are
+// dropped, since they'd change how the rest of it is read, as are nul bytes,
+// which postgres won't take in text.
+func websearchText(terms []string, excluded []string) string {
+	clean := func(term string) string {
+		term = strings.NewReplacer(`"`, " ", "-", " ", "\x00", " ").Replace(term)
+		term = strings.Join(strings.Fields(term), " ")
+		if strings.Contains(term, " ") {
+			return `"` + term + `"`
+		}
+		return term
+	}
+
+	words := make([]string, 0, len(terms)+len(excluded))
+	for _, term := range terms {
+		if term = clean(term); term != "" {
+			words = append(words, term)
+		}
+	}
+	for _, term := range excluded {
+		if term = clean(term); term != "" {
+			words = append(words, "-"+term)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Shorter terms have too few trigrams to be told apart from other words
+const minFuzzyTermLength = 3
+
+// prefixText turns search terms into text for to_tsquery, matching any word
+// that starts with each word of the terms. Only letters and digits are kept,
+// since everything else means something to to_tsquery.
+func prefixText(terms []string) string {
+	var words []string
+	for _, term := range terms {
+		for _, word := range strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			words = append(words, word+":*")
+		}
+	}
+	return strings.Join(words, " & ")
+}
+
+// cleanText drops nul bytes, which postgres won't take in text, and extra
+// whitespace.
+func cleanText(text string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(text, "\x00", " ")), " ")
+}
+
+// fuzzyTerms are the search terms for trigram matching, nil if any are too
+// short to match that way.
+func fuzzyTerms(terms []string) []string {
+	var fuzzy []string
+	for _, term := range terms {
+		term = cleanText(term)
+		if utf8.RuneCountInString(term) < minFuzzyTermLength {
+			return nil
+		}
+		fuzzy = append(fuzzy, term)
+	}
+	return fuzzy
+}
+
+// inexactTextConditions match events that a search's text would find if it
+// allowed for partial words, and for misspellings of titles, game systems
+// and organizers. Excluded text still has to be missing exactly.
+func (b *queryBuilder) inexactTextConditions(query *ParsedQuery) []string {
+	var matches []string
+	if prefix := prefixText(query.TextQueries); prefix != "" {
+		matches = append(matches, b.cond("search_key @@ to_tsquery('english', ?)", prefix))
+	}
+	if terms := fuzzyTerms(query.TextQueries); len(terms) > 0 {
+		termMatches := make([]string, 0, len(terms))
+		for _, term := range terms {
+			termMatches = append(termMatches, fmt.Sprintf(
+				"(%[1]v <%% title OR %[1]v <%% game_system OR %[1]v <%% org_group)", b.arg(term)))
+		}
+		matches = append(matches, allOf(termMatches))
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	if excluded := websearchText(nil, query.ExcludedText); excluded != "" {
+		return []string{allOf([]string{
+			anyOf(matches),
+			b.cond("search_key @@ websearch_to_tsquery('english', ?)", excluded),
+		})}
+	}
+	return matches
+}
+
+// How each search field is matched against an event, with ? for the value.
+// Number fields have their comparison filled in for %v.
+var fieldConditions = map[string]string{
+	"system":   `game_system ILIKE '%' || ? || '%'`,
+	"org":      `org_group ILIKE '%' || ? || '%'`,
+	"gm":       `gm_names ILIKE '%' || ? || '%'`,
+	"title":    `title ILIKE '%' || ? || '%'`,
+	"cat":      `short_category = ?`,
+	"day":      `day_of_week = CAST(? AS integer)`,
+	"age":      `age_required ILIKE ? || '%'`,
+	"cost":     `cost %v ?`,
+	"tickets":  `tickets_available %v ?`,
+	"start":    `EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') %v ?`,
+	"end":      `EXTRACT(HOUR FROM end_time AT TIME ZONE 'EDT') %v ?`,
+	"duration": `duration %v ?`,
+}
+
+var sqlOps = map[search.Op]string{
+	search.OpEqual:        "=",
+	search.OpLess:         "<",
+	search.OpLessEqual:    "<=",
+	search.OpGreater:      ">",
+	search.OpGreaterEqual: ">=",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filterCondition is the sql for a search term on a field. The parser has
+// already checked the field and values, so anything else is a bug.
+func (b *queryBuilder) filterCondition(term *search.Term) (string, error) {
+	condition, found := fieldConditions[term.Field]
+	op, opFound := sqlOps[term.Op]
+	if !found || !opFound {
+		return "", fmt.Errorf("can't search %v with %v", term.Field, term.Op)
+	}
+	numeric := strings.Contains(condition, "%v")
+	if numeric {
+		condition = fmt.Sprintf(condition, op)
+	}
+
+	matches := make([]string, 0, len(term.Values))
+	for _, value := range term.Values {
+		var arg interface{} = value
+		if numeric {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return "", fmt.Errorf("%v needs a number, not %q", term.Field, value)
+			}
+			arg = number
+		} else if strings.Contains(condition, "ILIKE") {
+			arg = likeEscaper.Replace(value)
+		}
+		matches = append(matches, b.cond(condition, arg))
+	}
+
+	if term.Negated {
+		return anyOf(matches) + " IS NOT TRUE", nil
+	}
+	return anyOf(matches), nil
+}
+
+// requirementCondition matches any of the requirements with the given keys,
+// which the catalog starts with the label of. Unknown keys are skipped, so
+// nothing matches if none are known.
+func (b *queryBuilder) requirementCondition(column string, requirements []events.Requirement, keys []string) string {
+	matches := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if requirement, found := events.FindRequirement(requirements, key); found {
+			matches = append(matches, b.cond(column+" ILIKE ? || '%'", likeEscaper.Replace(requirement.Label)))
+		}
+	}
+	return anyOf(matches)
+}
+
+// conditions is the sql for the filters that are set.
+func (f *EventFilters) conditions(b *queryBuilder) []string {
+	var conditions []string
+	if f.MaxCost != nil {
+		conditions = append(conditions, b.cond("cost <= ?", *f.MaxCost))
+	}
+	if len(f.AgeGroups) > 0 {
+		conditions = append(conditions, b.requirementCondition("age_required", events.AgeGroups, f.AgeGroups))
+	}
+	if len(f.Experience) > 0 {
+		conditions = append(conditions, b.requirementCondition("experience_required", events.ExperienceLevels, f.Experience))
+	}
+	if f.Players > 0 {
+		players := b.arg(f.Players)
+		conditions = append(conditions, fmt.Sprintf("min_players <= %v AND max_players >= %v", players, players))
+	}
+	if f.MaxDuration > 0 {
+		conditions = append(conditions, b.cond("duration <= ?", f.MaxDuration))
+	}
+	if f.MaterialsProvided {
+		conditions = append(conditions, "materials_provided")
+	}
+	if f.Tournament != nil {
+		conditions = append(conditions, b.cond("tournament = ?", *f.Tournament))
+	}
+	return conditions
+}
@@ -0,0 +1,491 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/search"
+	"github.com/lib/pq"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var hostileInputs = []string{
+	`'; DROP TABLE events; --`,
+	`') q; DELETE FROM starred_events; --`,
+	`\'); SELECT pg_sleep(10); --`,
+	`$1 $2 ? ?`,
+	`catan' & 'x`,
+	`!(a | b) <-> c:*`,
+	`/* comment */ OR 1=1`,
+	"null\x00byte",
+	`"unterminated`,
+	`-`,
+	`ßüñ 🎲 ゲーム`,
+}
+
+func plainQuery() *ParsedQuery {
+	return &ParsedQuery{
+		Year:            2023,
+		StartBeforeHour: -1,
+		StartAfterHour:  -1,
+		EndBeforeHour:   -1,
+		EndAfterHour:    -1,
+	}
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// checkPlaceholders checks every arg is used and every placeholder has an
+// arg.
+func checkPlaceholders(t *testing.T, sql string, args []interface{}) {
+	t.Helper()
+	used := make(map[string]bool)
+	for _, match := range placeholder.FindAllStringSubmatch(sql, -1) {
+		used[match[1]] = true
+	}
+	if len(used) != len(args) {
+		t.Errorf("%d placeholders used for %d args in %v", len(used), len(args), sql)
+	}
+}
+
+func TestFindEventsQueryHostileText(t *testing.T) {
+	query := plainQuery()
+	query.TextQueries = []string{"catan"}
+	query.ExcludedText = []string{"europe"}
+	textSql, _, _ := buildFindEventsQuery(query)
+	// Inputs with nothing left to search for once cleaned up
+	noTextSql, _, _ := buildFindEventsQuery(plainQuery())
+
+	for _, input := range hostileInputs {
+		query := plainQuery()
+		query.TextQueries = []string{input}
+		query.ExcludedText = []string{input}
+		sql, args, _ := buildFindEventsQuery(query)
+		if sql != textSql && sql != noTextSql {
+			t.Errorf("Input %q changed the sql to %v", input, sql)
+		}
+		checkPlaceholders(t, sql, args)
+	}
+}
+
+func TestFindEventsQueryHostileDays(t *testing.T) {
+	query := plainQuery()
+	query.DaysOfWeek = map[string]bool{
+		"fri":                         true,
+		"wed_tickets > 0 OR true; --": true,
+		"sat); DROP TABLE events; --": true,
+	}
+	sql, args, _ := buildFindEventsQuery(query)
+	if strings.Contains(sql, "DROP") || strings.Contains(sql, "OR true") {
+		t.Errorf("Unknown days made it into the sql: %v", sql)
+	}
+	if !strings.Contains(sql, "c.fri_tickets > 0") {
+		t.Errorf("Expected friday in the sql: %v", sql)
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestFindEventsQueryBindsEverything(t *testing.T) {
+	query := plainQuery()
+	query.Year = 1999
+	query.StartAfterHour = 17
+	query.StartBeforeHour = 21
+	query.EndAfterHour = 18
+	query.EndBeforeHour = 23
+	query.OrgId = 424242
+	query.TextQueries = []string{"werewolf"}
+	query.SortBy = "'; DROP TABLE events; --"
+
+	sql, args, _ := buildFindEventsQuery(query)
+	for _, literal := range []string{"1999", "17", "21", "18", "23", "424242", "werewolf", "DROP"} {
+		if strings.Contains(sql, literal) {
+			t.Errorf("Expected %v to be bound, not in the sql: %v", literal, sql)
+		}
+	}
+	expectedArgs := []interface{}{1999, 21, 17, 23, 18, "werewolf", "werewolf:*", "werewolf", "werewolf", 424242}
+	if len(args) != len(expectedArgs) {
+		t.Fatalf("Expected args %v, got %v", expectedArgs, args)
+	}
+	for i := range args {
+		if args[i] != expectedArgs[i] {
+			t.Errorf("Expected arg %d to be %v, got %v", i+1, expectedArgs[i], args[i])
+		}
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestWebsearchText(t *testing.T) {
+	tests := []struct {
+		terms    []string
+		excluded []string
+		expected string
+	}{
+		{nil, nil, ""},
+		{[]string{"catan", "seafarers"}, nil, "catan seafarers"},
+		{[]string{"ticket to ride"}, []string{"europe"}, `"ticket to ride" -europe`},
+		{[]string{`"quoted`, "a-b"}, []string{"-", `"`}, `quoted "a b"`},
+		{[]string{"nul\x00byte"}, nil, `"nul byte"`},
+	}
+	for _, test := range tests {
+		actual := websearchText(test.terms, test.excluded)
+		if actual != test.expected {
+			t.Errorf("websearchText(%q, %q) = %q, expected %q", test.terms, test.excluded, actual, test.expected)
+		}
+	}
+}
+
+func TestQueryBuilderCond(t *testing.T) {
+	b := &queryBuilder{}
+	first := b.arg(2023)
+	cond := b.cond("start >= ? AND start <= ?", 10, 12)
+	if first != "$1" || cond != "start >= $2 AND start <= $3" || len(b.args) != 3 {
+		t.Errorf("Unexpected %v %v %v", first, cond, b.args)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic for mismatched args")
+		}
+	}()
+	b.cond("a = ? AND b = ?", 1)
+}
+
+func TestFieldConditionsCoverSearchFields(t *testing.T) {
+	for _, field := range search.FieldNames() {
+		if _, found := fieldConditions[field]; !found {
+			t.Errorf("No condition for search field %v", field)
+		}
+	}
+}
+
+func TestFilterConditions(t *testing.T) {
+	parsed, err := search.Parse(`system:"50%_off" cost<=4 day:fri,sat -cat:TDA start>=18`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	query := plainQuery()
+	query.Filters = parsed.Filters()
+	sql, args, err := buildFindEventsQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`(game_system ILIKE '%' || $2 || '%')`,
+		`(cost <= $3)`,
+		`(day_of_week = CAST($4 AS integer) OR day_of_week = CAST($5 AS integer))`,
+		`(short_category = $6) IS NOT TRUE`,
+		`(EXTRACT(HOUR FROM start_time AT TIME ZONE 'EDT') >= $7)`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("Expected %v in the sql: %v", expected, sql)
+		}
+	}
+	expectedArgs := []interface{}{2023, `50\%\_off`, 4, "5", "6", "TDA", 18}
+	if len(args) != len(expectedArgs) {
+		t.Fatalf("Expected args %v, got %v", expectedArgs, args)
+	}
+	for i := range args {
+		if args[i] != expectedArgs[i] {
+			t.Errorf("Expected arg %d to be %v, got %v", i+1, expectedArgs[i], args[i])
+		}
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestFilterConditionsHostileValues(t *testing.T) {
+	for _, input := range hostileInputs {
+		for _, field := range []string{"system", "org", "gm", "title"} {
+			query := plainQuery()
+			query.Filters = []*search.Term{{Field: field, Op: search.OpEqual, Values: []string{input}}}
+			sql, args, err := buildFindEventsQuery(query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Contains(sql, input) {
+				t.Errorf("Input %q made it into the sql: %v", input, sql)
+			}
+			checkPlaceholders(t, sql, args)
+		}
+	}
+
+	// The parser never makes these, but they still mustn't reach the sql
+	query := plainQuery()
+	query.Filters = []*search.Term{{Field: "cost); DROP TABLE events; --", Op: search.OpEqual, Values: []string{"1"}}}
+	if _, _, err := buildFindEventsQuery(query); err == nil {
+		t.Errorf("Expected an error for an unknown field")
+	}
+	query.Filters = []*search.Term{{Field: "cost", Op: "; DROP TABLE events; --", Values: []string{"1"}}}
+	if _, _, err := buildFindEventsQuery(query); err == nil {
+		t.Errorf("Expected an error for an unknown op")
+	}
+	query.Filters = []*search.Term{{Field: "cost", Op: search.OpLess, Values: []string{"1; DROP TABLE events"}}}
+	if _, _, err := buildFindEventsQuery(query); err == nil {
+		t.Errorf("Expected an error for a number that isn't one")
+	}
+}
+
+func TestEventFilterConditions(t *testing.T) {
+	// Free, kid friendly, no experience, under 2 hours, materials provided
+	free := 0
+	notTournament := false
+	query := plainQuery()
+	query.MaxCost = &free
+	query.AgeGroups = []string{"kids", "everyone", "'; DROP TABLE events; --"}
+	query.Experience = []string{"none"}
+	query.Players = 4
+	query.MaxDuration = 120
+	query.MaterialsProvided = true
+	query.Tournament = &notTournament
+
+	sql, args, err := buildFindEventsQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		`cost <= $2`,
+		`(age_required ILIKE $3 || '%' OR age_required ILIKE $4 || '%')`,
+		`(experience_required ILIKE $5 || '%')`,
+		`min_players <= $6 AND max_players >= $6`,
+		`duration <= $7`,
+		`materials_provided`,
+		`tournament = $8`,
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("Expected %v in the sql: %v", expected, sql)
+		}
+	}
+	if strings.Contains(sql, "DROP") {
+		t.Errorf("Unknown age group made it into the sql: %v", sql)
+	}
+	expectedArgs := []interface{}{2023, 0, "Kids Only", "Everyone", "None", 4, 120, false}
+	if len(args) != len(expectedArgs) {
+		t.Fatalf("Expected args %v, got %v", expectedArgs, args)
+	}
+	for i := range args {
+		if args[i] != expectedArgs[i] {
+			t.Errorf("Expected arg %d to be %v, got %v", i+1, expectedArgs[i], args[i])
+		}
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestEventFilterConditionsUnset(t *testing.T) {
+	b := &queryBuilder{}
+	if conditions := (&EventFilters{}).conditions(b); len(conditions) != 0 || len(b.args) != 0 {
+		t.Errorf("Expected no conditions for empty filters, got %v %v", conditions, b.args)
+	}
+	// Only unknown keys match nothing, rather than everything
+	conditions := (&EventFilters{Experience: []string{"guru"}}).conditions(b)
+	if len(conditions) != 1 || conditions[0] != "false" {
+		t.Errorf("Expected unknown experience to match nothing, got %v", conditions)
+	}
+}
+
+func TestPrefixText(t *testing.T) {
+	tests := []struct {
+		terms    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"gloom"}, "gloom:*"},
+		{[]string{"ticket to", "rid"}, "ticket:* & to:* & rid:*"},
+		{[]string{`catan' & 'x`, "!(a | b) <-> c:*"}, "catan:* & x:* & a:* & b:* & c:*"},
+		{[]string{"🎲", "--"}, ""},
+	}
+	for _, test := range tests {
+		if actual := prefixText(test.terms); actual != test.expected {
+			t.Errorf("prefixText(%q) = %q, expected %q", test.terms, actual, test.expected)
+		}
+	}
+}
+
+func TestInexactTextConditions(t *testing.T) {
+	query := plainQuery()
+	query.TextQueries = []string{"gloom", "villianous"}
+	b := &queryBuilder{}
+	conditions := b.inexactTextConditions(query)
+	expected := []string{
+		"search_key @@ to_tsquery('english', $1)",
+		"(($2 <% title OR $2 <% game_system OR $2 <% org_group) AND ($3 <% title OR $3 <% game_system OR $3 <% org_group))",
+	}
+	if !reflect.DeepEqual(conditions, expected) {
+		t.Errorf("Unexpected conditions %q", conditions)
+	}
+
+	// Too short to match on trigrams, and excluded text still applies
+	query.TextQueries = []string{"go"}
+	query.ExcludedText = []string{"europe"}
+	b = &queryBuilder{}
+	conditions = b.inexactTextConditions(query)
+	expected = []string{"((search_key @@ to_tsquery('english', $1)) AND search_key @@ websearch_to_tsquery('english', $2))"}
+	if !reflect.DeepEqual(conditions, expected) || !reflect.DeepEqual(b.args, []interface{}{"go:*", "-europe"}) {
+		t.Errorf("Unexpected conditions %q %v", conditions, b.args)
+	}
+
+	query.TextQueries = nil
+	if conditions := (&queryBuilder{}).inexactTextConditions(query); conditions != nil {
+		t.Errorf("Expected no conditions when only excluding, got %q", conditions)
+	}
+}
+
+func TestFindEventsQueryInexactOnlyWithoutExact(t *testing.T) {
+	query := plainQuery()
+	query.TextQueries = []string{"catan"}
+	query.MaxCost = new(int)
+
+	sql, args, err := buildFindEventsQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The exact search, filters and all, has to find nothing first
+	expected := "(search_key @@ q OR (NOT EXISTS (SELECT 1 FROM events LEFT JOIN sellout_estimates USING (event_id), " +
+		"websearch_to_tsquery('english', $3) q WHERE (active AND year = $1 AND cost <= $2 AND search_key @@ q)) AND " +
+		"(search_key @@ to_tsquery('english', $4) OR (($5 <% title OR $5 <% game_system OR $5 <% org_group)))))"
+	if !strings.Contains(sql, expected) {
+		t.Errorf("Expected %v in the sql: %v", expected, sql)
+	}
+	checkPlaceholders(t, sql, args)
+}
+
+func TestFindEventsExactTitle(t *testing.T) {
+	db := openTestDb(t)
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	catalog := syntheticCatalog(benchmarkYear, 2)
+	catalog[0].Title = "Catan"
+	catalog[1].Title = "Catacombs"
+	if err = copyLoad(tx, benchmarkYear, catalog); err != nil {
+		t.Fatal(err)
+	}
+	_, err = tx.Exec(`
+INSERT INTO orgs (id, alias)
+SELECT (SELECT COALESCE(max(id), 0) FROM orgs) + row_number() OVER (), org_group
+FROM (SELECT DISTINCT org_group FROM events WHERE year = $1) g`, benchmarkYear)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		// Catacombs looks like catan, but catan matches exactly
+		{"catan", []string{"Catan"}},
+		{"cata", []string{"Catacombs", "Catan"}},
+	}
+	for _, test := range tests {
+		query := plainQuery()
+		query.Year = benchmarkYear
+		query.TextQueries = []string{test.text}
+		query.SortBy = SortByTitle
+		fullQuery, args, err := buildFindEventsQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := tx.Query(fullQuery, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for rows.Next() {
+			var sortKey []sql.NullString
+			group, err := rowToGroup(rows, pq.Array(&sortKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles = append(titles, group.Name)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(titles, test.expected) {
+			t.Errorf("Searching %q found %v, expected %v", test.text, titles, test.expected)
+		}
+	}
+}
+
+func sortKey(values ...string) SortKey {
+	key := make(SortKey, len(values))
+	for i := range values {
+		if values[i] != "NULL" {
+			key[i] = &values[i]
+		}
+	}
+	return key
+}
+
+func TestFindEventsQueryPages(t *testing.T) {
+	query := plainQuery()
+	query.OrgId = 7
+	query.Limit = 25
+	query.SortBy = SortBySellOutRisk
+	query.After = sortKey("false", "NULL", "1", "1", "1", "12", "RPG23ND00001")
+
+	sql, args, err := buildFindEventsQuery(query)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"ARRAY[CAST(c.tickets_available = 0 AS text), CAST(c.sellout_hours AS text), ",
+		"CAST(e.event_id AS text)] AS sort_key",
+		// Nothing sorts after a null ascending, so the key's null means
+		// staying on the same sell out hours
+		"((c.tickets_available = 0) > $3 OR (c.tickets_available = 0) IS NULL)",
+		"((c.tickets_available = 0) = $3 AND (c.sellout_hours) IS NULL AND (c.title_rank) < $4)",
+		"(c.tickets_available) = $7 AND ((e.event_id) > $8 OR (e.event_id) IS NULL))",
+		"e.event_id\nLIMIT $9",
+	} {
+		if !strings.Contains(sql, expected) {
+			t.Errorf("Expected %v in the sql: %v", expected, sql)
+		}
+	}
+	if strings.Contains(sql, "OFFSET") || strings.Contains(sql, "(c.sellout_hours) >") {
+		t.Errorf("Expected the page to start after the key: %v", sql)
+	}
+	expectedArgs := []interface{}{2023, 7, "false", "1", "1", "1", "12", "RPG23ND00001", 25}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("Expected args %v, got %v", expectedArgs, args)
+	}
+	checkPlaceholders(t, sql, args)
+
+	// Descending, everything sorts after a null
+	query.SortBy = ""
+	query.After = sortKey("NULL", "1", "1", "12", "RPG23ND00001")
+	sql, _, _ = buildFindEventsQuery(query)
+	if !strings.Contains(sql, "((c.title_rank) IS NOT NULL)") {
+		t.Errorf("Expected every rank after a null rank: %v", sql)
+	}
+
+	query.After = sortKey("RPG23ND00001")
+	if _, _, err := buildFindEventsQuery(query); err != ErrBadSortKey {
+		t.Errorf("Expected a key from another sort to be rejected, got %v", err)
+	}
+	if sql, _, _ := buildFindEventsQuery(plainQuery()); strings.Contains(sql, "LIMIT") {
+		t.Errorf("Expected every result without a limit: %v", sql)
+	}
+}
+
+func TestFindEventsQuerySorts(t *testing.T) {
+	tests := []struct {
+		sortBy   string
+		expected string
+	}{
+		{"", "ORDER BY c.title_rank desc"},
+		{SortBySellOutRisk, "ORDER BY c.tickets_available = 0, c.sellout_hours, c.title_rank desc"},
+		{SortByStart, "ORDER BY c.start_time, c.title_rank desc"},
+		{SortByTitle, "ORDER BY lower(e.title), c.title_rank desc"},
+		{"'; DROP TABLE events; --", "ORDER BY c.title_rank desc"},
+	}
+	for _, test := range tests {
+		query := plainQuery()
+		query.SortBy = test.sortBy
+		sql, _, _ := buildFindEventsQuery(query)
+		if !strings.Contains(sql, test.expected) {
+			t.Errorf("Expected %v sorting by %q: %v", test.expected, test.sortBy, sql)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+)
+
+// SystemUsage is one distinct title/game system/edition combination in a
+// year, and how many events use it.
+type SystemUsage struct {
+	Title        string
+	GameSystem   string
+	RulesEdition string
+	NumEvents    int64
+}
+
+// LoadRemapRules loads the rules added through the admin page, in the order
+// they were added.
+func LoadRemapRules(db *sql.DB) (events.RemapRules, error) {
+	rows, err := db.Query(`
+SELECT id, game_system, rules_edition, title, title_contains,
+       new_game_system, new_rules_edition, note
+FROM system_remaps
+ORDER BY id
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	rules := make(events.RemapRules, 0)
+	for rows.Next() {
+		var r events.RemapRule
+		err = rows.Scan(&r.Id, &r.GameSystem, &r.RulesEdition, &r.Title, &r.TitleContains,
+			&r.NewGameSystem, &r.NewRulesEdition, &r.Note)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func AddRemapRule(db *sql.DB, rule *events.RemapRule, email string) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	return db.QueryRow(`
+INSERT INTO system_remaps
+    (game_system, rules_edition, title, title_contains,
+     new_game_system, new_rules_edition, note, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id
+`, rule.GameSystem, rule.RulesEdition, rule.Title, rule.TitleContains,
+		rule.NewGameSystem, rule.NewRulesEdition, rule.Note, email).Scan(&rule.Id)
+}
+
+func DeleteRemapRule(db *sql.DB, id int64) error {
+	_, err := db.Exec(`DELETE FROM system_remaps WHERE id = $1`, id)
+	return err
+}
+
+// LoadSystemUsage lists every title/game system/edition combination in the
+// given year. Rules only look at those three fields, so this is enough to
+// preview or re-apply rules without loading every event.
+func LoadSystemUsage(db *sql.DB, year int) ([]*SystemUsage, error) {
+	rows, err := db.Query(`
+SELECT COALESCE(title, ''), COALESCE(game_system, ''), COALESCE(rules_edition, ''), count(1)
+FROM events
+WHERE year = $1 AND active
+GROUP BY 1, 2, 3
+ORDER BY 2, 3, 1
+`, year)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	usages := make([]*SystemUsage, 0)
+	for rows.Next() {
+		var u SystemUsage
+		err = rows.Scan(&u.Title, &u.GameSystem, &u.RulesEdition, &u.NumEvents)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, &u)
+	}
+	return usages, rows.Err()
+}
+
+// RemapEvents runs the rules over the stored events of a year, updating any
+// whose game system or edition changes. Returns the number of events updated.
+func RemapEvents(tx *sql.Tx, year int, rules events.RemapRules) (int64, error) {
+	rows, err := tx.Query(`
+SELECT DISTINCT COALESCE(title, ''), COALESCE(game_system, ''), COALESCE(rules_edition, '')
+FROM events
+WHERE year = $1
+`, year)
+	if err != nil {
+		return 0, err
+	}
+
+	var usages []SystemUsage
+	for rows.Next() {
+		var u SystemUsage
+		if err = rows.Scan(&u.Title, &u.GameSystem, &u.RulesEdition); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		usages = append(usages, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, u := range usages {
+		remapped := rules.Apply(&events.GenconEvent{
+			Title:        u.Title,
+			GameSystem:   u.GameSystem,
+			RulesEdition: u.RulesEdition,
+		})
+		if remapped.GameSystem == u.GameSystem && remapped.RulesEdition == u.RulesEdition {
+			continue
+		}
+		result, err := tx.Exec(`
+UPDATE events
+SET game_system = $1, rules_edition = $2
+WHERE year = $3
+  AND COALESCE(title, '') = $4
+  AND COALESCE(game_system, '') = $5
+  AND COALESCE(rules_edition, '') = $6
+`, remapped.GameSystem, remapped.RulesEdition, year, u.Title, u.GameSystem, u.RulesEdition)
+		if err != nil {
+			return updated, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return updated, err
+		}
+		updated += count
+	}
+	return updated, nil
+}
@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/lib/pq"
+	"math"
+	"time"
+)
+
+// How many past years of sales feed the category and game system priors.
+const priorYears = 3
+
+type eventHistory struct {
+	EventId       string
+	ShortCategory string
+	GameSystem    string
+	Tickets       int
+	History       []events.TicketCount
+}
+
+// eachEventHistory streams the ticket history of the events matched by
+// whereClause, one event at a time.
+func eachEventHistory(tx *sql.Tx, whereClause string, args []interface{}, fn func(*eventHistory)) error {
+	rows, err := tx.Query(`
+SELECT e.event_id, e.short_category, COALESCE(e.game_system, ''), e.tickets_available,
+       h.observed_at, h.tickets_available
+FROM events e
+     JOIN ticket_history h ON h.event_id = e.event_id
+WHERE `+whereClause+`
+ORDER BY e.event_id, h.observed_at
+`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var current *eventHistory
+	for rows.Next() {
+		var h eventHistory
+		var count events.TicketCount
+		err = rows.Scan(&h.EventId, &h.ShortCategory, &h.GameSystem, &h.Tickets, &count.At, &count.Tickets)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.EventId != h.EventId {
+			if current != nil {
+				fn(current)
+			}
+			current = &h
+		}
+		current.History = append(current.History, count)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if current != nil {
+		fn(current)
+	}
+	return nil
+}
+
+// UpdateSellOutEstimates recomputes the sell out estimates for a year's
+// active events from their ticket history and past years' sales.
+func UpdateSellOutEstimates(tx *sql.Tx, year int, now time.Time) error {
+	priors := events.NewSellOutPriors()
+	err := eachEventHistory(tx, "e.year < $1 AND e.year >= $2", []interface{}{year, year - priorYears},
+		func(h *eventHistory) {
+			priors.Add(h.ShortCategory, h.GameSystem, h.History)
+		})
+	if err != nil {
+		return err
+	}
+
+	var eventIds []string
+	var rates []float64
+	// Left nil, and so null, for events that aren't selling
+	var hours []interface{}
+	err = eachEventHistory(tx, "e.year = $1 AND e.active", []interface{}{year},
+		func(h *eventHistory) {
+			estimate := events.EstimateSellOut(h.ShortCategory, h.GameSystem, h.Tickets, h.History, priors, now)
+			eventIds = append(eventIds, h.EventId)
+			rates = append(rates, estimate.RatePerHour)
+			if math.IsInf(estimate.HoursToSellOut, 1) {
+				hours = append(hours, nil)
+			} else {
+				hours = append(hours, estimate.HoursToSellOut)
+			}
+		})
+	if err != nil {
+		return err
+	}
+	if len(eventIds) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(`
+INSERT INTO sellout_estimates (event_id, rate_per_hour, hours_to_sellout, updated_at)
+SELECT n.event_id, n.rate, n.hours, now()
+FROM unnest($1::text[], $2::double precision[], $3::double precision[]) AS n(event_id, rate, hours)
+ON CONFLICT (event_id)
+    DO UPDATE SET rate_per_hour = excluded.rate_per_hour,
+                  hours_to_sellout = excluded.hours_to_sellout,
+                  updated_at = excluded.updated_at
+`, pq.Array(eventIds), pq.Array(rates), pq.GenericArray{A: hours})
+	return err
+}
+
+// LoadSellOutHours loads the hours until each of the given events sells out.
+// Events that aren't selling, or that we have no estimate for, are left out.
+func LoadSellOutHours(db *sql.DB, eventIds []string) (map[string]float64, error) {
+	rows, err := db.Query(`
+SELECT event_id, hours_to_sellout
+FROM sellout_estimates
+WHERE event_id = ANY($1) AND hours_to_sellout IS NOT NULL
+`, pq.Array(eventIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hours := make(map[string]float64)
+	for rows.Next() {
+		var eventId string
+		var h float64
+		if err = rows.Scan(&eventId, &h); err != nil {
+			return nil, err
+		}
+		hours[eventId] = h
+	}
+	return hours, rows.Err()
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Snapshot is a distinct catalog download. The raw file is kept in a
+// snapshot store under Path, named by the sha256 of its contents.
+type Snapshot struct {
+	Id           int64
+	SourceUrl    string
+	Sha256       string
+	Path         string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+	// Nil until the snapshot's events are written
+	ImportedAt *time.Time
+}
+
+func AddSnapshot(db *sql.DB, snapshot *Snapshot) error {
+	return db.QueryRow(`
+INSERT INTO catalog_snapshots (source_url, sha256, path, size, content_type, etag, last_modified, fetched_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id
+`, snapshot.SourceUrl, snapshot.Sha256, snapshot.Path, snapshot.Size, snapshot.ContentType,
+		snapshot.ETag, snapshot.LastModified, snapshot.FetchedAt).Scan(&snapshot.Id)
+}
+
+func MarkSnapshotImported(db *sql.DB, id int64) error {
+	_, err := db.Exec(`UPDATE catalog_snapshots SET imported_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// LatestImportedSnapshot is the last download from a url that made it into
+// the events table, nil if there isn't one. Downloads that failed to import
+// don't count, so they get fetched and tried again.
+func LatestImportedSnapshot(db *sql.DB, sourceUrl string) (*Snapshot, error) {
+	var snapshot Snapshot
+	var importedAt time.Time
+	err := db.QueryRow(`
+SELECT id, source_url, sha256, path, size, content_type, etag, last_modified, fetched_at, imported_at
+FROM catalog_snapshots
+WHERE source_url = $1 AND imported_at IS NOT NULL
+ORDER BY imported_at DESC, id DESC
+LIMIT 1
+`, sourceUrl).Scan(&snapshot.Id, &snapshot.SourceUrl, &snapshot.Sha256, &snapshot.Path, &snapshot.Size,
+		&snapshot.ContentType, &snapshot.ETag, &snapshot.LastModified, &snapshot.FetchedAt, &importedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot.ImportedAt = &importedAt
+	return &snapshot, nil
+}
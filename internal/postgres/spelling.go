@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// Words of every active event's title, game system and organizer in a year
+const yearWords = `
+SELECT DISTINCT word
+FROM events,
+     regexp_split_to_table(
+         lower(title || ' ' || COALESCE(game_system, '') || ' ' || COALESCE(org_group, '')),
+         '[^[:alnum:]]+') AS word
+WHERE year = $1 AND active AND length(word) >= 3
+`
+
+// SpellingSuggestions finds the closest word to each of words that isn't in
+// any active event's title, game system or organizer for the year, keyed by
+// the lower cased word. Words nothing is close to are left out.
+func SpellingSuggestions(db *sql.DB, year int, words []string) (map[string]string, error) {
+	lowered := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(cleanText(word)); word != "" {
+			lowered = append(lowered, word)
+		}
+	}
+	suggestions := make(map[string]string)
+	if len(lowered) == 0 {
+		return suggestions, nil
+	}
+
+	rows, err := db.Query(`
+WITH words AS (`+yearWords+`)
+SELECT w.input, best.word
+FROM unnest($2::text[]) AS w(input)
+     CROSS JOIN LATERAL (
+         SELECT word
+         FROM words
+         WHERE word % w.input
+         ORDER BY similarity(word, w.input) DESC, word
+         LIMIT 1
+     ) best
+WHERE NOT EXISTS (SELECT 1 FROM words WHERE word = w.input)
+`, year, pq.Array(lowered))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var input, suggestion string
+		if err := rows.Scan(&input, &suggestion); err != nil {
+			return nil, err
+		}
+		suggestions[input] = suggestion
+	}
+	return suggestions, rows.Err()
+}
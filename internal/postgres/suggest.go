@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// SuggestEvent is what the search box can complete to from one event.
+type SuggestEvent struct {
+	Year       int
+	EventId    string
+	Title      string
+	GameSystem string
+	OrgGroup   string
+	// 0 if the org group isn't in orgs yet
+	OrgId int64
+}
+
+// CatalogVersion changes whenever the events or orgs that searches can be
+// completed to do, so in-memory copies know when to reload. It's only
+// comparable to other versions, not meaningful in itself.
+func CatalogVersion(db *sql.DB) (string, error) {
+	var lastModified pq.NullTime
+	var active, orgs int64
+	err := db.QueryRow(`
+SELECT max(last_modified), count(1) FILTER (WHERE active),
+       (SELECT COALESCE(sum(id), 0) + count(1) FROM orgs)
+FROM events
+`).Scan(&lastModified, &active, &orgs)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v/%v/%v", lastModified.Time.UnixNano(), active, orgs), nil
+}
+
+// LoadSuggestEvents loads every active event, with what it can be found by.
+func LoadSuggestEvents(db *sql.DB) ([]*SuggestEvent, error) {
+	rows, err := db.Query(`
+SELECT e.year, e.event_id, COALESCE(e.title, ''), COALESCE(e.game_system, ''),
+       COALESCE(e.org_group, ''), COALESCE(min(o.id), 0)
+FROM events e LEFT JOIN orgs o ON lower(o.alias) = lower(e.org_group)
+WHERE e.active
+GROUP BY 1, 2, 3, 4, 5
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loaded := make([]*SuggestEvent, 0)
+	for rows.Next() {
+		var event SuggestEvent
+		if err := rows.Scan(&event.Year, &event.EventId, &event.Title, &event.GameSystem,
+			&event.OrgGroup, &event.OrgId); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, &event)
+	}
+	return loaded, rows.Err()
+}
+
+// LoadOrgAliases loads every alias of each org, by org id.
+func LoadOrgAliases(db *sql.DB) (map[int64][]string, error) {
+	rows, err := db.Query(`SELECT id, array_agg(alias ORDER BY alias) FROM orgs GROUP BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var orgAliases []string
+		if err := rows.Scan(&id, pq.Array(&orgAliases)); err != nil {
+			return nil, err
+		}
+		aliases[id] = orgAliases
+	}
+	return aliases, rows.Err()
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/lib/pq"
+	"time"
+)
+
+// TicketObservation is the number of tickets an event had as of an import.
+// Only imports where the count changed are stored, so the count holds until
+// the next observation.
+type TicketObservation struct {
+	ObservedAt       time.Time `json:"observed_at"`
+	TicketsAvailable int       `json:"tickets_available"`
+}
+
+// recordTicketHistory adds an observation as of observedAt for every event
+// whose ticket count differs from its last observation, including events with
+// none yet.
+func recordTicketHistory(tx *sql.Tx, parsedEvents []*events.GenconEvent, observedAt time.Time) error {
+	eventIds := make([]string, len(parsedEvents))
+	tickets := make([]int64, len(parsedEvents))
+	for i, event := range parsedEvents {
+		eventIds[i] = event.EventId
+		tickets[i] = int64(event.TicketsAvailable)
+	}
+
+	_, err := tx.Exec(`
+INSERT INTO ticket_history (event_id, observed_at, tickets_available)
+SELECT n.event_id, $3, n.tickets
+FROM unnest($1::text[], $2::integer[]) AS n(event_id, tickets)
+     LEFT JOIN LATERAL (
+         SELECT h.tickets_available
+         FROM ticket_history h
+         WHERE h.event_id = n.event_id AND h.observed_at <= $3
+         ORDER BY h.observed_at DESC
+         LIMIT 1
+     ) last ON true
+WHERE last.tickets_available IS DISTINCT FROM n.tickets
+ON CONFLICT DO NOTHING
+`, pq.Array(eventIds), pq.Array(tickets), observedAt)
+	return err
+}
+
+// LoadTicketHistory loads the ticket observations for an event, oldest first.
+func LoadTicketHistory(db *sql.DB, eventId string) ([]*TicketObservation, error) {
+	rows, err := db.Query(`
+SELECT observed_at, tickets_available
+FROM ticket_history
+WHERE event_id = $1
+ORDER BY observed_at
+`, eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]*TicketObservation, 0)
+	for rows.Next() {
+		var observation TicketObservation
+		if err = rows.Scan(&observation.ObservedAt, &observation.TicketsAvailable); err != nil {
+			return nil, err
+		}
+		history = append(history, &observation)
+	}
+	return history, rows.Err()
+}
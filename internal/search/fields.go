@@ -0,0 +1,105 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"strconv"
+	"strings"
+)
+
+type fieldKind int
+
+const (
+	// Matched anywhere in the field, ignoring case
+	kindText fieldKind = iota
+	// Compared as a number
+	kindNumber
+	// One of a fixed set of values
+	kindEnum
+)
+
+type fieldSpec struct {
+	kind    fieldKind
+	example string
+	// normalize checks a value, returning what to search for
+	normalize func(value string) (string, error)
+}
+
+func normalizeText(value string) (string, error) {
+	return value, nil
+}
+
+func normalizeNumber(value string) (string, error) {
+	if _, err := strconv.Atoi(value); err != nil {
+		return "", fmt.Errorf("%q isn't a whole number", value)
+	}
+	return value, nil
+}
+
+func normalizeHour(value string) (string, error) {
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 24 {
+		return "", fmt.Errorf("%q isn't an hour from 0 to 24", value)
+	}
+	return value, nil
+}
+
+// Day names to the day of week, as postgres numbers them
+var days = map[string]string{
+	"wed": "3", "wednesday": "3",
+	"thu": "4", "thur": "4", "thurs": "4", "thursday": "4",
+	"fri": "5", "friday": "5",
+	"sat": "6", "saturday": "6",
+	"sun": "0", "sunday": "0",
+}
+
+func normalizeDay(value string) (string, error) {
+	day, found := days[strings.ToLower(value)]
+	if !found {
+		return "", fmt.Errorf("%q isn't a day of the con", value)
+	}
+	return day, nil
+}
+
+func normalizeCategory(value string) (string, error) {
+	if len(value) < 3 || len(value) > 4 {
+		return "", errors.New("categories are 3 or 4 letter codes")
+	}
+	return strings.ToUpper(value), nil
+}
+
+// Other names people use for the age groups
+var ageAliases = map[string]string{
+	"kid":   "kids",
+	"all":   "everyone",
+	"teens": "teen",
+	"adult": "adults",
+}
+
+func normalizeAge(value string) (string, error) {
+	key := strings.ToLower(value)
+	if alias, found := ageAliases[key]; found {
+		key = alias
+	}
+	age, found := events.FindRequirement(events.AgeGroups, key)
+	if !found {
+		return "", fmt.Errorf("%q isn't an age group, try kids, everyone, teen, mature or adults", value)
+	}
+	return age.Label, nil
+}
+
+var fields = map[string]*fieldSpec{
+	"system":   {kindText, `system:"Dungeons & Dragons"`, normalizeText},
+	"org":      {kindText, "org:catalyst", normalizeText},
+	"gm":       {kindText, "gm:smith", normalizeText},
+	"title":    {kindText, "title:werewolf", normalizeText},
+	"cat":      {kindEnum, "cat:RPG", normalizeCategory},
+	"day":      {kindEnum, "day:fri", normalizeDay},
+	"age":      {kindEnum, "age:teen", normalizeAge},
+	"cost":     {kindNumber, "cost<=4", normalizeNumber},
+	"tickets":  {kindNumber, "tickets>0", normalizeNumber},
+	"start":    {kindNumber, "start>=18", normalizeHour},
+	"end":      {kindNumber, "end<=22", normalizeHour},
+	"duration": {kindNumber, "duration<120", normalizeNumber},
+}
@@ -0,0 +1,359 @@
+// Package search parses what people type into the search box.
+//
+// A query is a list of terms, all of which must match:
+//
+//	query = { term }
+//	term  = [ "-" ] ( field op value | value )
+//	op    = ":" | "=" | "<" | "<=" | ">" | ">="
+//	value = word | '"' phrase '"'
+//
+// Terms without a field are full text searches, as are terms with no value,
+// so "Star Wars: Legion" searches as typed. Terms with a name that isn't a
+// field are searched as text too, with a warning. A leading - excludes whatever the term matches. : and = take a
+// comma separated list of values, any of which can match.
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Op string
+
+const (
+	OpEqual        Op = ":"
+	OpLess         Op = "<"
+	OpLessEqual    Op = "<="
+	OpGreater      Op = ">"
+	OpGreaterEqual Op = ">="
+)
+
+// Longest first, so <= isn't read as <
+var ops = []string{"<=", ">=", ":", "=", "<", ">"}
+
+// Term is a single part of a query.
+type Term struct {
+	// Empty for full text terms
+	Field   string
+	Op      Op
+	Values  []string
+	Negated bool
+	// Whether the value was quoted, for full text terms
+	Phrase bool
+	// The term as typed, for error messages
+	Raw string
+}
+
+// Query is a parsed search, every term of which must match.
+type Query struct {
+	Raw   string
+	Terms []*Term
+	// Terms that were searched, but probably not as meant, like a field that
+	// doesn't exist searched as text
+	Warnings []*Error
+}
+
+// Text is the full text terms, split into those to match and to exclude.
+func (q *Query) Text() (included []string, excluded []string) {
+	for _, term := range q.Terms {
+		if term.Field != "" {
+			continue
+		}
+		if term.Negated {
+			excluded = append(excluded, term.Values[0])
+		} else {
+			included = append(included, term.Values[0])
+		}
+	}
+	return included, excluded
+}
+
+// Filters is the field terms.
+func (q *Query) Filters() []*Term {
+	filters := make([]*Term, 0)
+	for _, term := range q.Terms {
+		if term.Field != "" {
+			filters = append(filters, term)
+		}
+	}
+	return filters
+}
+
+// Words is the single word text terms to match, the ones a spelling
+// correction could be made for.
+func (q *Query) Words() []string {
+	var words []string
+	for _, term := range q.Terms {
+		if term.Field == "" && !term.Negated && !term.Phrase {
+			words = append(words, term.Values[0])
+		}
+	}
+	return words
+}
+
+// Respell is the query as typed with each of Words swapped for its
+// correction, keyed by the lower cased word. It's empty if nothing was
+// corrected.
+func (q *Query) Respell(corrections map[string]string) string {
+	respelled := false
+	terms := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		raw := term.Raw
+		if term.Field == "" && !term.Negated && !term.Phrase {
+			if correction, found := corrections[strings.ToLower(term.Values[0])]; found {
+				raw = correction
+				respelled = true
+			}
+		}
+		terms = append(terms, raw)
+	}
+	if !respelled {
+		return ""
+	}
+	return strings.Join(terms, " ")
+}
+
+// Error is a problem with one term of a query, worded for the person who
+// typed it.
+type Error struct {
+	Term    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %v", e.Term, e.Message)
+}
+
+// lex splits a query into raw terms on whitespace outside of quotes. An
+// unterminated quote runs to the end.
+func lex(raw string) []string {
+	var terms []string
+	var current strings.Builder
+	inQuote := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms
+}
+
+func unquote(value string) (string, bool) {
+	quoted := strings.Contains(value, `"`)
+	return strings.TrimSpace(strings.ReplaceAll(value, `"`, "")), quoted
+}
+
+func isFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitField splits a raw term into field name, op and value, if it looks
+// like it has a field. The name is as typed. Operators inside quotes don't
+// count, so "a:b" is text.
+func splitField(raw string) (string, string, string, bool) {
+	end := strings.IndexAny(raw, `"`)
+	if end < 0 {
+		end = len(raw)
+	}
+	opStart := strings.IndexAny(raw[:end], ":=<>")
+	if opStart < 0 || !isFieldName(raw[:opStart]) {
+		return "", "", "", false
+	}
+	for _, op := range ops {
+		if strings.HasPrefix(raw[opStart:], op) {
+			return raw[:opStart], op, raw[opStart+len(op):], true
+		}
+	}
+	return "", "", "", false
+}
+
+// Parse parses a query, returning an *Error for the first term that doesn't
+// make sense.
+func Parse(raw string) (*Query, error) {
+	query := &Query{Raw: raw}
+	for _, rawTerm := range lex(raw) {
+		term := &Term{Raw: rawTerm}
+		body := rawTerm
+		if strings.HasPrefix(body, "-") {
+			term.Negated = true
+			body = body[1:]
+		}
+
+		name, op, value, found := splitField(body)
+		field := strings.ToLower(name)
+		if found {
+			if unquoted, _ := unquote(value); unquoted == "" {
+				// Titles like "Star Wars: Legion" put a colon after a word
+				body = name
+				found = false
+			} else if _, known := fields[field]; !known {
+				// Anything else with a colon is an error if it's a typo of a
+				// field, otherwise it's searched as text but may not be meant
+				// to be
+				if suggestion := misspelledField(field, op, value); suggestion != "" {
+					return nil, &Error{
+						Term:    rawTerm,
+						Message: fmt.Sprintf("there's no %q field to search, did you mean %v?", field, suggestion),
+					}
+				}
+				query.Warnings = append(query.Warnings, unknownFieldWarning(rawTerm, field))
+				found = false
+			}
+		}
+		if !found {
+			text, quoted := unquote(body)
+			if text == "" {
+				continue
+			}
+			term.Op = OpEqual
+			term.Values = []string{text}
+			term.Phrase = quoted
+			query.Terms = append(query.Terms, term)
+			continue
+		}
+
+		if err := parseFieldTerm(term, field, op, value); err != nil {
+			return nil, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	return query, nil
+}
+
+// parseFieldTerm fills in a term for a known field, with a value.
+func parseFieldTerm(term *Term, field, op, value string) error {
+	spec := fields[field]
+	term.Field = field
+	term.Op = Op(op)
+	if term.Op == "=" {
+		term.Op = OpEqual
+	}
+	if term.Op != OpEqual && spec.kind != kindNumber {
+		return &Error{Term: term.Raw, Message: fmt.Sprintf("%v can only be searched with :", field)}
+	}
+
+	value, _ = unquote(value)
+	values := []string{value}
+	if term.Op == OpEqual {
+		values = nil
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	for i, v := range values {
+		normalized, err := spec.normalize(v)
+		if err != nil {
+			return &Error{Term: term.Raw, Message: fmt.Sprintf("%v, like %v", err.Error(), spec.example)}
+		}
+		values[i] = normalized
+	}
+	term.Values = values
+	return nil
+}
+
+// FieldNames is every field that can be searched, sorted.
+func FieldNames() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unknownFieldWarning explains that a term with a field that doesn't exist
+// was searched as text, listing the fields that do.
+func unknownFieldWarning(rawTerm, field string) *Error {
+	message := fmt.Sprintf("there's no %q field to search.", field)
+	if suggestion := closestField(field); suggestion != "" {
+		message = fmt.Sprintf("there's no %q field to search, did you mean %v?", field, suggestion)
+	}
+	return &Error{
+		Term:    rawTerm,
+		Message: fmt.Sprintf("%v The fields are %v.", message, strings.Join(FieldNames(), ", ")),
+	}
+}
+
+// misspelledField is the field an unknown one was most likely a typo of,
+// if its name is close and the value makes sense for it. Otherwise it's
+// empty, and the term is more likely text that happens to have a colon.
+func misspelledField(field, op, value string) string {
+	suggestion := closestField(field)
+	if suggestion == "" {
+		return ""
+	}
+	term := &Term{Raw: field + op + value}
+	if err := parseFieldTerm(term, suggestion, op, value); err != nil || len(term.Values) == 0 {
+		return ""
+	}
+	return suggestion
+}
+
+// closestField is the field a mistyped one was most likely meant to be, or
+// empty if none are close.
+func closestField(field string) string {
+	best := ""
+	bestDistance := 3
+	for _, name := range FieldNames() {
+		if distance := editDistance(field, name); distance < bestDistance {
+			best = name
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+func minInt(values ...int) int {
+	smallest := values[0]
+	for _, v := range values[1:] {
+		if v < smallest {
+			smallest = v
+		}
+	}
+	return smallest
+}
@@ -0,0 +1,180 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	query, err := Parse(`system:"Dungeons & Dragons" cost<=4 tickets>0 day:fri,sat -cat:tda "ticket to ride" -europe`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []*Term{
+		{Field: "system", Op: OpEqual, Values: []string{"Dungeons & Dragons"}, Raw: `system:"Dungeons & Dragons"`},
+		{Field: "cost", Op: OpLessEqual, Values: []string{"4"}, Raw: "cost<=4"},
+		{Field: "tickets", Op: OpGreater, Values: []string{"0"}, Raw: "tickets>0"},
+		{Field: "day", Op: OpEqual, Values: []string{"5", "6"}, Raw: "day:fri,sat"},
+		{Field: "cat", Op: OpEqual, Values: []string{"TDA"}, Negated: true, Raw: "-cat:tda"},
+		{Op: OpEqual, Values: []string{"ticket to ride"}, Phrase: true, Raw: `"ticket to ride"`},
+		{Op: OpEqual, Values: []string{"europe"}, Negated: true, Raw: "-europe"},
+	}
+	if !reflect.DeepEqual(query.Terms, expected) {
+		for i, term := range query.Terms {
+			t.Logf("%d: %+v", i, term)
+		}
+		t.Fatalf("Unexpected terms")
+	}
+
+	included, excluded := query.Text()
+	if !reflect.DeepEqual(included, []string{"ticket to ride"}) || !reflect.DeepEqual(excluded, []string{"europe"}) {
+		t.Errorf("Unexpected text %v %v", included, excluded)
+	}
+	if len(query.Filters()) != 5 {
+		t.Errorf("Expected 5 filters, got %v", query.Filters())
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		raw     string
+		field   string
+		op      Op
+		values  []string
+		negated bool
+	}{
+		{"org:catalyst", "org", OpEqual, []string{"catalyst"}, false},
+		{"GM:Smith", "gm", OpEqual, []string{"Smith"}, false},
+		{"start>=18", "start", OpGreaterEqual, []string{"18"}, false},
+		{"duration<120", "duration", OpLess, []string{"120"}, false},
+		{"age:teen", "age", OpEqual, []string{"Teen"}, false},
+		{"age:Kid,adults", "age", OpEqual, []string{"Kids Only", "Adults Only"}, false},
+		{"cost=0", "cost", OpEqual, []string{"0"}, false},
+		{"-day:sunday", "day", OpEqual, []string{"0"}, true},
+	}
+	for _, test := range tests {
+		query, err := Parse(test.raw)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error %v", test.raw, err)
+			continue
+		}
+		term := query.Terms[0]
+		if term.Field != test.field || term.Op != test.op || !reflect.DeepEqual(term.Values, test.values) || term.Negated != test.negated {
+			t.Errorf("Parse(%q) = %+v", test.raw, term)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected []string
+	}{
+		{"", nil},
+		{"  catan   seafarers ", []string{"catan", "seafarers"}},
+		// Operators in quotes or after something that isn't a field are text
+		{`"a:b" 10:30`, []string{"a:b", "10:30"}},
+		{`"unterminated phrase`, []string{"unterminated phrase"}},
+		// Titles with a colon after a word
+		{"Star Wars: Legion", []string{"Star", "Wars", "Legion"}},
+		{"Pathfinder Society: Quest", []string{"Pathfinder", "Society", "Quest"}},
+		{`org: "Paizo"`, []string{"org", "Paizo"}},
+		// Unknown fields, and names close to a field whose value doesn't fit it
+		{"https://gencon.com/events", []string{"https://gencon.com/events"}},
+		{"publisher:wotc", []string{"publisher:wotc"}},
+		{"Dark ages:heritage", []string{"Dark", "ages:heritage"}},
+		{`- ""`, nil},
+	}
+	for _, test := range tests {
+		query, err := Parse(test.raw)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error %v", test.raw, err)
+			continue
+		}
+		included, _ := query.Text()
+		if !reflect.DeepEqual(included, test.expected) {
+			t.Errorf("Parse(%q) text = %q, expected %q", test.raw, included, test.expected)
+		}
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	tests := []struct {
+		raw      string
+		terms    []string
+		expected string
+	}{
+		{"catan", nil, ""},
+		{"Star Wars: Legion", nil, ""},
+		{"catan publisher:wizkids", []string{"publisher:wizkids"}, `there's no "publisher" field to search. The fields are age, cat,`},
+		{"sytem:", nil, ""},
+		{"-sytem>2", []string{"-sytem>2"}, `there's no "sytem" field to search, did you mean system? The fields are`},
+		{"https://gencon.com", []string{"https://gencon.com"}, `there's no "https" field`},
+	}
+	for _, test := range tests {
+		query, err := Parse(test.raw)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error %v", test.raw, err)
+			continue
+		}
+		var terms []string
+		for _, warning := range query.Warnings {
+			terms = append(terms, warning.Term)
+			if !strings.Contains(warning.Message, test.expected) {
+				t.Errorf("Parse(%q) warned %q, expected it to contain %q", test.raw, warning.Message, test.expected)
+			}
+		}
+		if !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("Parse(%q) warned about %q, expected %q", test.raw, terms, test.terms)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		raw      string
+		term     string
+		expected string
+	}{
+		{"catan sytem:catan", "sytem:catan", "did you mean system?"},
+		{"duraton<60", "duraton<60", "did you mean duration?"},
+		{"cost<=free", "cost<=free", `"free" isn't a whole number, like cost<=4`},
+		{"system>3", "system>3", "system can only be searched with :"},
+		{"day:monday", "day:monday", `"monday" isn't a day of the con`},
+		{"start>=25", "start>=25", "isn't an hour"},
+		{"age:old", "age:old", "isn't an age group"},
+		{"cat:X", "cat:X", "3 or 4 letter codes"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.raw)
+		var searchErr *Error
+		if !errors.As(err, &searchErr) {
+			t.Errorf("Parse(%q): expected a search error, got %v", test.raw, err)
+			continue
+		}
+		if searchErr.Term != test.term || !strings.Contains(searchErr.Message, test.expected) {
+			t.Errorf("Parse(%q) = %v, expected it about %q containing %q", test.raw, err, test.term, test.expected)
+		}
+	}
+}
+
+func TestRespell(t *testing.T) {
+	query, err := Parse(`Carcassone cost<=4 "villianous game" -Gloomhavn Villianous`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if words := query.Words(); !reflect.DeepEqual(words, []string{"Carcassone", "Villianous"}) {
+		t.Errorf("Unexpected words %q", words)
+	}
+
+	corrections := map[string]string{"carcassone": "carcassonne", "villianous": "villainous", "gloomhavn": "gloomhaven"}
+	expected := `carcassonne cost<=4 "villianous game" -Gloomhavn villainous`
+	if respelled := query.Respell(corrections); respelled != expected {
+		t.Errorf("Respell = %q, expected %q", respelled, expected)
+	}
+	if respelled := query.Respell(map[string]string{}); respelled != "" {
+		t.Errorf("Expected nothing without corrections, got %q", respelled)
+	}
+}
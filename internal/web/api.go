@@ -0,0 +1,443 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"github.com/Encinarus/genconplanner/internal/search"
+	"github.com/gin-gonic/gin"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The API's path prefix. Responses under it only change compatibly, anything
+// else needs a v2.
+const apiPrefix = "/api/v1"
+
+// Search pages hold this many results unless asked for fewer
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+// apiParam is a query or path parameter of an API route.
+type apiParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // "string", "integer" or "boolean"
+	Description string
+	Required    bool
+	// Whether it can be given more than once
+	Repeated bool
+	Enum     []string
+}
+
+// apiRoute is an endpoint of the JSON API. Routes are registered and
+// documented from the same table, so the OpenAPI document can't drift from
+// what's served.
+type apiRoute struct {
+	// Names it for generated clients
+	Name    string
+	Method  string
+	Path    string // in gin's syntax, under apiPrefix
+	Summary string
+	Params  []*apiParam
+	// An example of what it responds with, for its schema
+	Response interface{}
+	// Whether it only works for a signed in user
+	SignedIn bool
+	Handler  func(db *sql.DB) gin.HandlerFunc
+}
+
+var yearParam = &apiParam{Name: "year", In: "query", Type: "integer", Description: "Defaults to this year"}
+
+func searchParams() []*apiParam {
+	return []*apiParam{
+		{Name: "q", In: "query", Type: "string", Description: "The search box, with the same field:value syntax"},
+		yearParam,
+		{Name: "wed", In: "query", Type: "boolean", Description: "Only clusters with wednesday tickets, likewise for the other days"},
+		{Name: "thu", In: "query", Type: "boolean"},
+		{Name: "fri", In: "query", Type: "boolean"},
+		{Name: "sat", In: "query", Type: "boolean"},
+		{Name: "sun", In: "query", Type: "boolean"},
+		{Name: "start_after", In: "query", Type: "integer", Description: "Hour of the day, 0 to 24, Indianapolis time"},
+		{Name: "start_before", In: "query", Type: "integer", Description: "Hour of the day, 0 to 24, Indianapolis time"},
+		{Name: "end_after", In: "query", Type: "integer", Description: "Hour of the day, 0 to 24, Indianapolis time"},
+		{Name: "end_before", In: "query", Type: "integer", Description: "Hour of the day, 0 to 24, Indianapolis time"},
+		{Name: "max_cost", In: "query", Type: "integer", Description: "In dollars, 0 for free events"},
+		{Name: "age", In: "query", Type: "string", Repeated: true, Enum: requirementKeys(events.AgeGroups)},
+		{Name: "experience", In: "query", Type: "string", Repeated: true, Enum: requirementKeys(events.ExperienceLevels)},
+		{Name: "players", In: "query", Type: "integer", Description: "Only events with room for this many players"},
+		{Name: "max_duration", In: "query", Type: "integer", Description: "In minutes"},
+		{Name: "materials", In: "query", Type: "boolean", Description: "Only events with materials provided"},
+		{Name: "tournament", In: "query", Type: "boolean", Description: "Only tournaments when true, no tournaments when false"},
+		{Name: "org_id", In: "query", Type: "integer"},
+		{Name: "sort", In: "query", Type: "string", Description: "Relevance when empty", Enum: postgres.SortOrders},
+		{Name: "limit", In: "query", Type: "integer", Description: fmt.Sprintf("Results per page, %d by default and at most %d", defaultSearchLimit, maxSearchLimit)},
+		{Name: "cursor", In: "query", Type: "string", Description: "next_cursor of the previous page, with the same search. " +
+			"Pages start after the last result of the one before, so results changing in between don't repeat or skip others"},
+	}
+}
+
+func requirementKeys(reqs []events.Requirement) []string {
+	keys := make([]string, len(reqs))
+	for i, req := range reqs {
+		keys[i] = req.Key
+	}
+	return keys
+}
+
+func apiRoutes() []*apiRoute {
+	eventIdParam := &apiParam{Name: "eid", In: "path", Type: "string", Required: true, Description: "Like RPG23ND12345"}
+	return []*apiRoute{
+		{
+			Name:     "getEvent",
+			Method:   http.MethodGet,
+			Path:     "/events/:eid",
+			Summary:  "An event",
+			Params:   []*apiParam{eventIdParam},
+			Response: apiEvent{},
+			Handler:  APIEvent,
+		},
+		{
+			Name:     "getCluster",
+			Method:   http.MethodGet,
+			Path:     "/clusters/:eid",
+			Summary:  "Every run of an event, by the id of any of them",
+			Params:   []*apiParam{eventIdParam},
+			Response: apiCluster{},
+			Handler:  APICluster,
+		},
+		{
+			Name:     "listCategories",
+			Method:   http.MethodGet,
+			Path:     "/categories",
+			Summary:  "How many events each category has",
+			Params:   []*apiParam{yearParam},
+			Response: apiCategories{},
+			Handler:  APICategories,
+		},
+		{
+			Name:     "search",
+			Method:   http.MethodGet,
+			Path:     "/search",
+			Summary:  "Search clusters of events, a page at a time",
+			Params:   searchParams(),
+			Response: apiSearchResults{},
+			Handler:  APISearch,
+		},
+		{
+			Name:     "listOrganizers",
+			Method:   http.MethodGet,
+			Path:     "/organizers",
+			Summary:  "Every organizer",
+			Response: apiOrganizers{},
+			Handler:  APIOrganizers,
+		},
+		{
+			Name:     "listStarred",
+			Method:   http.MethodGet,
+			Path:     "/starred",
+			Summary:  "The signed in user's starred events",
+			Params:   []*apiParam{yearParam},
+			Response: apiStarred{},
+			SignedIn: true,
+			Handler:  APIStarred,
+		},
+	}
+}
+
+// RegisterAPI serves the JSON API, and its OpenAPI document at
+// /openapi.json. Must be installed after BootstrapContext.
+func RegisterAPI(r *gin.Engine, db *sql.DB) {
+	routes := apiRoutes()
+	api := r.Group(apiPrefix)
+	for _, route := range routes {
+		api.Handle(route.Method, route.Path, route.Handler(db))
+	}
+
+	document := buildOpenAPI(routes)
+	api.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
+	})
+}
+
+func apiAbort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, &apiError{Error: message})
+}
+
+func apiInternalError(c *gin.Context, err error) {
+	log.Printf("API error on %v: %v", c.Request.URL.Path, err)
+	c.Error(err)
+	apiAbort(c, http.StatusInternalServerError, "internal error")
+}
+
+// apiYear is the year asked for, this year if none was. Unlike pages, a year
+// that isn't a number is an error rather than ignored.
+func apiYear(c *gin.Context) (int, bool) {
+	raw, found := c.GetQuery("year")
+	if !found || raw == "" {
+		return time.Now().Year(), true
+	}
+	year, err := strconv.Atoi(raw)
+	if err != nil {
+		apiAbort(c, http.StatusBadRequest, "year must be a number")
+		return 0, false
+	}
+	return year, true
+}
+
+// loadAPICluster looks up the events clustered with the event in the url,
+// responding with an error if there are none.
+func loadAPICluster(c *gin.Context, db *sql.DB) (string, []*events.GenconEvent, bool) {
+	eventId, err := events.ParseEventID(c.Param("eid"))
+	if err != nil {
+		apiAbort(c, http.StatusBadRequest, err.Error())
+		return "", nil, false
+	}
+	appContext := c.MustGet("context").(*Context)
+	similar, err := postgres.LoadSimilarEvents(db, eventId.String(), appContext.Email)
+	if err != nil {
+		apiInternalError(c, err)
+		return "", nil, false
+	}
+	if len(similar) == 0 {
+		apiAbort(c, http.StatusNotFound, "no event "+eventId.String())
+		return "", nil, false
+	}
+	return eventId.String(), similar, true
+}
+
+func APIEvent(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eventId, similar, ok := loadAPICluster(c, db)
+		if !ok {
+			return
+		}
+		for _, event := range similar {
+			if event.EventId == eventId {
+				c.JSON(http.StatusOK, newAPIEvent(event))
+				return
+			}
+		}
+		apiAbort(c, http.StatusNotFound, "no event "+eventId)
+	}
+}
+
+func APICluster(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, similar, ok := loadAPICluster(c, db)
+		if !ok {
+			return
+		}
+		first := similar[0]
+		cluster := &apiCluster{
+			Title:        first.Title,
+			Category:     first.ShortCategory,
+			CategoryName: events.LongCategory(first.ShortCategory),
+			GameSystem:   first.GameSystem,
+			Events:       newAPIEvents(similar),
+		}
+		for _, event := range similar {
+			cluster.TicketsAvailable += event.TicketsAvailable
+		}
+		c.JSON(http.StatusOK, cluster)
+	}
+}
+
+func APICategories(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		year, ok := apiYear(c)
+		if !ok {
+			return
+		}
+		summary, err := postgres.LoadCategorySummary(db, year)
+		if err != nil {
+			apiInternalError(c, err)
+			return
+		}
+		categories := make([]*apiCategory, 0, len(summary))
+		for _, category := range summary {
+			categories = append(categories, &apiCategory{
+				Code:   category.Code,
+				Name:   category.Name,
+				Events: category.Count,
+			})
+		}
+		c.JSON(http.StatusOK, &apiCategories{Year: year, Categories: categories})
+	}
+}
+
+// searchKey identifies a search by its parameters, apart from the ones
+// choosing the page, and where in it a page starts.
+func searchKey(params url.Values, after postgres.SortKey) string {
+	key := copyParams(params)
+	key.Del("cursor")
+	key.Del("limit")
+	hash := fnv.New64a()
+	hash.Write([]byte(key.Encode()))
+	for _, value := range after {
+		// Tells nulls from empty strings
+		if value == nil {
+			hash.Write([]byte{0})
+		} else {
+			hash.Write([]byte{1})
+			hash.Write([]byte(*value))
+		}
+	}
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
+
+// pageCursor is what a cursor holds: the sort key of the last result of the
+// page before, and the search it's for.
+type pageCursor struct {
+	After  postgres.SortKey `json:"a"`
+	Search string           `json:"s"`
+}
+
+// encodeCursor is an opaque token for the page of a search after the result
+// with the given sort key.
+func encodeCursor(params url.Values, after postgres.SortKey) string {
+	encoded, _ := json.Marshal(&pageCursor{After: after, Search: searchKey(params, after)})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+var errBadCursor = errors.New("cursor isn't from this search")
+
+// decodeCursor finds where the page a cursor is for starts, checking the
+// cursor came from the same search. An empty cursor is the first page.
+func decodeCursor(params url.Values, cursor string) (postgres.SortKey, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var page pageCursor
+	if err = json.Unmarshal(decoded, &page); err != nil {
+		return nil, errBadCursor
+	}
+	if len(page.After) == 0 || page.Search != searchKey(params, page.After) {
+		return nil, errBadCursor
+	}
+	return page.After, nil
+}
+
+func APISearch(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := c.Request.URL.Query()
+		query, queryErr := parseSearchRequest(c)
+		if queryErr != nil {
+			apiErr := &apiError{Error: queryErr.Error()}
+			if parseErr, ok := queryErr.(*search.Error); ok {
+				apiErr.Error = parseErr.Message
+				apiErr.Term = parseErr.Term
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, apiErr)
+			return
+		}
+
+		limit := defaultSearchLimit
+		if raw := c.Query("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 || parsed > maxSearchLimit {
+				apiAbort(c, http.StatusBadRequest, fmt.Sprintf("limit must be from 1 to %d", maxSearchLimit))
+				return
+			}
+			limit = parsed
+		}
+		after, err := decodeCursor(params, c.Query("cursor"))
+		if err != nil {
+			apiAbort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		// One extra says whether there's another page
+		query.Limit = limit + 1
+		query.After = after
+
+		groups, facets, err := postgres.FindEvents(db, query)
+		if errors.Is(err, postgres.ErrBadSortKey) {
+			apiAbort(c, http.StatusBadRequest, errBadCursor.Error())
+			return
+		} else if err != nil {
+			apiInternalError(c, err)
+			return
+		}
+
+		results := &apiSearchResults{
+			Query:   query.RawQuery,
+			Year:    query.Year,
+			Sort:    query.SortBy,
+			Results: make([]*apiClusterSummary, 0, limit),
+		}
+		if len(groups) > limit {
+			groups = groups[:limit]
+			results.NextCursor = encodeCursor(params, groups[limit-1].SortKey)
+		}
+		for _, group := range groups {
+			results.Results = append(results.Results, newAPIClusterSummary(group))
+		}
+		for _, facet := range facets {
+			values := make([]*apiFacetValue, 0, len(facet.Values))
+			for _, value := range facet.Values {
+				values = append(values, &apiFacetValue{Value: value.Value, Label: value.Label, Count: value.Count})
+			}
+			results.Facets = append(results.Facets, &apiFacet{Name: facet.Name, Label: facet.Label, Values: values})
+		}
+		if len(groups) == 0 && after == nil {
+			if suggestion := didYouMean(db, params, query); suggestion != nil {
+				results.DidYouMean = suggestion.Label
+			}
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+func APIOrganizers(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgs, err := postgres.LoadAllOrgs(db)
+		if err != nil {
+			apiInternalError(c, err)
+			return
+		}
+		organizers := make([]*apiOrganizer, 0, len(orgs))
+		for _, org := range orgs {
+			organizer := &apiOrganizer{Id: org.Id, Aliases: org.Aliases, Events: org.NumEvents}
+			if organizer.Aliases == nil {
+				organizer.Aliases = []string{}
+			}
+			organizers = append(organizers, organizer)
+		}
+		c.JSON(http.StatusOK, &apiOrganizers{Organizers: organizers})
+	}
+}
+
+func APIStarred(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		if appContext.Email == "" {
+			apiAbort(c, http.StatusUnauthorized, "sign in to see starred events")
+			return
+		}
+		year, ok := apiYear(c)
+		if !ok {
+			return
+		}
+		starredEvents, err := postgres.LoadStarredEvents(db, appContext.Email, year)
+		if err != nil {
+			apiInternalError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.JSON(http.StatusOK, &apiStarred{Year: year, Events: newAPIEvents(starredEvents)})
+	}
+}
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"time"
+)
+
+// The API's response types. They're separate from the structs pages render
+// so those can change without breaking scripts and apps, and are what the
+// OpenAPI document describes: fields without omitempty are always present,
+// pointers may be null, and doc tags become field descriptions.
+
+type apiEvent struct {
+	EventId            string    `json:"event_id"`
+	Year               int       `json:"year"`
+	Title              string    `json:"title"`
+	ShortDescription   string    `json:"short_description"`
+	LongDescription    string    `json:"long_description"`
+	Category           string    `json:"category" doc:"Short category code, like BGM"`
+	CategoryName       string    `json:"category_name"`
+	EventType          string    `json:"event_type"`
+	GameSystem         string    `json:"game_system"`
+	RulesEdition       string    `json:"rules_edition"`
+	Group              string    `json:"group" doc:"The organizer as Gen Con lists it"`
+	OrgId              *int64    `json:"org_id" doc:"Null if the organizer isn't known yet"`
+	MinPlayers         int       `json:"min_players"`
+	MaxPlayers         int       `json:"max_players"`
+	AgeRequired        string    `json:"age_required"`
+	ExperienceRequired string    `json:"experience_required"`
+	MaterialsProvided  bool      `json:"materials_provided"`
+	Tournament         bool      `json:"tournament"`
+	RoundNumber        int       `json:"round_number"`
+	TotalRounds        int       `json:"total_rounds"`
+	StartTime          time.Time `json:"start_time"`
+	EndTime            time.Time `json:"end_time"`
+	Duration           int       `json:"duration_minutes"`
+	Cost               int       `json:"cost" doc:"In dollars"`
+	Location           string    `json:"location"`
+	RoomName           string    `json:"room_name"`
+	TableNumber        string    `json:"table_number"`
+	GMNames            string    `json:"gm_names"`
+	Website            string    `json:"website"`
+	Email              string    `json:"email"`
+	TicketsAvailable   int       `json:"tickets_available"`
+	LastModified       time.Time `json:"last_modified"`
+	Starred            bool      `json:"starred" doc:"Whether the signed in user starred it, always false when signed out"`
+	Url                string    `json:"url"`
+	GenconUrl          string    `json:"gencon_url"`
+}
+
+func newAPIEvent(e *events.GenconEvent) *apiEvent {
+	event := &apiEvent{
+		EventId:            e.EventId,
+		Year:               e.Year,
+		Title:              e.Title,
+		ShortDescription:   e.ShortDescription,
+		LongDescription:    e.LongDescription,
+		Category:           e.ShortCategory,
+		CategoryName:       events.LongCategory(e.ShortCategory),
+		EventType:          e.EventType,
+		GameSystem:         e.GameSystem,
+		RulesEdition:       e.RulesEdition,
+		Group:              e.Group,
+		MinPlayers:         e.MinPlayers,
+		MaxPlayers:         e.MaxPlayers,
+		AgeRequired:        e.AgeRequired,
+		ExperienceRequired: e.ExperienceRequired,
+		MaterialsProvided:  e.MaterialsProvided,
+		Tournament:         e.Tournament,
+		RoundNumber:        e.RoundNumber,
+		TotalRounds:        e.TotalRounds,
+		StartTime:          e.StartTime,
+		EndTime:            e.EndTime,
+		Duration:           e.Duration,
+		Cost:               e.Cost,
+		Location:           e.Location,
+		RoomName:           e.RoomName,
+		TableNumber:        e.TableNumber,
+		GMNames:            e.GMNames,
+		Website:            e.Website,
+		Email:              e.Email,
+		TicketsAvailable:   e.TicketsAvailable,
+		LastModified:       e.LastModified,
+		Starred:            e.IsStarred,
+		Url:                e.PlannerLink(),
+		GenconUrl:          e.GenconLink(),
+	}
+	if e.OrgId != 0 {
+		orgId := e.OrgId
+		event.OrgId = &orgId
+	}
+	return event
+}
+
+func newAPIEvents(loaded []*events.GenconEvent) []*apiEvent {
+	converted := make([]*apiEvent, 0, len(loaded))
+	for _, e := range loaded {
+		converted = append(converted, newAPIEvent(e))
+	}
+	return converted
+}
+
+// apiCluster is every run of an event, the same title and description at
+// different times.
+type apiCluster struct {
+	Title            string      `json:"title"`
+	Category         string      `json:"category"`
+	CategoryName     string      `json:"category_name"`
+	GameSystem       string      `json:"game_system"`
+	TicketsAvailable int         `json:"tickets_available" doc:"Across every event in the cluster"`
+	Events           []*apiEvent `json:"events" doc:"In order of start time"`
+}
+
+type apiDayTickets struct {
+	Wed int `json:"wed"`
+	Thu int `json:"thu"`
+	Fri int `json:"fri"`
+	Sat int `json:"sat"`
+	Sun int `json:"sun"`
+}
+
+// apiClusterSummary is a search result, a cluster without its events.
+type apiClusterSummary struct {
+	EventId          string        `json:"event_id" doc:"The cluster's first event, also the cluster's id"`
+	Title            string        `json:"title"`
+	Description      string        `json:"description"`
+	Category         string        `json:"category"`
+	CategoryName     string        `json:"category_name"`
+	GameSystem       string        `json:"game_system"`
+	Events           int           `json:"events"`
+	TicketsAvailable int           `json:"tickets_available"`
+	TicketsByDay     apiDayTickets `json:"tickets_by_day"`
+	SellOutHours     *float64      `json:"sell_out_hours" doc:"Projected hours until it sells out, null if it isn't selling"`
+	Url              string        `json:"url"`
+}
+
+func newAPIClusterSummary(g *postgres.EventGroup) *apiClusterSummary {
+	return &apiClusterSummary{
+		EventId:          g.EventId,
+		Title:            g.Name,
+		Description:      g.Description,
+		Category:         g.ShortCategory,
+		CategoryName:     events.LongCategory(g.ShortCategory),
+		GameSystem:       g.GameSystem,
+		Events:           g.Count,
+		TicketsAvailable: g.TotalTickets,
+		TicketsByDay: apiDayTickets{
+			Wed: g.WedTickets,
+			Thu: g.ThursTickets,
+			Fri: g.FriTickets,
+			Sat: g.SatTickets,
+			Sun: g.SunTickets,
+		},
+		SellOutHours: g.SellOutHours,
+		Url:          "/event/" + g.EventId,
+	}
+}
+
+type apiFacetValue struct {
+	Value string `json:"value" doc:"What to search for to narrow to it, see the search parameters"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+type apiFacet struct {
+	Name   string           `json:"name"`
+	Label  string           `json:"label"`
+	Values []*apiFacetValue `json:"values"`
+}
+
+type apiSearchResults struct {
+	Query      string               `json:"query"`
+	Year       int                  `json:"year"`
+	Sort       string               `json:"sort"`
+	Results    []*apiClusterSummary `json:"results"`
+	NextCursor string               `json:"next_cursor,omitempty" doc:"Pass as cursor for the next page, missing on the last page"`
+	Facets     []*apiFacet          `json:"facets,omitempty" doc:"How the matching events break down, only on the first page"`
+	DidYouMean string               `json:"did_you_mean,omitempty" doc:"The query with misspellings corrected, when nothing matched"`
+}
+
+type apiCategory struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Events int    `json:"events"`
+}
+
+type apiCategories struct {
+	Year       int            `json:"year"`
+	Categories []*apiCategory `json:"categories"`
+}
+
+type apiOrganizer struct {
+	Id      int64    `json:"id"`
+	Aliases []string `json:"aliases" doc:"Every name its events list it under"`
+	Events  int64    `json:"events"`
+}
+
+type apiOrganizers struct {
+	Organizers []*apiOrganizer `json:"organizers"`
+}
+
+type apiStarred struct {
+	Year   int         `json:"year"`
+	Events []*apiEvent `json:"events" doc:"Starred events, and every event of clusters starred whole"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+	// Only for searches that don't parse
+	Term string `json:"term,omitempty" doc:"The part of the query that couldn't be parsed"`
+}
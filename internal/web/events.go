@@ -11,9 +11,10 @@ import (
 )
 
 type LookupResult struct {
-	MainEvent    *events.GenconEvent
-	EventsPerDay map[string][]*events.GenconEvent
-	TotalTickets int
+	MainEvent     *events.GenconEvent
+	EventsPerDay  map[string][]*events.GenconEvent
+	TotalTickets  int
+	TicketHistory []*postgres.TicketObservation
 }
 
 func lookupEvent(db *sql.DB, eventId string, userEmail string) (*LookupResult, error) {
@@ -34,6 +35,14 @@ func lookupEvent(db *sql.DB, eventId string, userEmail string) (*LookupResult, e
 		result.TotalTickets += event.TicketsAvailable
 	}
 
+	if result.MainEvent != nil {
+		result.TicketHistory, err = postgres.LoadTicketHistory(db, eventId)
+		if err != nil {
+			// The page is still useful without the chart
+			log.Printf("Unable to load ticket history for %v: %v", eventId, err)
+		}
+	}
+
 	return &result, nil
 }
 
@@ -66,15 +75,24 @@ func renderJson(c *gin.Context, result *LookupResult, appContext *Context) {
 
 func ViewEvent(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		eventId := c.Param("eid")
+		eventId, err := events.ParseEventID(c.Param("eid"))
+		if err != nil {
+			log.Printf("Bad event id: %v", err)
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
 
 		appContext := c.MustGet("context").(*Context)
-		result, err := lookupEvent(db, eventId, appContext.Email)
+		result, err := lookupEvent(db, eventId.String(), appContext.Email)
 		if err != nil {
 			log.Printf("Unable to lookup event %v\n", err)
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
+		if result.MainEvent == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
 		appContext.Year = result.MainEvent.Year
 
 		_, json := c.GetQuery("json")
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Encinarus/genconplanner/internal/background"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How many runs the dashboard and the json list show.
+const recentJobRuns = 50
+
+// How many aborted imports the dashboard shows.
+const recentAbortedImports = 10
+
+// Jobs that haven't run on a schedule are called stuck after this long.
+const defaultStuckAfter = 24 * time.Hour
+
+// jobStatus is a registered job along with its most recent run, if any.
+type jobStatus struct {
+	*background.Job
+	LastRun *postgres.JobRun
+}
+
+// Stuck is a guess, a run going for twice as long as the time between runs
+// probably isn't making progress.
+func (s *jobStatus) Stuck() bool {
+	if s.LastRun == nil || s.LastRun.FinishedAt != nil {
+		return false
+	}
+	stuckAfter := defaultStuckAfter
+	if s.Interval > 0 {
+		stuckAfter = 2 * s.Interval
+	}
+	return s.LastRun.Duration() > stuckAfter
+}
+
+func renderJobs(c *gin.Context, db *sql.DB, scheduler *background.Scheduler, status int, jobErr error) {
+	appContext := c.MustGet("context").(*Context)
+	appContext.Year = time.Now().Year()
+
+	jobs := make([]*jobStatus, 0)
+	for _, job := range scheduler.Jobs() {
+		lastRuns, err := postgres.LoadJobRuns(db, job.Name, 1)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		current := &jobStatus{Job: job}
+		if len(lastRuns) > 0 {
+			current.LastRun = lastRuns[0]
+		}
+		jobs = append(jobs, current)
+	}
+	runs, err := postgres.LoadJobRuns(db, "", recentJobRuns)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	abortedImports, err := postgres.LoadAbortedImports(db, recentAbortedImports)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.HTML(status, "jobs.html", gin.H{
+		"context":        appContext,
+		"jobs":           jobs,
+		"runs":           runs,
+		"abortedImports": abortedImports,
+		"jobError":       jobErr,
+	})
+}
+
+// ViewJobs shows the background jobs, how their last runs went and buttons
+// to run them again.
+func ViewJobs(db *sql.DB, scheduler *background.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		renderJobs(c, db, scheduler, http.StatusOK, nil)
+	}
+}
+
+type jobRunJson struct {
+	*postgres.JobRun
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// ListJobRuns is the recent job runs as json, optionally for a single job.
+func ListJobRuns(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runs, err := postgres.LoadJobRuns(db, c.Query("job"), recentJobRuns)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		runsJson := make([]*jobRunJson, len(runs))
+		for i, run := range runs {
+			runsJson[i] = &jobRunJson{JobRun: run, DurationSeconds: run.Duration().Seconds()}
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.JSON(http.StatusOK, runsJson)
+	}
+}
+
+// TriggerJob runs a background job now, rather than waiting for its next
+// scheduled run.
+func TriggerJob(db *sql.DB, scheduler *background.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		name := c.PostForm("job")
+		err := scheduler.Trigger(name)
+		if errors.Is(err, background.ErrUnknownJob) {
+			renderJobs(c, db, scheduler, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		log.Printf("%v triggered job %v", appContext.Email, name)
+		c.Redirect(http.StatusSeeOther, "/admin/jobs")
+	}
+}
+
+// RunImport imports events from a url or an uploaded xlsx or csv file, in
+// place of the scheduled import. Forcing it skips the deactivation limits,
+// for when Gen Con really did drop that many events.
+func RunImport(db *sql.DB, scheduler *background.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+
+		source, cleanup, err := importSource(c)
+		if err != nil {
+			renderJobs(c, db, scheduler, http.StatusBadRequest, err)
+			return
+		}
+		force := c.PostForm("force") != ""
+		job := background.NewGenconImportJob(db, source, 0, background.ImportLimits(force))
+		importEvents := job.Run
+		job.Run = func(ctx context.Context) (background.JobCounts, error) {
+			defer cleanup()
+			return importEvents(ctx)
+		}
+
+		if err = scheduler.RunOnce(job); err != nil {
+			cleanup()
+			renderJobs(c, db, scheduler, http.StatusConflict, err)
+			return
+		}
+		log.Printf("%v started an import from %v, forced: %v", appContext.Email, source, force)
+		c.Redirect(http.StatusSeeOther, "/admin/jobs")
+	}
+}
+
+// importSource is the url or, for uploads, the temp file to import from,
+// along with a func to clean up once it's imported.
+func importSource(c *gin.Context) (string, func(), error) {
+	noCleanup := func() {}
+
+	upload, err := c.FormFile("file")
+	if err == http.ErrMissingFile {
+		sourceUrl := strings.TrimSpace(c.PostForm("url"))
+		parsed, err := url.Parse(sourceUrl)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "", noCleanup, fmt.Errorf("%q isn't an http or https url", sourceUrl)
+		}
+		return sourceUrl, noCleanup, nil
+	}
+	if err != nil {
+		return "", noCleanup, err
+	}
+
+	// The importer picks a parser by extension
+	ext := strings.ToLower(filepath.Ext(upload.Filename))
+	if ext != ".xlsx" && ext != ".csv" {
+		return "", noCleanup, fmt.Errorf("%v isn't an xlsx or csv file", upload.Filename)
+	}
+	tempFile, err := os.CreateTemp("", "events-*"+ext)
+	if err != nil {
+		return "", noCleanup, err
+	}
+	tempFile.Close()
+	cleanup := func() {
+		if err := os.Remove(tempFile.Name()); err != nil {
+			log.Printf("Unable to remove %v: %v", tempFile.Name(), err)
+		}
+	}
+	if err = c.SaveUploadedFile(upload, tempFile.Name()); err != nil {
+		cleanup()
+		return "", noCleanup, err
+	}
+	return tempFile.Name(), cleanup, nil
+}
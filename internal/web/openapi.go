@@ -0,0 +1,223 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The OpenAPI document is built from the route table and the response types,
+// so it describes exactly what RegisterAPI serves.
+
+type openAPIObject = map[string]interface{}
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// openAPIPath converts a gin path to an OpenAPI one, :eid to {eid}.
+func openAPIPath(path string) string {
+	return apiPrefix + ginParam.ReplaceAllString(path, "{$1}")
+}
+
+// schemaName is what a response type is called in the document, apiEvent
+// as Event.
+func schemaName(t reflect.Type) string {
+	return strings.TrimPrefix(t.Name(), "api")
+}
+
+func schemaRef(name string) openAPIObject {
+	return openAPIObject{"$ref": "#/components/schemas/" + name}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder collects the schemas of the response types as they're
+// referenced.
+type schemaBuilder struct {
+	schemas openAPIObject
+}
+
+func (s *schemaBuilder) schemaOf(t reflect.Type) openAPIObject {
+	switch t.Kind() {
+	case reflect.Ptr:
+		// Pointers to structs only appear in slices, and are never null
+		if t.Elem().Kind() == reflect.Struct && t.Elem() != timeType {
+			return s.schemaOf(t.Elem())
+		}
+		schema := s.schemaOf(t.Elem())
+		schema["nullable"] = true
+		return schema
+	case reflect.Struct:
+		if t == timeType {
+			return openAPIObject{"type": "string", "format": "date-time"}
+		}
+		name := schemaName(t)
+		if _, found := s.schemas[name]; !found {
+			// Reserved first, in case the type refers to itself
+			s.schemas[name] = nil
+			s.schemas[name] = s.structSchema(t)
+		}
+		return schemaRef(name)
+	case reflect.Slice:
+		return openAPIObject{"type": "array", "items": s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return openAPIObject{"type": "object", "additionalProperties": s.schemaOf(t.Elem())}
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return openAPIObject{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return openAPIObject{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return openAPIObject{"type": "number"}
+	}
+	panic(fmt.Sprintf("no schema for %v", t))
+}
+
+// structSchema describes a struct as encoding/json writes it. Fields without
+// omitempty are always written, so they're required.
+func (s *schemaBuilder) structSchema(t reflect.Type) openAPIObject {
+	properties := openAPIObject{}
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := false
+		for _, option := range parts[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+
+		schema := s.schemaOf(field.Type)
+		if doc := field.Tag.Get("doc"); doc != "" {
+			if _, isRef := schema["$ref"]; isRef {
+				// Nothing can sit beside a $ref in OpenAPI 3.0
+				schema = openAPIObject{"allOf": []interface{}{schema}}
+			}
+			schema["description"] = doc
+		}
+		properties[name] = schema
+		if !omitEmpty {
+			required = append(required, name)
+		}
+	}
+	return openAPIObject{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func paramSchema(param *apiParam) openAPIObject {
+	schema := openAPIObject{"type": param.Type}
+	if len(param.Enum) > 0 {
+		enum := make([]interface{}, len(param.Enum))
+		for i, value := range param.Enum {
+			enum[i] = value
+		}
+		schema["enum"] = enum
+	}
+	if param.Repeated {
+		return openAPIObject{"type": "array", "items": schema}
+	}
+	return schema
+}
+
+func errorResponse(description string) openAPIObject {
+	return openAPIObject{
+		"description": description,
+		"content": openAPIObject{
+			"application/json": openAPIObject{"schema": schemaRef("Error")},
+		},
+	}
+}
+
+// buildOpenAPI documents the routes as an OpenAPI 3.0 document.
+func buildOpenAPI(routes []*apiRoute) openAPIObject {
+	builder := &schemaBuilder{schemas: openAPIObject{}}
+	builder.schemaOf(reflect.TypeOf(apiError{}))
+
+	paths := openAPIObject{}
+	for _, route := range routes {
+		parameters := make([]interface{}, 0, len(route.Params))
+		for _, param := range route.Params {
+			parameter := openAPIObject{
+				"name":     param.Name,
+				"in":       param.In,
+				"required": param.Required,
+				"schema":   paramSchema(param),
+			}
+			if param.Description != "" {
+				parameter["description"] = param.Description
+			}
+			if param.Repeated {
+				parameter["style"] = "form"
+				parameter["explode"] = true
+			}
+			parameters = append(parameters, parameter)
+		}
+
+		responses := openAPIObject{
+			"200": openAPIObject{
+				"description": "OK",
+				"content": openAPIObject{
+					"application/json": openAPIObject{"schema": builder.schemaOf(reflect.TypeOf(route.Response))},
+				},
+			},
+			"400":     errorResponse("A parameter doesn't make sense"),
+			"default": errorResponse("Something went wrong"),
+		}
+		if strings.Contains(route.Path, ":") {
+			responses["404"] = errorResponse("Not found")
+		}
+		operation := openAPIObject{
+			"operationId": route.Name,
+			"summary":     route.Summary,
+			"parameters":  parameters,
+			"responses":   responses,
+		}
+		if route.SignedIn {
+			responses["401"] = errorResponse("Not signed in")
+			operation["security"] = []interface{}{
+				openAPIObject{"bearer": []interface{}{}},
+				openAPIObject{"cookie": []interface{}{}},
+			}
+		}
+
+		path := openAPIPath(route.Path)
+		operations, found := paths[path].(openAPIObject)
+		if !found {
+			operations = openAPIObject{}
+			paths[path] = operations
+		}
+		operations[strings.ToLower(route.Method)] = operation
+	}
+
+	return openAPIObject{
+		"openapi": "3.0.3",
+		"info": openAPIObject{
+			"title":   "Gen Con Planner API",
+			"version": strings.TrimPrefix(apiPrefix, "/api/"),
+			"description": "Events, clusters of the same event at different times, and searches of them. " +
+				"Starred events need a Firebase ID token, as a bearer token or the signinToken cookie.",
+		},
+		"paths": paths,
+		"components": openAPIObject{
+			"schemas": builder.schemas,
+			"securitySchemes": openAPIObject{
+				"bearer": openAPIObject{"type": "http", "scheme": "bearer"},
+				"cookie": openAPIObject{"type": "apiKey", "in": "cookie", "name": "signinToken"},
+			},
+		},
+	}
+}
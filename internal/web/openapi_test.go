@@ -0,0 +1,248 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testAPI serves the API with nobody signed in and no database, so only
+// what's answered before a query works.
+func testAPI() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("context", &Context{})
+	})
+	RegisterAPI(r, nil)
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+// servedDocument is the OpenAPI document as clients see it.
+func servedDocument(t *testing.T, r *gin.Engine) map[string]interface{} {
+	t.Helper()
+	response := get(r, apiPrefix+"/openapi.json")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected the document, got %v: %v", response.Code, response.Body)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &document); err != nil {
+		t.Fatalf("Document isn't json: %v", err)
+	}
+	return document
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	r := testAPI()
+	document := servedDocument(t, r)
+	if document["openapi"] != "3.0.3" {
+		t.Errorf("Unexpected version %v", document["openapi"])
+	}
+	paths := document["paths"].(map[string]interface{})
+
+	documented := 0
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, apiPrefix) || route.Path == apiPrefix+"/openapi.json" {
+			continue
+		}
+		operations, found := paths[openAPIPath(strings.TrimPrefix(route.Path, apiPrefix))].(map[string]interface{})
+		if !found || operations[strings.ToLower(route.Method)] == nil {
+			t.Errorf("%v %v isn't documented", route.Method, route.Path)
+			continue
+		}
+		documented++
+	}
+	operations := 0
+	for _, methods := range paths {
+		operations += len(methods.(map[string]interface{}))
+	}
+	if documented != operations {
+		t.Errorf("Documented %d operations, but only %d are served", operations, documented)
+	}
+}
+
+func TestOpenAPIPathParams(t *testing.T) {
+	names := make(map[string]bool)
+	for _, route := range apiRoutes() {
+		if names[route.Name] {
+			t.Errorf("Two routes are named %v", route.Name)
+		}
+		names[route.Name] = true
+
+		inPath := make(map[string]bool)
+		for _, match := range ginParam.FindAllStringSubmatch(route.Path, -1) {
+			inPath[match[1]] = true
+		}
+		declared := 0
+		for _, param := range route.Params {
+			if param.In != "path" {
+				continue
+			}
+			declared++
+			if !inPath[param.Name] || !param.Required {
+				t.Errorf("%v declares path param %v, which isn't a required part of the path", route.Path, param.Name)
+			}
+		}
+		if declared != len(inPath) {
+			t.Errorf("%v has %d path params, but declares %d", route.Path, len(inPath), declared)
+		}
+	}
+}
+
+var schemaRefPattern = regexp.MustCompile(`^#/components/schemas/(\w+)$`)
+
+// collectRefs finds every $ref in a decoded json document.
+func collectRefs(node interface{}, refs map[string]bool) {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if ref, isString := child.(string); key == "$ref" && isString {
+				refs[ref] = true
+			}
+			collectRefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range value {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	document := servedDocument(t, testAPI())
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	refs := make(map[string]bool)
+	collectRefs(document, refs)
+	if len(refs) == 0 {
+		t.Fatalf("Expected responses to refer to schemas")
+	}
+	for ref := range refs {
+		match := schemaRefPattern.FindStringSubmatch(ref)
+		if match == nil {
+			t.Errorf("Unexpected ref %v", ref)
+		} else if schemas[match[1]] == nil {
+			t.Errorf("Nothing to resolve %v to", ref)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	document := servedDocument(t, testAPI())
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	property := func(schema, name string) (map[string]interface{}, bool) {
+		t.Helper()
+		object := schemas[schema].(map[string]interface{})
+		properties := object["properties"].(map[string]interface{})
+		required := false
+		for _, field := range object["required"].([]interface{}) {
+			required = required || field == name
+		}
+		found, _ := properties[name].(map[string]interface{})
+		if found == nil {
+			t.Fatalf("No %v in %v", name, schema)
+		}
+		return found, required
+	}
+
+	if orgId, required := property("Event", "org_id"); !required || orgId["nullable"] != true || orgId["format"] != "int64" {
+		t.Errorf("Expected a required, nullable org_id, got %v", orgId)
+	}
+	if startTime, _ := property("Event", "start_time"); startTime["format"] != "date-time" {
+		t.Errorf("Expected start_time as a date-time, got %v", startTime)
+	}
+	if cursor, required := property("SearchResults", "next_cursor"); required || cursor["type"] != "string" {
+		t.Errorf("Expected an optional next_cursor, got %v", cursor)
+	}
+	if results, _ := property("SearchResults", "results"); results["items"].(map[string]interface{})["$ref"] != "#/components/schemas/ClusterSummary" {
+		t.Errorf("Expected results of cluster summaries, got %v", results)
+	}
+	if byDay, _ := property("ClusterSummary", "tickets_by_day"); byDay["$ref"] != "#/components/schemas/DayTickets" {
+		t.Errorf("Expected tickets by day to refer to its schema, got %v", byDay)
+	}
+	// Descriptions sit beside the rest of the schema
+	if sellOut, _ := property("ClusterSummary", "sell_out_hours"); sellOut["description"] == nil || sellOut["nullable"] != true {
+		t.Errorf("Expected documented, nullable sell out hours, got %v", sellOut)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	r := testAPI()
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/starred", http.StatusUnauthorized},
+		{"/events/not-an-event", http.StatusBadRequest},
+		{"/clusters/not-an-event", http.StatusBadRequest},
+		{"/categories?year=next", http.StatusBadRequest},
+		{"/search?q=cost<=cheap", http.StatusBadRequest},
+		{"/search?limit=0", http.StatusBadRequest},
+		{"/search?limit=100000", http.StatusBadRequest},
+		{"/search?cursor=nonsense", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		response := get(r, apiPrefix+test.path)
+		if response.Code != test.status {
+			t.Errorf("Expected %v from %v, got %v: %v", test.status, test.path, response.Code, response.Body)
+			continue
+		}
+		var apiErr apiError
+		if err := json.Unmarshal(response.Body.Bytes(), &apiErr); err != nil || apiErr.Error == "" {
+			t.Errorf("Expected an error from %v, got %v", test.path, response.Body)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	params := url.Values{"q": {"catan"}, "sat": {"t"}, "limit": {"10"}}
+	rank, eventId := "0.6", "BGM23ND00001"
+	after := postgres.SortKey{&rank, nil, &eventId}
+	cursor := encodeCursor(params, after)
+
+	// The page size can change between pages
+	params.Set("limit", "20")
+	params.Set("cursor", cursor)
+	if decoded, err := decodeCursor(params, cursor); err != nil || !reflect.DeepEqual(decoded, after) {
+		t.Errorf("Expected %v, got %v %v", after, decoded, err)
+	}
+	if decoded, err := decodeCursor(params, ""); err != nil || decoded != nil {
+		t.Errorf("Expected the first page without a cursor, got %v %v", decoded, err)
+	}
+
+	// A cursor edited to start elsewhere
+	edited := "0.9"
+	tampered, _ := json.Marshal(&pageCursor{After: postgres.SortKey{&edited, nil, &eventId}, Search: searchKey(params, after)})
+	empty, _ := json.Marshal(&pageCursor{Search: searchKey(params, nil)})
+	for _, bad := range []string{
+		"!!",
+		cursor[2:],
+		"LTEuMA",
+		base64.RawURLEncoding.EncodeToString(tampered),
+		base64.RawURLEncoding.EncodeToString(empty),
+	} {
+		if _, err := decodeCursor(params, bad); err != errBadCursor {
+			t.Errorf("Expected cursor %q to be rejected, got %v", bad, err)
+		}
+	}
+
+	params.Set("q", "ticket to ride")
+	if _, err := decodeCursor(params, cursor); err != errBadCursor {
+		t.Errorf("Expected a cursor from another search to be rejected, got %v", err)
+	}
+}
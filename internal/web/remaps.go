@@ -0,0 +1,127 @@
+package web
+
+import (
+	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/events"
+	"github.com/Encinarus/genconplanner/internal/postgres"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remapMatch is an existing title/system/edition combination that a rule
+// under test would change.
+type remapMatch struct {
+	*postgres.SystemUsage
+	NewGameSystem   string
+	NewRulesEdition string
+}
+
+func remapRuleFromForm(get func(string) string) *events.RemapRule {
+	return &events.RemapRule{
+		GameSystem:      strings.TrimSpace(get("game_system")),
+		RulesEdition:    strings.TrimSpace(get("rules_edition")),
+		Title:           strings.TrimSpace(get("title")),
+		TitleContains:   strings.TrimSpace(get("title_contains")),
+		NewGameSystem:   strings.TrimSpace(get("new_game_system")),
+		NewRulesEdition: strings.TrimSpace(get("new_rules_edition")),
+		Note:            strings.TrimSpace(get("note")),
+	}
+}
+
+func renderRemaps(c *gin.Context, db *sql.DB, status int, rule *events.RemapRule, matches []*remapMatch, ruleErr error) {
+	appContext := c.MustGet("context").(*Context)
+	appContext.Year = time.Now().Year()
+
+	dbRules, err := postgres.LoadRemapRules(db)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.HTML(status, "remaps.html", gin.H{
+		"context":      appContext,
+		"defaultRules": events.DefaultRemapRules(),
+		"dbRules":      dbRules,
+		"rule":         rule,
+		"matches":      matches,
+		"tested":       matches != nil,
+		"ruleError":    ruleErr,
+	})
+}
+
+// ViewRemaps lists the remap rules. If test=1 is passed along with a rule's
+// fields, also shows which of this year's events the rule would change.
+func ViewRemaps(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := remapRuleFromForm(c.Query)
+		if c.Query("test") == "" {
+			renderRemaps(c, db, http.StatusOK, rule, nil, nil)
+			return
+		}
+
+		if err := rule.Validate(); err != nil {
+			renderRemaps(c, db, http.StatusBadRequest, rule, nil, err)
+			return
+		}
+
+		usages, err := postgres.LoadSystemUsage(db, time.Now().Year())
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		matches := make([]*remapMatch, 0)
+		for _, usage := range usages {
+			event := &events.GenconEvent{
+				Title:        usage.Title,
+				GameSystem:   usage.GameSystem,
+				RulesEdition: usage.RulesEdition,
+			}
+			if !rule.Matches(event) {
+				continue
+			}
+			remapped := events.RemapRules{*rule}.Apply(event)
+			matches = append(matches, &remapMatch{
+				SystemUsage:     usage,
+				NewGameSystem:   remapped.GameSystem,
+				NewRulesEdition: remapped.RulesEdition,
+			})
+		}
+		renderRemaps(c, db, http.StatusOK, rule, matches, nil)
+	}
+}
+
+func AddRemap(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		rule := remapRuleFromForm(c.PostForm)
+
+		if err := postgres.AddRemapRule(db, rule, appContext.Email); err != nil {
+			log.Printf("Unable to add remap rule %+v: %v", rule, err)
+			renderRemaps(c, db, http.StatusBadRequest, rule, nil, err)
+			return
+		}
+		log.Printf("%v added remap rule %v", appContext.Email, rule.Id)
+		c.Redirect(http.StatusSeeOther, "/admin/remaps")
+	}
+}
+
+func DeleteRemap(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		id, err := strconv.ParseInt(c.PostForm("id"), 10, 64)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		if err = postgres.DeleteRemapRule(db, id); err != nil {
+			c.Error(err)
+			return
+		}
+		log.Printf("%v deleted remap rule %v", appContext.Email, id)
+		c.Redirect(http.StatusSeeOther, "/admin/remaps")
+	}
+}
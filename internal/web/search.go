@@ -1,20 +1,24 @@
 package web
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/csv"
+	"fmt"
 	"github.com/Encinarus/genconplanner/internal/events"
 	"github.com/Encinarus/genconplanner/internal/postgres"
+	"github.com/Encinarus/genconplanner/internal/search"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func parseQuery(searchQuery string, year int, days map[string]bool) *postgres.ParsedQuery {
+// parseQuery parses the search box along with the year and days, returning
+// a *search.Error if the search doesn't make sense. The query is returned
+// either way, for the form.
+func parseQuery(searchQuery string, year int, days map[string]bool) (*postgres.ParsedQuery, error) {
 	query := postgres.ParsedQuery{
 		Year:       year,
 		DaysOfWeek: days,
@@ -28,50 +32,13 @@ func parseQuery(searchQuery string, year int, days map[string]bool) *postgres.Pa
 
 	log.Printf("Search query: %v", query)
 
-	// Preprocess, removing symbols which are used in tsquery
-	searchQuery = strings.Replace(searchQuery, "!", "", -1)
-	searchQuery = strings.Replace(searchQuery, "&", "", -1)
-	searchQuery = strings.Replace(searchQuery, "(", "", -1)
-	searchQuery = strings.Replace(searchQuery, ")", "", -1)
-	searchQuery = strings.Replace(searchQuery, "|", "", -1)
-
-	queryReader := csv.NewReader(bytes.NewBufferString(searchQuery))
-	queryReader.Comma = ' '
-
-	splitQuery, _ := queryReader.Read()
-
-	for _, term := range splitQuery {
-		invertTerm := false
-		if strings.HasPrefix(term, "-") {
-			term = strings.TrimLeft(term, "-")
-			invertTerm = true
-		}
-		if strings.ContainsAny(term, ":<>=-~") {
-			// TODO(alek) Handle key:value searches
-			// : and = work as equals
-			// < > compare for dates or num tickets
-			// ~ is for checking if the string is in a field
-			continue
-		}
-
-		// Now remove remaining symbols we want to allow in field-specific
-		// searches, but not in the general text search
-		term = strings.Replace(term, "<", "", -1)
-		term = strings.Replace(term, ">", "", -1)
-		term = strings.Replace(term, "=", "", -1)
-		term = strings.Replace(term, "-", "", -1)
-		term = strings.Replace(term, "~", "", -1)
-		term = strings.TrimSpace(term)
-		if len(term) == 0 {
-			continue
-		}
-		if invertTerm {
-			term = "!" + term
-		}
-		query.TextQueries = append(query.TextQueries, term)
+	parsed, err := search.Parse(searchQuery)
+	if err != nil {
+		return &query, err
 	}
-	query.DaysOfWeek = days
-	return &query
+	query.TextQueries, query.ExcludedText = parsed.Text()
+	query.Filters = parsed.Filters()
+	return &query, nil
 }
 
 func parseHour(c *gin.Context, param string, defaultValue int) int {
@@ -89,6 +56,196 @@ func parseHour(c *gin.Context, param string, defaultValue int) int {
 	}
 }
 
+// parseEventFilters reads the filters from the url, ignoring any that don't
+// make sense like parseHour does.
+func parseEventFilters(c *gin.Context) postgres.EventFilters {
+	var filters postgres.EventFilters
+	if maxCost, err := strconv.Atoi(c.Query("max_cost")); err == nil && maxCost >= 0 {
+		filters.MaxCost = &maxCost
+	}
+	for _, key := range c.QueryArray("age") {
+		if _, found := events.FindRequirement(events.AgeGroups, key); found {
+			filters.AgeGroups = append(filters.AgeGroups, key)
+		}
+	}
+	for _, key := range c.QueryArray("experience") {
+		if _, found := events.FindRequirement(events.ExperienceLevels, key); found {
+			filters.Experience = append(filters.Experience, key)
+		}
+	}
+	if players, err := strconv.Atoi(c.Query("players")); err == nil && players > 0 {
+		filters.Players = players
+	}
+	if maxDuration, err := strconv.Atoi(c.Query("max_duration")); err == nil && maxDuration > 0 {
+		filters.MaxDuration = maxDuration
+	}
+	if materials, err := strconv.ParseBool(c.Query("materials")); err == nil {
+		filters.MaterialsProvided = materials
+	}
+	if tournament, err := strconv.ParseBool(c.Query("tournament")); err == nil {
+		filters.Tournament = &tournament
+	}
+	return filters
+}
+
+// searchYear is the year a search asked for, this year if it didn't ask.
+func searchYear(c *gin.Context) int {
+	year, err := strconv.Atoi(c.Query("year"))
+	if err != nil {
+		return time.Now().Year()
+	}
+	return year
+}
+
+// parseSearchRequest reads a search from the url parameters the search page
+// and the API share. Parameters that don't make sense are ignored, only a
+// query that doesn't parse is an error. The query is returned either way.
+func parseSearchRequest(c *gin.Context) (*postgres.ParsedQuery, error) {
+	days := make(map[string]bool)
+	for _, day := range []string{"wed", "thu", "fri", "sat", "sun"} {
+		param, found := c.GetQuery(day)
+
+		if found && len(param) > 0 {
+			if b, err := strconv.ParseBool(param); err == nil {
+				days[day] = b
+			}
+		}
+	}
+	parsedQuery, queryErr := parseQuery(c.Query("q"), searchYear(c), days)
+
+	parsedQuery.StartBeforeHour = parseHour(c, "start_before", -1)
+	parsedQuery.StartAfterHour = parseHour(c, "start_after", -1)
+	parsedQuery.EndBeforeHour = parseHour(c, "end_before", -1)
+	parsedQuery.EndAfterHour = parseHour(c, "end_after", -1)
+	parsedQuery.EventFilters = parseEventFilters(c)
+	orgId, err := strconv.Atoi(c.Query("org_id"))
+	if err == nil {
+		parsedQuery.OrgId = orgId
+	}
+	for _, sortBy := range postgres.SortOrders {
+		if c.Query("sort") == sortBy {
+			parsedQuery.SortBy = sortBy
+		}
+	}
+
+	// Filter out nonsensical start times -- if you set both to the same, you
+	// probably don't want any filter applied on the field.
+	if parsedQuery.StartBeforeHour == parsedQuery.StartAfterHour {
+		parsedQuery.StartBeforeHour = -1
+		parsedQuery.StartAfterHour = -1
+	}
+	if parsedQuery.EndAfterHour == parsedQuery.EndBeforeHour {
+		parsedQuery.EndAfterHour = -1
+		parsedQuery.EndBeforeHour = -1
+	}
+	return parsedQuery, queryErr
+}
+
+// refinedFacet is a facet of search results as links that narrow the search
+// to each of its values.
+type refinedFacet struct {
+	Label       string
+	Refinements []*refinement
+}
+
+type refinement struct {
+	Label string
+	Count int
+	Url   string
+}
+
+// bucketTerms are the search terms for a number field being in a bucket.
+func bucketTerms(field string, buckets []postgres.Bucket, key string) string {
+	for _, bucket := range buckets {
+		if bucket.Key != key {
+			continue
+		}
+		if bucket.To == bucket.From+1 {
+			return fmt.Sprintf("%v:%d", field, bucket.From)
+		}
+		terms := fmt.Sprintf("%v>=%d", field, bucket.From)
+		if bucket.To > 0 {
+			terms += fmt.Sprintf(" %v<%d", field, bucket.To)
+		}
+		return terms
+	}
+	return ""
+}
+
+func copyParams(params url.Values) url.Values {
+	copied := url.Values{}
+	for key, values := range params {
+		copied[key] = append([]string(nil), values...)
+	}
+	return copied
+}
+
+// refineSearch is the url for a search narrowed to a facet value. Facets
+// with search fields add a term to the query, the rest replace their url
+// parameter.
+func refineSearch(params url.Values, facet string, value string) string {
+	refined := copyParams(params)
+	addTerms := func(terms string) {
+		refined.Set("q", strings.TrimSpace(refined.Get("q")+" "+terms))
+	}
+
+	switch facet {
+	case postgres.FacetCategory:
+		addTerms("cat:" + value)
+	case postgres.FacetDay:
+		addTerms("day:" + value)
+	case postgres.FacetStart:
+		addTerms(bucketTerms("start", postgres.StartBuckets, value))
+	case postgres.FacetCost:
+		addTerms(bucketTerms("cost", postgres.CostBuckets, value))
+	case postgres.FacetExperience:
+		refined.Set("experience", value)
+	case postgres.FacetAge:
+		refined.Set("age", value)
+	case postgres.FacetOrg:
+		refined.Set("org_id", value)
+	}
+	return "/search?" + refined.Encode()
+}
+
+func refineFacets(params url.Values, facets []*postgres.Facet) []*refinedFacet {
+	refined := make([]*refinedFacet, 0, len(facets))
+	for _, facet := range facets {
+		refinements := make([]*refinement, 0, len(facet.Values))
+		for _, value := range facet.Values {
+			refinements = append(refinements, &refinement{
+				Label: value.Label,
+				Count: value.Count,
+				Url:   refineSearch(params, facet.Name, value.Value),
+			})
+		}
+		refined = append(refined, &refinedFacet{Label: facet.Label, Refinements: refinements})
+	}
+	return refined
+}
+
+// didYouMean is a search with misspelled words corrected, for searches that
+// found nothing. It's nil if nothing could be corrected.
+func didYouMean(db *sql.DB, params url.Values, query *postgres.ParsedQuery) *refinement {
+	parsed, err := search.Parse(query.RawQuery)
+	if err != nil || len(parsed.Words()) == 0 {
+		return nil
+	}
+	corrections, err := postgres.SpellingSuggestions(db, query.Year, parsed.Words())
+	if err != nil {
+		log.Printf("Error finding spelling suggestions: %v", err)
+		return nil
+	}
+	respelled := parsed.Respell(corrections)
+	if respelled == "" {
+		return nil
+	}
+
+	suggested := copyParams(params)
+	suggested.Set("q", respelled)
+	return &refinement{Label: respelled, Url: "/search?" + suggested.Encode()}
+}
+
 func Search(db *sql.DB) func(c *gin.Context) {
 	defaultKeyFunc := func(g *postgres.EventGroup) (string, string) {
 		majorGroup := events.LongCategory(g.ShortCategory)
@@ -101,50 +258,52 @@ func Search(db *sql.DB) func(c *gin.Context) {
 		return majorGroup, minorGroup
 	}
 
-	return func(c *gin.Context) {
-		query := c.Query("q")
-		year, err := strconv.Atoi(c.Query("year"))
-		if err != nil {
-			year = time.Now().Year()
-		}
-
-		days := make(map[string]bool)
-		for _, day := range []string{"wed", "thu", "fri", "sat", "sun"} {
-			param, found := c.GetQuery(day)
-
-			if found && len(param) > 0 {
-				if b, err := strconv.ParseBool(param); err == nil {
-					days[day] = b
-				}
+	// Headings are in order of risk, so results need to be sorted by it too
+	sellOutKeyFunc := func(g *postgres.EventGroup) (string, string) {
+		majorGroup := "Not selling"
+		if g.SellOutHours != nil {
+			switch hours := *g.SellOutHours; {
+			case hours < 24:
+				majorGroup = "Within a day"
+			case hours < 72:
+				majorGroup = "Within 3 days"
+			case hours < 7*24:
+				majorGroup = "Within a week"
+			default:
+				majorGroup = "Later"
 			}
 		}
-		parsedQuery := parseQuery(query, year, days)
-
-		parsedQuery.StartBeforeHour = parseHour(c, "start_before", -1)
-		parsedQuery.StartAfterHour = parseHour(c, "start_after", -1)
-		parsedQuery.EndBeforeHour = parseHour(c, "end_before", -1)
-		parsedQuery.EndAfterHour = parseHour(c, "end_after", -1)
-		orgId, err := strconv.Atoi(c.Query("org_id"))
-		if err == nil {
-			parsedQuery.OrgId = orgId
-		}
+		return majorGroup, events.LongCategory(g.ShortCategory)
+	}
 
-		// Filter out nonsensical start times -- if you set both to the same, you
-		// probably don't want any filter applied on the field.
-		if parsedQuery.StartBeforeHour == parsedQuery.StartAfterHour {
-			parsedQuery.StartBeforeHour = -1
-			parsedQuery.StartAfterHour = -1
-		}
-		if parsedQuery.EndAfterHour == parsedQuery.EndBeforeHour {
-			parsedQuery.EndAfterHour = -1
-			parsedQuery.EndBeforeHour = -1
-		}
+	return func(c *gin.Context) {
+		query := c.Query("q")
+		year := searchYear(c)
+		parsedQuery, queryErr := parseSearchRequest(c)
 
-		eventGroups, err := postgres.FindEvents(db, parsedQuery)
+		// A query that doesn't parse still gets the results page, so the
+		// error can be shown next to the search to fix it
+		status := http.StatusOK
+		eventGroups := make([]*postgres.EventGroup, 0)
+		var facets []*postgres.Facet
+		var err error
+		if queryErr != nil {
+			status = http.StatusBadRequest
+		} else {
+			eventGroups, facets, err = postgres.FindEvents(db, parsedQuery)
+		}
 		totalEvents := 0
 		for _, group := range eventGroups {
 			totalEvents += group.Count
 		}
+		var suggestion *refinement
+		if err == nil && queryErr == nil && len(eventGroups) == 0 {
+			suggestion = didYouMean(db, c.Request.URL.Query(), parsedQuery)
+		}
+		var warnings []*search.Error
+		if parsed, parseErr := search.Parse(query); parseErr == nil {
+			warnings = parsed.Warnings
+		}
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
@@ -152,18 +311,30 @@ func Search(db *sql.DB) func(c *gin.Context) {
 			appContext := c.MustGet("context").(*Context)
 			appContext.Year = year
 
+			breakdown := "Category"
 			majorHeadings, minorHeadings, partitions := PartitionGroups(eventGroups, defaultKeyFunc)
-			c.HTML(http.StatusOK, "results.html", gin.H{
-				"context":       appContext,
-				"majorHeadings": majorHeadings,
-				"minorHeadings": minorHeadings,
-				"partitions":    partitions,
-				"totalEvents":   totalEvents,
-				"groups":        len(eventGroups),
-				"breakdown":     "Category",
-				"pageHeader":    "Search",
-				"subHeader":     query,
-				"query":         parsedQuery,
+			if parsedQuery.SortBy == postgres.SortBySellOutRisk {
+				breakdown = "Sell out risk"
+				majorHeadings, minorHeadings, partitions = PartitionGroupsInOrder(eventGroups, sellOutKeyFunc)
+			}
+			c.HTML(status, "results.html", gin.H{
+				"context":          appContext,
+				"majorHeadings":    majorHeadings,
+				"minorHeadings":    minorHeadings,
+				"partitions":       partitions,
+				"totalEvents":      totalEvents,
+				"groups":           len(eventGroups),
+				"breakdown":        breakdown,
+				"pageHeader":       "Search",
+				"subHeader":        query,
+				"query":            parsedQuery,
+				"queryError":       queryErr,
+				"queryWarnings":    warnings,
+				"searchFields":     search.FieldNames(),
+				"ageGroups":        events.AgeGroups,
+				"experienceLevels": events.ExperienceLevels,
+				"facets":           refineFacets(c.Request.URL.Query(), facets),
+				"didYouMean":       suggestion,
 			})
 		}
 	}
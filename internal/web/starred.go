@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -132,6 +133,16 @@ func StarredPage(db *sql.DB) func(c *gin.Context) {
 			return
 		}
 
+		eventIds := make([]string, len(starredEvents))
+		for i, e := range starredEvents {
+			eventIds[i] = e.EventId
+		}
+		sellOutHours, err := postgres.LoadSellOutHours(db, eventIds)
+		if err != nil {
+			// The other tabs are still useful without estimates
+			log.Printf("Error loading sell out estimates: %v", err)
+		}
+
 		startDate := GenconStartDate(appContext.Year)
 		endDate := GenconEndDate(appContext.Year)
 
@@ -140,6 +151,7 @@ func StarredPage(db *sql.DB) func(c *gin.Context) {
 			"context":          appContext,
 			"eventsByDay":      events.PartitionEventsByDay(starredEvents),
 			"eventsByCategory": events.PartitionEventsByCategory(starredEvents),
+			"eventsBySellOut":  sortBySellOut(starredEvents, sellOutHours),
 			"allCategories":    events.AllCategories(),
 			"calendarGroups":   groupedEvents,
 			"startDate":        startDate,
@@ -147,3 +159,32 @@ func StarredPage(db *sql.DB) func(c *gin.Context) {
 		})
 	}
 }
+
+type sellOutEvent struct {
+	Event        *events.GenconEvent
+	SellOutHours *float64
+}
+
+// sortBySellOut orders events soonest to sell out first, with sold out events
+// before everything else and events that aren't selling last.
+func sortBySellOut(starredEvents []*events.GenconEvent, sellOutHours map[string]float64) []*sellOutEvent {
+	sorted := make([]*sellOutEvent, 0, len(starredEvents))
+	for _, e := range starredEvents {
+		entry := sellOutEvent{Event: e}
+		if e.TicketsAvailable == 0 {
+			soldOut := 0.0
+			entry.SellOutHours = &soldOut
+		} else if hours, found := sellOutHours[e.EventId]; found {
+			entry.SellOutHours = &hours
+		}
+		sorted = append(sorted, &entry)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].SellOutHours, sorted[j].SellOutHours
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return *a < *b
+	})
+	return sorted
+}
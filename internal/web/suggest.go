@@ -0,0 +1,30 @@
+package web
+
+import (
+	"github.com/Encinarus/genconplanner/internal/background"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Enough to fill the dropdown under the search box
+const maxSuggestions = 10
+
+// Suggest completes what's been typed in the search box, as JSON.
+func Suggest(index *background.SuggestIndex) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		year, err := strconv.Atoi(c.Query("year"))
+		if err != nil {
+			year = time.Now().Year()
+		}
+		query := c.Query("q")
+
+		c.Header("Cache-Control", "public, max-age=60")
+		c.JSON(http.StatusOK, gin.H{
+			"query":       query,
+			"year":        year,
+			"suggestions": index.Suggest(year, query, maxSuggestions),
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/Encinarus/genconplanner/internal/background"
 	"html/template"
+	"math"
 	"regexp"
 	"strings"
 )
@@ -22,6 +23,7 @@ func GetTemplateFunctions(cache *background.GameCache) template.FuncMap {
 		"bggRating":     func(gameName string) string { return bggRating(gameName, cache) },
 		"bggNumRatings": func(gameName string) string { return bggNumRatings(gameName, cache) },
 		"bggYear":       func(gameName string) string { return bggYear(gameName, cache) },
+		"sellOutIn":     sellOutIn,
 	}
 }
 
@@ -74,3 +76,20 @@ func bggYear(gameName string, cache *background.GameCache) string {
 
 	return fmt.Sprintf("%d", bggGame.YearPublished)
 }
+
+// sellOutIn describes an estimate of hours until sell out, empty when there's
+// no estimate.
+func sellOutIn(hours *float64) string {
+	switch {
+	case hours == nil:
+		return ""
+	case *hours <= 0:
+		return "Sold out"
+	case *hours < 1:
+		return "Sells out within the hour"
+	case *hours < 48:
+		return fmt.Sprintf("Sells out in ~%v hours", math.Round(*hours))
+	default:
+		return fmt.Sprintf("Sells out in ~%v days", math.Round(*hours/24))
+	}
+}
@@ -2,11 +2,13 @@ package web
 
 import (
 	"database/sql"
+	"github.com/Encinarus/genconplanner/internal/notify"
 	"github.com/Encinarus/genconplanner/internal/postgres"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -34,14 +36,47 @@ func User(db *sql.DB) gin.HandlerFunc {
 			log.Printf("Num parties: %v", len(parties))
 		}
 
+		alertSettings, err := postgres.LoadAlertSettings(db, appContext.Email)
+		if err != nil {
+			log.Printf("Unable to load alert settings: %v", err)
+		}
+
 		c.HTML(http.StatusOK, "user.html", gin.H{
 			"context": appContext,
 			"user":    appContext.User,
 			"parties": parties,
+			"alerts":  alertSettings,
 		})
 	}
 }
 
+func UpdateAlertSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		if appContext.Email == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		settings := &postgres.AlertSettings{
+			Email:        appContext.Email,
+			EmailEnabled: c.PostForm("email_enabled") != "",
+			WebhookUrl:   strings.TrimSpace(c.PostForm("webhook_url")),
+		}
+		if settings.WebhookUrl != "" {
+			if err := notify.ValidateWebhookUrl(settings.WebhookUrl); err != nil {
+				c.String(http.StatusBadRequest, "Bad webhook url: %v", err)
+				return
+			}
+		}
+		if err := postgres.SaveAlertSettings(db, settings); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Redirect(http.StatusSeeOther, "/user")
+	}
+}
+
 func UserNameChange(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		year, err := strconv.Atoi(c.Param("year"))
@@ -4,13 +4,18 @@ import (
 	"context"
 	"database/sql"
 	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+	"flag"
 	"github.com/Encinarus/genconplanner/internal/postgres"
 	"github.com/gin-gonic/gin"
 	"log"
+	"net/http"
 	"sort"
 	"strings"
 )
 
+var adminEmails = flag.String("admins", "", "comma separated emails of users allowed on admin pages")
+
 type Context struct {
 	Year        int
 	DisplayName string
@@ -19,6 +24,63 @@ type Context struct {
 	User        *postgres.User
 }
 
+// IsAdmin reports whether the signed in user is listed in -admins.
+func (c *Context) IsAdmin() bool {
+	if c.Email == "" {
+		return false
+	}
+	for _, admin := range strings.Split(*adminEmails, ",") {
+		if strings.EqualFold(strings.TrimSpace(admin), c.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireAdmin rejects requests from anyone who isn't an admin. Must be
+// installed after BootstrapContext.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		appContext := c.MustGet("context").(*Context)
+		if appContext.Email == "" {
+			c.HTML(http.StatusUnauthorized, "signin.html", gin.H{
+				"context":  appContext,
+				"redirect": c.Request.URL,
+			})
+			c.Abort()
+			return
+		}
+		if !appContext.IsAdmin() {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// signinToken is the Firebase ID token of whoever's signed in. Browsers send
+// it as a cookie, API clients as a bearer token.
+func signinToken(c *gin.Context) string {
+	if token, err := c.Cookie("signinToken"); err == nil {
+		return token
+	}
+	if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != c.GetHeader("Authorization") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// tokenEmail is the email a verified token was issued for, empty if there's
+// no token or its email isn't verified. Some providers let anyone claim any
+// address, and admins are picked by email.
+func tokenEmail(token *auth.Token) string {
+	if token == nil || token.Claims["email_verified"] != true {
+		return ""
+	}
+	email, _ := token.Claims["email"].(string)
+	return email
+}
+
 func BootstrapContext(app *firebase.App, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var appContext Context
@@ -28,8 +90,7 @@ func BootstrapContext(app *firebase.App, db *sql.DB) gin.HandlerFunc {
 			log.Printf("UserAgent: %v\n", c.Request.UserAgent())
 		}
 		// Create user if needed based on cookie
-		idToken, err := c.Cookie("signinToken")
-		if err == nil {
+		if idToken := signinToken(c); idToken != "" {
 			ctx := context.Background()
 			client, err := app.Auth(ctx)
 			if err != nil {
@@ -40,9 +101,9 @@ func BootstrapContext(app *firebase.App, db *sql.DB) gin.HandlerFunc {
 			if err != nil {
 				log.Printf("error verifying ID token: %v\n", err)
 			}
-			if token != nil {
-				email := token.Claims["email"].(string)
-
+			// Tokens without a verified email, like phone sign ins, are
+			// treated as signed out
+			if email := tokenEmail(token); email != "" {
 				appContext.Email = email
 				user, err := postgres.LoadOrCreateUser(db, email)
 				if err != nil {
@@ -66,6 +127,23 @@ func PartitionGroups(
 	groups []*postgres.EventGroup,
 	keyFunction func(*postgres.EventGroup) (string, string),
 ) ([]string, map[string][]string, map[string]map[string][]*postgres.EventGroup) {
+	return partitionGroups(groups, keyFunction, true)
+}
+
+// PartitionGroupsInOrder partitions like PartitionGroups, but keeps headings
+// in the order they're first seen, for when groups are already sorted.
+func PartitionGroupsInOrder(
+	groups []*postgres.EventGroup,
+	keyFunction func(*postgres.EventGroup) (string, string),
+) ([]string, map[string][]string, map[string]map[string][]*postgres.EventGroup) {
+	return partitionGroups(groups, keyFunction, false)
+}
+
+func partitionGroups(
+	groups []*postgres.EventGroup,
+	keyFunction func(*postgres.EventGroup) (string, string),
+	sortKeys bool,
+) ([]string, map[string][]string, map[string]map[string][]*postgres.EventGroup) {
 
 	majorPartitions := make(map[string]map[string][]*postgres.EventGroup)
 	majorKeys := make([]string, 0)
@@ -93,14 +171,20 @@ func PartitionGroups(
 		}
 		majorPartitions[majorKey][minorKey] = append(majorPartitions[majorKey][minorKey], group)
 	}
-	sort.Strings(majorKeys)
-	for k := range minorKeys {
-		sort.Strings(minorKeys[k])
+	if sortKeys {
+		sort.Strings(majorKeys)
+		for k := range minorKeys {
+			sort.Strings(minorKeys[k])
+		}
 	}
 	// Now that we've sorted, move sold out to the end
 	if hasSoldOut && len(majorKeys) > 1 {
-		index := sort.SearchStrings(majorKeys, soldOut)
-		majorKeys = append(majorKeys[:index], majorKeys[index+1:]...)
+		for index, key := range majorKeys {
+			if key == soldOut {
+				majorKeys = append(majorKeys[:index], majorKeys[index+1:]...)
+				break
+			}
+		}
 		majorKeys = append(majorKeys, soldOut)
 	}
 	return majorKeys, minorKeys, majorPartitions
@@ -0,0 +1,28 @@
+package web
+
+import (
+	"firebase.google.com/go/auth"
+	"testing"
+)
+
+func TestTokenEmail(t *testing.T) {
+	tests := []struct {
+		token    *auth.Token
+		expected string
+	}{
+		{nil, ""},
+		{&auth.Token{Claims: map[string]interface{}{"email": "gm@example.com", "email_verified": true}}, "gm@example.com"},
+		// Anyone can claim an address they haven't verified
+		{&auth.Token{Claims: map[string]interface{}{"email": "gm@example.com"}}, ""},
+		{&auth.Token{Claims: map[string]interface{}{"email": "gm@example.com", "email_verified": false}}, ""},
+		{&auth.Token{Claims: map[string]interface{}{"email": "gm@example.com", "email_verified": "true"}}, ""},
+		// Phone sign ins have no email
+		{&auth.Token{Claims: map[string]interface{}{"phone_number": "+15555550100"}}, ""},
+		{&auth.Token{Claims: map[string]interface{}{"email": 42, "email_verified": true}}, ""},
+	}
+	for _, test := range tests {
+		if actual := tokenEmail(test.token); actual != test.expected {
+			t.Errorf("tokenEmail(%v) = %q, expected %q", test.token, actual, test.expected)
+		}
+	}
+}